@@ -8,7 +8,7 @@ import (
 )
 
 func main() {
-	data := []*index.DataPoint[string]{
+	data := []*index.DataPoint[string, float64]{
 		index.NewDataPoint("0", []float64{0.16, 0.9}),
 		index.NewDataPoint("1", []float64{0.5, 0.5}),
 		index.NewDataPoint("2", []float64{0.014, 0.99}),
@@ -31,7 +31,7 @@ func main() {
 		index.NewDataPoint("19", []float64{0.91, 0.12}),
 	}
 
-	index, err := index.NewVectorIndex(1, 2, 2, data, index.NewCosineDistanceMeasure())
+	index, err := index.NewVectorIndex(1, 2, 2, data, index.NewCosineDistanceMeasure[float64]())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v", err)
 		os.Exit(1)
@@ -47,6 +47,6 @@ func main() {
 
 	fmt.Println("The following vectors are the closest neighbors based on cosine similarity:")
 	for _, searchResult := range *searchResults {
-		fmt.Println(fmt.Sprintf("id: %v, distance: %f", searchResult.ID, searchResult.Distance))
+		fmt.Println(fmt.Sprintf("id: %v, distance: %f, similarity: %f", searchResult.ID, searchResult.Distance, searchResult.Score))
 	}
 }
@@ -0,0 +1,149 @@
+package math
+
+import (
+	"unsafe"
+
+	"golang.org/x/exp/constraints"
+)
+
+// The vector kernels below dominate the time spent searching an index. They are implemented in assembly for CPUs
+// supporting AVX2 and AVX-512, the unrolled Go implementations are used on other platforms and for short vectors.
+
+// VectorDotProduct returns the dot product of base and the first len(base) values of target.
+// float32 vectors are multiplied and summed up in single precision.
+func VectorDotProduct[F constraints.Float](base, target []F) float64 {
+	if len(base) == 0 {
+		return 0
+	}
+
+	target = target[:len(base)]
+
+	if is32Bit[F]() {
+		return float64(dot32(as32(base), as32(target)))
+	}
+
+	return dot(as64(base), as64(target))
+}
+
+// SquaredEuclideanDistance returns the squared euclidean distance of base and the first len(base) values of target.
+func SquaredEuclideanDistance[F constraints.Float](base, target []F) float64 {
+	if len(base) == 0 {
+		return 0
+	}
+
+	target = target[:len(base)]
+
+	if is32Bit[F]() {
+		return float64(squaredEuclidean32(as32(base), as32(target)))
+	}
+
+	return squaredEuclidean(as64(base), as64(target))
+}
+
+// is32Bit reports whether the underlying type of F is float32.
+func is32Bit[F constraints.Float]() bool {
+	var f F
+
+	return unsafe.Sizeof(f) == unsafe.Sizeof(float32(0))
+}
+
+// as32 reinterprets a non-empty slice whose elements have the underlying type float32, so named float types use the kernels as well.
+func as32[F constraints.Float](v []F) []float32 {
+	return unsafe.Slice((*float32)(unsafe.Pointer(&v[0])), len(v))
+}
+
+// as64 is the float64 counterpart of as32.
+func as64[F constraints.Float](v []F) []float64 {
+	return unsafe.Slice((*float64)(unsafe.Pointer(&v[0])), len(v))
+}
+
+// dotGeneric uses four independent sums, so consecutive multiplications don't have to wait for each other.
+func dotGeneric(a, b []float64) float64 {
+	var s0, s1, s2, s3 float64
+
+	b = b[:len(a)]
+	i := 0
+
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+
+	return (s0 + s1) + (s2 + s3)
+}
+
+func squaredEuclideanGeneric(a, b []float64) float64 {
+	var s0, s1, s2, s3 float64
+
+	b = b[:len(a)]
+	i := 0
+
+	for ; i+4 <= len(a); i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+
+	for ; i < len(a); i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+
+	return (s0 + s1) + (s2 + s3)
+}
+
+func dot32Generic(a, b []float32) float32 {
+	var s0, s1, s2, s3 float32
+
+	b = b[:len(a)]
+	i := 0
+
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+
+	return (s0 + s1) + (s2 + s3)
+}
+
+func squaredEuclidean32Generic(a, b []float32) float32 {
+	var s0, s1, s2, s3 float32
+
+	b = b[:len(a)]
+	i := 0
+
+	for ; i+4 <= len(a); i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+
+	for ; i < len(a); i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+
+	return (s0 + s1) + (s2 + s3)
+}
@@ -0,0 +1,128 @@
+//go:build amd64 && !purego
+
+package math
+
+// vectors shorter than these lengths are faster processed by the Go implementations than by the assembly kernels
+const (
+	minAVX2Length   = 16
+	minAVX512Length = 32
+)
+
+var (
+	hasAVX2   bool
+	hasAVX512 bool
+)
+
+func init() {
+	hasAVX2, hasAVX512 = detectCPUFeatures()
+}
+
+// detectCPUFeatures reports whether the CPU and the operating system support AVX2 with FMA and AVX-512.
+func detectCPUFeatures() (bool, bool) {
+	const (
+		// CPUID.1:ECX
+		fmaBit     = 1 << 12
+		osxsaveBit = 1 << 27
+		avxBit     = 1 << 28
+		// CPUID.7.0:EBX
+		avx2Bit    = 1 << 5
+		avx512FBit = 1 << 16
+		// XCR0, the operating system saves the SSE and AVX state, and the opmask and the upper ZMM registers
+		xcr0AVX    = 1<<1 | 1<<2
+		xcr0AVX512 = xcr0AVX | 1<<5 | 1<<6 | 1<<7
+	)
+
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return false, false
+	}
+
+	_, _, ecx1, _ := cpuid(1, 0)
+	if ecx1&(fmaBit|osxsaveBit|avxBit) != fmaBit|osxsaveBit|avxBit {
+		return false, false
+	}
+
+	xcr0, _ := xgetbv()
+	_, ebx7, _, _ := cpuid(7, 0)
+
+	avx2 := xcr0&xcr0AVX == xcr0AVX && ebx7&avx2Bit != 0
+	avx512 := avx2 && xcr0&xcr0AVX512 == xcr0AVX512 && ebx7&avx512FBit != 0
+
+	return avx2, avx512
+}
+
+func dot(a, b []float64) float64 {
+	switch {
+	case hasAVX512 && len(a) >= minAVX512Length:
+		return dotAVX512(&a[0], &b[0], len(a))
+	case hasAVX2 && len(a) >= minAVX2Length:
+		return dotAVX2(&a[0], &b[0], len(a))
+	default:
+		return dotGeneric(a, b)
+	}
+}
+
+func squaredEuclidean(a, b []float64) float64 {
+	switch {
+	case hasAVX512 && len(a) >= minAVX512Length:
+		return squaredEuclideanAVX512(&a[0], &b[0], len(a))
+	case hasAVX2 && len(a) >= minAVX2Length:
+		return squaredEuclideanAVX2(&a[0], &b[0], len(a))
+	default:
+		return squaredEuclideanGeneric(a, b)
+	}
+}
+
+func dot32(a, b []float32) float32 {
+	switch {
+	case hasAVX512 && len(a) >= 2*minAVX512Length:
+		return dot32AVX512(&a[0], &b[0], len(a))
+	case hasAVX2 && len(a) >= 2*minAVX2Length:
+		return dot32AVX2(&a[0], &b[0], len(a))
+	default:
+		return dot32Generic(a, b)
+	}
+}
+
+func squaredEuclidean32(a, b []float32) float32 {
+	switch {
+	case hasAVX512 && len(a) >= 2*minAVX512Length:
+		return squaredEuclidean32AVX512(&a[0], &b[0], len(a))
+	case hasAVX2 && len(a) >= 2*minAVX2Length:
+		return squaredEuclidean32AVX2(&a[0], &b[0], len(a))
+	default:
+		return squaredEuclidean32Generic(a, b)
+	}
+}
+
+// implemented in kernels_amd64.s
+
+//go:noescape
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+//go:noescape
+func xgetbv() (eax, edx uint32)
+
+//go:noescape
+func dotAVX2(a, b *float64, n int) float64
+
+//go:noescape
+func dotAVX512(a, b *float64, n int) float64
+
+//go:noescape
+func squaredEuclideanAVX2(a, b *float64, n int) float64
+
+//go:noescape
+func squaredEuclideanAVX512(a, b *float64, n int) float64
+
+//go:noescape
+func dot32AVX2(a, b *float32, n int) float32
+
+//go:noescape
+func dot32AVX512(a, b *float32, n int) float32
+
+//go:noescape
+func squaredEuclidean32AVX2(a, b *float32, n int) float32
+
+//go:noescape
+func squaredEuclidean32AVX512(a, b *float32, n int) float32
@@ -0,0 +1,533 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// The kernels process blocks of four vector registers with independent accumulators, followed by single registers
+// and a scalar loop for the remaining values. The accumulators are summed up at the end.
+
+// func dotAVX2(a, b *float64, n int) float64
+TEXT ·dotAVX2(SB), NOSPLIT, $0-32
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VXORPD Y0, Y0, Y0
+	VXORPD Y1, Y1, Y1
+	VXORPD Y2, Y2, Y2
+	VXORPD Y3, Y3, Y3
+
+dotAVX2Block:
+	CMPQ CX, $16
+	JL   dotAVX2Single
+	VMOVUPD     (SI), Y4
+	VMOVUPD     32(SI), Y5
+	VMOVUPD     64(SI), Y6
+	VMOVUPD     96(SI), Y7
+	VFMADD231PD (DI), Y4, Y0
+	VFMADD231PD 32(DI), Y5, Y1
+	VFMADD231PD 64(DI), Y6, Y2
+	VFMADD231PD 96(DI), Y7, Y3
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $16, CX
+	JMP         dotAVX2Block
+
+dotAVX2Single:
+	CMPQ CX, $4
+	JL   dotAVX2Reduce
+	VMOVUPD     (SI), Y4
+	VFMADD231PD (DI), Y4, Y0
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $4, CX
+	JMP         dotAVX2Single
+
+dotAVX2Reduce:
+	VADDPD       Y1, Y0, Y0
+	VADDPD       Y3, Y2, Y2
+	VADDPD       Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPD       X1, X0, X0
+	VHADDPD      X0, X0, X0
+
+dotAVX2Scalar:
+	TESTQ CX, CX
+	JE    dotAVX2Done
+	VMOVSD      (SI), X1
+	VFMADD231SD (DI), X1, X0
+	ADDQ        $8, SI
+	ADDQ        $8, DI
+	DECQ        CX
+	JMP         dotAVX2Scalar
+
+dotAVX2Done:
+	VZEROUPPER
+	MOVSD X0, ret+24(FP)
+	RET
+
+// func dotAVX512(a, b *float64, n int) float64
+TEXT ·dotAVX512(SB), NOSPLIT, $0-32
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VPXORQ Z0, Z0, Z0
+	VPXORQ Z1, Z1, Z1
+	VPXORQ Z2, Z2, Z2
+	VPXORQ Z3, Z3, Z3
+
+dotAVX512Block:
+	CMPQ CX, $32
+	JL   dotAVX512Single
+	VMOVUPD     (SI), Z4
+	VMOVUPD     64(SI), Z5
+	VMOVUPD     128(SI), Z6
+	VMOVUPD     192(SI), Z7
+	VFMADD231PD (DI), Z4, Z0
+	VFMADD231PD 64(DI), Z5, Z1
+	VFMADD231PD 128(DI), Z6, Z2
+	VFMADD231PD 192(DI), Z7, Z3
+	ADDQ        $256, SI
+	ADDQ        $256, DI
+	SUBQ        $32, CX
+	JMP         dotAVX512Block
+
+dotAVX512Single:
+	CMPQ CX, $8
+	JL   dotAVX512Reduce
+	VMOVUPD     (SI), Z4
+	VFMADD231PD (DI), Z4, Z0
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $8, CX
+	JMP         dotAVX512Single
+
+dotAVX512Reduce:
+	VADDPD        Z1, Z0, Z0
+	VADDPD        Z3, Z2, Z2
+	VADDPD        Z2, Z0, Z0
+	VEXTRACTF64X4 $1, Z0, Y1
+	VADDPD        Y1, Y0, Y0
+	VEXTRACTF128  $1, Y0, X1
+	VADDPD        X1, X0, X0
+	VHADDPD       X0, X0, X0
+
+dotAVX512Scalar:
+	TESTQ CX, CX
+	JE    dotAVX512Done
+	VMOVSD      (SI), X1
+	VFMADD231SD (DI), X1, X0
+	ADDQ        $8, SI
+	ADDQ        $8, DI
+	DECQ        CX
+	JMP         dotAVX512Scalar
+
+dotAVX512Done:
+	VZEROUPPER
+	MOVSD X0, ret+24(FP)
+	RET
+
+// func squaredEuclideanAVX2(a, b *float64, n int) float64
+TEXT ·squaredEuclideanAVX2(SB), NOSPLIT, $0-32
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VXORPD Y0, Y0, Y0
+	VXORPD Y1, Y1, Y1
+	VXORPD Y2, Y2, Y2
+	VXORPD Y3, Y3, Y3
+
+squaredEuclideanAVX2Block:
+	CMPQ CX, $16
+	JL   squaredEuclideanAVX2Single
+	VMOVUPD     (SI), Y4
+	VMOVUPD     32(SI), Y5
+	VMOVUPD     64(SI), Y6
+	VMOVUPD     96(SI), Y7
+	VSUBPD      (DI), Y4, Y4
+	VSUBPD      32(DI), Y5, Y5
+	VSUBPD      64(DI), Y6, Y6
+	VSUBPD      96(DI), Y7, Y7
+	VFMADD231PD Y4, Y4, Y0
+	VFMADD231PD Y5, Y5, Y1
+	VFMADD231PD Y6, Y6, Y2
+	VFMADD231PD Y7, Y7, Y3
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $16, CX
+	JMP         squaredEuclideanAVX2Block
+
+squaredEuclideanAVX2Single:
+	CMPQ CX, $4
+	JL   squaredEuclideanAVX2Reduce
+	VMOVUPD     (SI), Y4
+	VSUBPD      (DI), Y4, Y4
+	VFMADD231PD Y4, Y4, Y0
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $4, CX
+	JMP         squaredEuclideanAVX2Single
+
+squaredEuclideanAVX2Reduce:
+	VADDPD       Y1, Y0, Y0
+	VADDPD       Y3, Y2, Y2
+	VADDPD       Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPD       X1, X0, X0
+	VHADDPD      X0, X0, X0
+
+squaredEuclideanAVX2Scalar:
+	TESTQ CX, CX
+	JE    squaredEuclideanAVX2Done
+	VMOVSD      (SI), X1
+	VSUBSD      (DI), X1, X1
+	VFMADD231SD X1, X1, X0
+	ADDQ        $8, SI
+	ADDQ        $8, DI
+	DECQ        CX
+	JMP         squaredEuclideanAVX2Scalar
+
+squaredEuclideanAVX2Done:
+	VZEROUPPER
+	MOVSD X0, ret+24(FP)
+	RET
+
+// func squaredEuclideanAVX512(a, b *float64, n int) float64
+TEXT ·squaredEuclideanAVX512(SB), NOSPLIT, $0-32
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VPXORQ Z0, Z0, Z0
+	VPXORQ Z1, Z1, Z1
+	VPXORQ Z2, Z2, Z2
+	VPXORQ Z3, Z3, Z3
+
+squaredEuclideanAVX512Block:
+	CMPQ CX, $32
+	JL   squaredEuclideanAVX512Single
+	VMOVUPD     (SI), Z4
+	VMOVUPD     64(SI), Z5
+	VMOVUPD     128(SI), Z6
+	VMOVUPD     192(SI), Z7
+	VSUBPD      (DI), Z4, Z4
+	VSUBPD      64(DI), Z5, Z5
+	VSUBPD      128(DI), Z6, Z6
+	VSUBPD      192(DI), Z7, Z7
+	VFMADD231PD Z4, Z4, Z0
+	VFMADD231PD Z5, Z5, Z1
+	VFMADD231PD Z6, Z6, Z2
+	VFMADD231PD Z7, Z7, Z3
+	ADDQ        $256, SI
+	ADDQ        $256, DI
+	SUBQ        $32, CX
+	JMP         squaredEuclideanAVX512Block
+
+squaredEuclideanAVX512Single:
+	CMPQ CX, $8
+	JL   squaredEuclideanAVX512Reduce
+	VMOVUPD     (SI), Z4
+	VSUBPD      (DI), Z4, Z4
+	VFMADD231PD Z4, Z4, Z0
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $8, CX
+	JMP         squaredEuclideanAVX512Single
+
+squaredEuclideanAVX512Reduce:
+	VADDPD        Z1, Z0, Z0
+	VADDPD        Z3, Z2, Z2
+	VADDPD        Z2, Z0, Z0
+	VEXTRACTF64X4 $1, Z0, Y1
+	VADDPD        Y1, Y0, Y0
+	VEXTRACTF128  $1, Y0, X1
+	VADDPD        X1, X0, X0
+	VHADDPD       X0, X0, X0
+
+squaredEuclideanAVX512Scalar:
+	TESTQ CX, CX
+	JE    squaredEuclideanAVX512Done
+	VMOVSD      (SI), X1
+	VSUBSD      (DI), X1, X1
+	VFMADD231SD X1, X1, X0
+	ADDQ        $8, SI
+	ADDQ        $8, DI
+	DECQ        CX
+	JMP         squaredEuclideanAVX512Scalar
+
+squaredEuclideanAVX512Done:
+	VZEROUPPER
+	MOVSD X0, ret+24(FP)
+	RET
+
+// func dot32AVX2(a, b *float32, n int) float32
+TEXT ·dot32AVX2(SB), NOSPLIT, $0-28
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+
+dot32AVX2Block:
+	CMPQ CX, $32
+	JL   dot32AVX2Single
+	VMOVUPS     (SI), Y4
+	VMOVUPS     32(SI), Y5
+	VMOVUPS     64(SI), Y6
+	VMOVUPS     96(SI), Y7
+	VFMADD231PS (DI), Y4, Y0
+	VFMADD231PS 32(DI), Y5, Y1
+	VFMADD231PS 64(DI), Y6, Y2
+	VFMADD231PS 96(DI), Y7, Y3
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $32, CX
+	JMP         dot32AVX2Block
+
+dot32AVX2Single:
+	CMPQ CX, $8
+	JL   dot32AVX2Reduce
+	VMOVUPS     (SI), Y4
+	VFMADD231PS (DI), Y4, Y0
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $8, CX
+	JMP         dot32AVX2Single
+
+dot32AVX2Reduce:
+	VADDPS       Y1, Y0, Y0
+	VADDPS       Y3, Y2, Y2
+	VADDPS       Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPS       X1, X0, X0
+	VHADDPS      X0, X0, X0
+	VHADDPS      X0, X0, X0
+
+dot32AVX2Scalar:
+	TESTQ CX, CX
+	JE    dot32AVX2Done
+	VMOVSS      (SI), X1
+	VFMADD231SS (DI), X1, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         dot32AVX2Scalar
+
+dot32AVX2Done:
+	VZEROUPPER
+	MOVSS X0, ret+24(FP)
+	RET
+
+// func dot32AVX512(a, b *float32, n int) float32
+TEXT ·dot32AVX512(SB), NOSPLIT, $0-28
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VPXORQ Z0, Z0, Z0
+	VPXORQ Z1, Z1, Z1
+	VPXORQ Z2, Z2, Z2
+	VPXORQ Z3, Z3, Z3
+
+dot32AVX512Block:
+	CMPQ CX, $64
+	JL   dot32AVX512Single
+	VMOVUPS     (SI), Z4
+	VMOVUPS     64(SI), Z5
+	VMOVUPS     128(SI), Z6
+	VMOVUPS     192(SI), Z7
+	VFMADD231PS (DI), Z4, Z0
+	VFMADD231PS 64(DI), Z5, Z1
+	VFMADD231PS 128(DI), Z6, Z2
+	VFMADD231PS 192(DI), Z7, Z3
+	ADDQ        $256, SI
+	ADDQ        $256, DI
+	SUBQ        $64, CX
+	JMP         dot32AVX512Block
+
+dot32AVX512Single:
+	CMPQ CX, $16
+	JL   dot32AVX512Reduce
+	VMOVUPS     (SI), Z4
+	VFMADD231PS (DI), Z4, Z0
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $16, CX
+	JMP         dot32AVX512Single
+
+dot32AVX512Reduce:
+	VADDPS        Z1, Z0, Z0
+	VADDPS        Z3, Z2, Z2
+	VADDPS        Z2, Z0, Z0
+	VEXTRACTF64X4 $1, Z0, Y1
+	VADDPS        Y1, Y0, Y0
+	VEXTRACTF128  $1, Y0, X1
+	VADDPS        X1, X0, X0
+	VHADDPS       X0, X0, X0
+	VHADDPS       X0, X0, X0
+
+dot32AVX512Scalar:
+	TESTQ CX, CX
+	JE    dot32AVX512Done
+	VMOVSS      (SI), X1
+	VFMADD231SS (DI), X1, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         dot32AVX512Scalar
+
+dot32AVX512Done:
+	VZEROUPPER
+	MOVSS X0, ret+24(FP)
+	RET
+
+// func squaredEuclidean32AVX2(a, b *float32, n int) float32
+TEXT ·squaredEuclidean32AVX2(SB), NOSPLIT, $0-28
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+
+squaredEuclidean32AVX2Block:
+	CMPQ CX, $32
+	JL   squaredEuclidean32AVX2Single
+	VMOVUPS     (SI), Y4
+	VMOVUPS     32(SI), Y5
+	VMOVUPS     64(SI), Y6
+	VMOVUPS     96(SI), Y7
+	VSUBPS      (DI), Y4, Y4
+	VSUBPS      32(DI), Y5, Y5
+	VSUBPS      64(DI), Y6, Y6
+	VSUBPS      96(DI), Y7, Y7
+	VFMADD231PS Y4, Y4, Y0
+	VFMADD231PS Y5, Y5, Y1
+	VFMADD231PS Y6, Y6, Y2
+	VFMADD231PS Y7, Y7, Y3
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $32, CX
+	JMP         squaredEuclidean32AVX2Block
+
+squaredEuclidean32AVX2Single:
+	CMPQ CX, $8
+	JL   squaredEuclidean32AVX2Reduce
+	VMOVUPS     (SI), Y4
+	VSUBPS      (DI), Y4, Y4
+	VFMADD231PS Y4, Y4, Y0
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $8, CX
+	JMP         squaredEuclidean32AVX2Single
+
+squaredEuclidean32AVX2Reduce:
+	VADDPS       Y1, Y0, Y0
+	VADDPS       Y3, Y2, Y2
+	VADDPS       Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPS       X1, X0, X0
+	VHADDPS      X0, X0, X0
+	VHADDPS      X0, X0, X0
+
+squaredEuclidean32AVX2Scalar:
+	TESTQ CX, CX
+	JE    squaredEuclidean32AVX2Done
+	VMOVSS      (SI), X1
+	VSUBSS      (DI), X1, X1
+	VFMADD231SS X1, X1, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         squaredEuclidean32AVX2Scalar
+
+squaredEuclidean32AVX2Done:
+	VZEROUPPER
+	MOVSS X0, ret+24(FP)
+	RET
+
+// func squaredEuclidean32AVX512(a, b *float32, n int) float32
+TEXT ·squaredEuclidean32AVX512(SB), NOSPLIT, $0-28
+	MOVQ a+0(FP), SI
+	MOVQ b+8(FP), DI
+	MOVQ n+16(FP), CX
+	VPXORQ Z0, Z0, Z0
+	VPXORQ Z1, Z1, Z1
+	VPXORQ Z2, Z2, Z2
+	VPXORQ Z3, Z3, Z3
+
+squaredEuclidean32AVX512Block:
+	CMPQ CX, $64
+	JL   squaredEuclidean32AVX512Single
+	VMOVUPS     (SI), Z4
+	VMOVUPS     64(SI), Z5
+	VMOVUPS     128(SI), Z6
+	VMOVUPS     192(SI), Z7
+	VSUBPS      (DI), Z4, Z4
+	VSUBPS      64(DI), Z5, Z5
+	VSUBPS      128(DI), Z6, Z6
+	VSUBPS      192(DI), Z7, Z7
+	VFMADD231PS Z4, Z4, Z0
+	VFMADD231PS Z5, Z5, Z1
+	VFMADD231PS Z6, Z6, Z2
+	VFMADD231PS Z7, Z7, Z3
+	ADDQ        $256, SI
+	ADDQ        $256, DI
+	SUBQ        $64, CX
+	JMP         squaredEuclidean32AVX512Block
+
+squaredEuclidean32AVX512Single:
+	CMPQ CX, $16
+	JL   squaredEuclidean32AVX512Reduce
+	VMOVUPS     (SI), Z4
+	VSUBPS      (DI), Z4, Z4
+	VFMADD231PS Z4, Z4, Z0
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $16, CX
+	JMP         squaredEuclidean32AVX512Single
+
+squaredEuclidean32AVX512Reduce:
+	VADDPS        Z1, Z0, Z0
+	VADDPS        Z3, Z2, Z2
+	VADDPS        Z2, Z0, Z0
+	VEXTRACTF64X4 $1, Z0, Y1
+	VADDPS        Y1, Y0, Y0
+	VEXTRACTF128  $1, Y0, X1
+	VADDPS        X1, X0, X0
+	VHADDPS       X0, X0, X0
+	VHADDPS       X0, X0, X0
+
+squaredEuclidean32AVX512Scalar:
+	TESTQ CX, CX
+	JE    squaredEuclidean32AVX512Done
+	VMOVSS      (SI), X1
+	VSUBSS      (DI), X1, X1
+	VFMADD231SS X1, X1, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         squaredEuclidean32AVX512Scalar
+
+squaredEuclidean32AVX512Done:
+	VZEROUPPER
+	MOVSS X0, ret+24(FP)
+	RET
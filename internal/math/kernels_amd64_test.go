@@ -0,0 +1,118 @@
+//go:build amd64 && !purego
+
+package math
+
+import (
+	"fmt"
+	"testing"
+)
+
+type kernel64 struct {
+	name      string
+	supported bool
+	dot       func(a, b *float64, n int) float64
+	squared   func(a, b *float64, n int) float64
+}
+
+type kernel32 struct {
+	name      string
+	supported bool
+	dot       func(a, b *float32, n int) float32
+	squared   func(a, b *float32, n int) float32
+}
+
+func kernels64() []kernel64 {
+	return []kernel64{
+		{name: "avx2", supported: hasAVX2, dot: dotAVX2, squared: squaredEuclideanAVX2},
+		{name: "avx512", supported: hasAVX512, dot: dotAVX512, squared: squaredEuclideanAVX512},
+	}
+}
+
+func kernels32() []kernel32 {
+	return []kernel32{
+		{name: "avx2", supported: hasAVX2, dot: dot32AVX2, squared: squaredEuclidean32AVX2},
+		{name: "avx512", supported: hasAVX512, dot: dot32AVX512, squared: squaredEuclidean32AVX512},
+	}
+}
+
+// TestAssemblyKernels calls the kernels directly, the dispatchers don't use them for short vectors.
+func TestAssemblyKernels(t *testing.T) {
+	for _, k := range kernels64() {
+		k := k
+
+		t.Run(k.name, func(t *testing.T) {
+			if !k.supported {
+				t.Skipf("the cpu doesn't support %s", k.name)
+			}
+
+			for n := 1; n <= maxKernelTestLength; n++ {
+				a, b := randVectors(n)
+				assertKernel(t, "dot", n, k.dot(&a[0], &b[0], n), referenceDot(a, b), 1e-12)
+				assertKernel(t, "squaredEuclidean", n, k.squared(&a[0], &b[0], n), referenceSquaredEuclidean(a, b), 1e-12)
+			}
+		})
+	}
+
+	for _, k := range kernels32() {
+		k := k
+
+		t.Run(k.name+"-float32", func(t *testing.T) {
+			if !k.supported {
+				t.Skipf("the cpu doesn't support %s", k.name)
+			}
+
+			for n := 1; n <= maxKernelTestLength; n++ {
+				a, b := randVectors(n)
+				a32, b32 := toFloat32(a), toFloat32(b)
+				assertKernel(t, "dot32", n, float64(k.dot(&a32[0], &b32[0], n)), referenceDot(a, b), 1e-5)
+				assertKernel(t, "squaredEuclidean32", n, float64(k.squared(&a32[0], &b32[0], n)), referenceSquaredEuclidean(a, b), 1e-5)
+			}
+		})
+	}
+}
+
+// BenchmarkAssemblyKernels compares every kernel supported by the cpu to the Go implementations.
+func BenchmarkAssemblyKernels(b *testing.B) {
+	for _, dim := range benchmarkDims {
+		v1, v2 := randVectors(dim)
+		a32, b32 := toFloat32(v1), toFloat32(v2)
+
+		b.Run(fmt.Sprintf("dot-generic-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dotGeneric(v1, v2)
+			}
+		})
+
+		b.Run(fmt.Sprintf("dot32-generic-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dot32Generic(a32, b32)
+			}
+		})
+
+		for _, k := range kernels64() {
+			k := k
+			if !k.supported {
+				continue
+			}
+
+			b.Run(fmt.Sprintf("dot-%s-%d", k.name, dim), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					k.dot(&v1[0], &v2[0], dim)
+				}
+			})
+		}
+
+		for _, k := range kernels32() {
+			k := k
+			if !k.supported {
+				continue
+			}
+
+			b.Run(fmt.Sprintf("dot32-%s-%d", k.name, dim), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					k.dot(&a32[0], &b32[0], dim)
+				}
+			})
+		}
+	}
+}
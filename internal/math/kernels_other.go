@@ -0,0 +1,19 @@
+//go:build !amd64 || purego
+
+package math
+
+func dot(a, b []float64) float64 {
+	return dotGeneric(a, b)
+}
+
+func squaredEuclidean(a, b []float64) float64 {
+	return squaredEuclideanGeneric(a, b)
+}
+
+func dot32(a, b []float32) float32 {
+	return dot32Generic(a, b)
+}
+
+func squaredEuclidean32(a, b []float32) float32 {
+	return squaredEuclidean32Generic(a, b)
+}
@@ -0,0 +1,164 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// maxKernelTestLength covers the unrolled blocks, the single registers and the scalar tails of all kernels
+const maxKernelTestLength = 150
+
+func randVectors(n int) ([]float64, []float64) {
+	a := make([]float64, n)
+	b := make([]float64, n)
+
+	for i := range a {
+		a[i] = rand.Float64()*2 - 1
+		b[i] = rand.Float64()*2 - 1
+	}
+
+	return a, b
+}
+
+func toFloat32(v []float64) []float32 {
+	res := make([]float32, len(v))
+	for i := range v {
+		res[i] = float32(v[i])
+	}
+
+	return res
+}
+
+func referenceDot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+
+	return sum
+}
+
+func referenceSquaredEuclidean(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += (a[i] - b[i]) * (a[i] - b[i])
+	}
+
+	return sum
+}
+
+// assertKernel compares the result of a kernel to the reference with a tolerance relative to the length of the vectors.
+func assertKernel(t *testing.T, name string, n int, got, exp, eps float64) {
+	t.Helper()
+
+	if math.Abs(got-exp) > eps*float64(n+1) {
+		t.Fatalf("%s of length %d: got %v, expected %v", name, n, got, exp)
+	}
+}
+
+func TestKernels(t *testing.T) {
+	for n := 0; n <= maxKernelTestLength; n++ {
+		a, b := randVectors(n)
+		a32, b32 := toFloat32(a), toFloat32(b)
+
+		assertKernel(t, "VectorDotProduct", n, VectorDotProduct(a, b), referenceDot(a, b), 1e-12)
+		assertKernel(t, "SquaredEuclideanDistance", n, SquaredEuclideanDistance(a, b), referenceSquaredEuclidean(a, b), 1e-12)
+		assertKernel(t, "VectorDotProduct[float32]", n, VectorDotProduct(a32, b32), referenceDot(a, b), 1e-5)
+		assertKernel(t, "SquaredEuclideanDistance[float32]", n, SquaredEuclideanDistance(a32, b32), referenceSquaredEuclidean(a, b), 1e-5)
+		assertKernel(t, "dotGeneric", n, dotGeneric(a, b), referenceDot(a, b), 1e-12)
+		assertKernel(t, "squaredEuclideanGeneric", n, squaredEuclideanGeneric(a, b), referenceSquaredEuclidean(a, b), 1e-12)
+	}
+}
+
+func TestKernels_NamedFloatTypes(t *testing.T) {
+	type score32 float32
+
+	type score64 float64
+
+	a, b := randVectors(100)
+	a32, b32 := make([]score32, len(a)), make([]score32, len(b))
+	a64, b64 := make([]score64, len(a)), make([]score64, len(b))
+
+	for i := range a {
+		a32[i], b32[i] = score32(a[i]), score32(b[i])
+		a64[i], b64[i] = score64(a[i]), score64(b[i])
+	}
+
+	assertKernel(t, "VectorDotProduct[score32]", len(a), VectorDotProduct(a32, b32), referenceDot(a, b), 1e-5)
+	assertKernel(t, "VectorDotProduct[score64]", len(a), VectorDotProduct(a64, b64), referenceDot(a, b), 1e-12)
+	assertKernel(t, "SquaredEuclideanDistance[score64]", len(a), SquaredEuclideanDistance(a64, b64), referenceSquaredEuclidean(a, b), 1e-12)
+}
+
+func TestVectorDotProduct_LongerTarget(t *testing.T) {
+	// the query of a MIPS index is shorter than the augmented embeddings, the remaining values must be ignored
+	base := []float64{1, 2, 3}
+	target := []float64{4, 5, 6, 100}
+
+	if got := VectorDotProduct(base, target); got != 32 {
+		t.Fatalf("got %v, expected 32", got)
+	}
+
+	if got := VectorDotProduct(nil, target); got != 0 {
+		t.Fatalf("got %v, expected 0", got)
+	}
+}
+
+// benchmarkDims are the dimensions of common embedding models
+var benchmarkDims = []int{16, 128, 768, 1536}
+
+func BenchmarkVectorDotProduct(b *testing.B) {
+	for _, dim := range benchmarkDims {
+		v1, v2 := randVectors(dim)
+
+		b.Run(fmt.Sprintf("generic-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dotGeneric(v1, v2)
+			}
+		})
+
+		b.Run(fmt.Sprintf("dispatched-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				VectorDotProduct(v1, v2)
+			}
+		})
+	}
+}
+
+func BenchmarkSquaredEuclideanDistance(b *testing.B) {
+	for _, dim := range benchmarkDims {
+		v1, v2 := randVectors(dim)
+
+		b.Run(fmt.Sprintf("generic-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				squaredEuclideanGeneric(v1, v2)
+			}
+		})
+
+		b.Run(fmt.Sprintf("dispatched-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				SquaredEuclideanDistance(v1, v2)
+			}
+		})
+	}
+}
+
+func BenchmarkVectorDotProduct_Float32(b *testing.B) {
+	for _, dim := range benchmarkDims {
+		v1, v2 := randVectors(dim)
+		a, c := toFloat32(v1), toFloat32(v2)
+
+		b.Run(fmt.Sprintf("generic-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dot32Generic(a, c)
+			}
+		})
+
+		b.Run(fmt.Sprintf("dispatched-%d", dim), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				VectorDotProduct(a, c)
+			}
+		})
+	}
+}
@@ -18,11 +18,24 @@ func Min[T constraints.Ordered](a, b T) T {
 	return b
 }
 
-func VectorDotProduct(base, target []float64) float64 {
-	var ret float64
-	for i := range base {
-		ret += base[i] * target[i]
+func VectorsEqual[F constraints.Float](a, b []F) bool {
+	if len(a) != len(b) {
+		return false
 	}
 
-	return ret
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func Abs[T constraints.Signed | constraints.Float](a T) T {
+	if a < 0 {
+		return -a
+	}
+
+	return a
 }
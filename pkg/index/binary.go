@@ -0,0 +1,486 @@
+package index
+
+import (
+	"container/heap"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"sync"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+// number of random bit positions evaluated per split, the one dividing the data points most evenly is used
+const binarySplitCandidates = 16
+
+// BinaryDataPoint is a data point whose embedding is a packed bit vector, bit i is stored in Code[i/64] at position i%64.
+type BinaryDataPoint[T comparable] struct {
+	ID         T
+	Code       []uint64
+	Attributes Attributes
+}
+
+// BinarySearchResult is a search result of BinaryIndex, results are ordered by increasing Distance.
+type BinarySearchResult[T comparable] struct {
+	ID       T
+	Distance float64
+	// Score is the negated Distance, so larger scores mean more similar codes like for the other search results
+	Score float64
+	Code  []uint64
+}
+
+func NewBinaryDataPoint[T comparable](id T, code []uint64) *BinaryDataPoint[T] {
+	return &BinaryDataPoint[T]{ID: id, Code: code}
+}
+
+// BinaryDistanceMeasure is the counterpart of DistanceMeasure for packed bit vectors.
+type BinaryDistanceMeasure interface {
+	CalcDistance(c1, c2 []uint64) float64
+}
+
+type hammingDistanceMeasure struct{}
+
+// NewHammingDistanceMeasure returns a measure counting the bits that differ between two codes.
+func NewHammingDistanceMeasure() BinaryDistanceMeasure {
+	return &hammingDistanceMeasure{}
+}
+
+func (hdm *hammingDistanceMeasure) CalcDistance(c1, c2 []uint64) float64 {
+	if len(c1) != len(c2) {
+		return 0.0
+	}
+
+	distance := 0
+	for i := range c1 {
+		distance += bits.OnesCount64(c1[i] ^ c2[i])
+	}
+
+	return float64(distance)
+}
+
+// BinarizeEmbedding packs an embedding into a code, setting the bits of all positive dimensions.
+func BinarizeEmbedding[F Float](embedding []F) []uint64 {
+	code := make([]uint64, codeLength(len(embedding)))
+
+	for i, v := range embedding {
+		if v > 0 {
+			code[i/64] |= 1 << (i % 64)
+		}
+	}
+
+	return code
+}
+
+func codeLength(numberOfBits int) int {
+	return (numberOfBits + 63) / 64
+}
+
+func bitAt(code []uint64, position int) bool {
+	return code[position/64]&(1<<(position%64)) != 0
+}
+
+// BinaryIndex is an approximate index for packed bit vectors.
+// Every tree splits the data points on a bit position, data points with the bit set belong to the right subtree.
+// The number of split bits in which a query differs from the path to a leaf is a lower bound of its distance to the leaf's items,
+// leaves are searched in the order of this bound.
+type BinaryIndex[T comparable] struct {
+	NumberOfRoots        int
+	NumberOfBits         int
+	MaxItemsPerLeafNode  int
+	Roots                []*binaryTreeNode[T]
+	IDToDataPointMapping map[T]*BinaryDataPoint[T]
+	DataPoints           []*BinaryDataPoint[T]
+	DistanceMeasure      BinaryDistanceMeasure
+}
+
+type binaryTreeNode[T comparable] struct {
+	index *BinaryIndex[T]
+	// bit position the node splits on
+	bit int
+
+	// if both, left and right are nil, the node represents a leaf node
+	left  *binaryTreeNode[T]
+	right *binaryTreeNode[T]
+
+	items []T
+}
+
+func NewBinaryIndex[T comparable](numberOfRoots int, numberOfBits int, maxItemsPerLeafNode int, dataPoints []*BinaryDataPoint[T], distanceMeasure BinaryDistanceMeasure) (*BinaryIndex[T], error) {
+	if numberOfBits <= 0 {
+		return nil, fmt.Errorf("%w: the number of bits must be positive", errInvalidParameter)
+	}
+
+	idToDataPointMapping := make(map[T]*BinaryDataPoint[T], len(dataPoints))
+
+	for _, dp := range dataPoints {
+		if len(dp.Code) != codeLength(numberOfBits) {
+			return nil, errShapeMismatch
+		}
+
+		idToDataPointMapping[dp.ID] = dp
+	}
+
+	return &BinaryIndex[T]{
+		NumberOfRoots:        numberOfRoots,
+		NumberOfBits:         numberOfBits,
+		MaxItemsPerLeafNode:  maxItemsPerLeafNode,
+		Roots:                make([]*binaryTreeNode[T], numberOfRoots),
+		IDToDataPointMapping: idToDataPointMapping,
+		DataPoints:           dataPoints,
+		DistanceMeasure:      distanceMeasure,
+	}, nil
+}
+
+func (bi *BinaryIndex[T]) Build() {
+	var wg sync.WaitGroup
+
+	wg.Add(bi.NumberOfRoots)
+
+	for i := range bi.Roots {
+		rootNode := &binaryTreeNode[T]{index: bi}
+		bi.Roots[i] = rootNode
+
+		go func() {
+			defer wg.Done()
+			rootNode.build(bi.DataPoints)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// AddDataPoint inserts a new data point into all trees of the index.
+// Returns ErrDataPointExists if the ID is already indexed.
+func (bi *BinaryIndex[T]) AddDataPoint(dataPoint *BinaryDataPoint[T]) error {
+	if len(dataPoint.Code) != codeLength(bi.NumberOfBits) {
+		return errShapeMismatch
+	}
+
+	if !bi.built() {
+		return errIndexNotBuilt
+	}
+
+	if _, ok := bi.IDToDataPointMapping[dataPoint.ID]; ok {
+		return fmt.Errorf("%w: %v", ErrDataPointExists, dataPoint.ID)
+	}
+
+	bi.DataPoints = append(bi.DataPoints, dataPoint)
+	bi.IDToDataPointMapping[dataPoint.ID] = dataPoint
+
+	for _, rootNode := range bi.Roots {
+		rootNode.insert(dataPoint)
+	}
+
+	return nil
+}
+
+// DeleteDataPoint removes the data point with the given ID from the index and all of its trees.
+func (bi *BinaryIndex[T]) DeleteDataPoint(id T) error {
+	if !bi.built() {
+		return errIndexNotBuilt
+	}
+
+	dataPoint, ok := bi.IDToDataPointMapping[id]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	for _, rootNode := range bi.Roots {
+		rootNode.remove(dataPoint)
+	}
+
+	delete(bi.IDToDataPointMapping, id)
+
+	for i, dp := range bi.DataPoints {
+		if dp.ID != id {
+			continue
+		}
+
+		copy(bi.DataPoints[i:], bi.DataPoints[i+1:])
+		bi.DataPoints[len(bi.DataPoints)-1] = nil
+		bi.DataPoints = bi.DataPoints[:len(bi.DataPoints)-1]
+
+		break
+	}
+
+	return nil
+}
+
+// built reports whether the trees of all roots have been created by Build.
+func (bi *BinaryIndex[T]) built() bool {
+	for _, root := range bi.Roots {
+		if root == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SearchByCode returns the searchNum nearest neighbours of code.
+// numberOfBuckets controls how many candidates (searchNum * numberOfBuckets) are collected from the trees before they are ranked.
+// The search stops early once no unvisited leaf can contain a closer data point, the results are exact in this case.
+// nolint: funlen, cyclop
+func (bi *BinaryIndex[T]) SearchByCode(code []uint64, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]BinarySearchResult[T], error) {
+	if len(code) != codeLength(bi.NumberOfBits) {
+		return nil, errShapeMismatch
+	}
+
+	options := newSearchOptions(opts)
+	totalBucketSize := int(float64(searchNum) * numberOfBuckets)
+	idToDist := map[T]float64{}
+	rejected := map[T]struct{}{}
+	ann := []T{}
+	// the number of differing split bits only bounds the hamming distance
+	_, bounded := bi.DistanceMeasure.(*hammingDistanceMeasure)
+
+	pq := priorityQueue[*binaryTreeNode[T]]{}
+
+	for i, r := range bi.Roots {
+		if r == nil {
+			return nil, errIndexNotBuilt
+		}
+
+		pq = append(pq, &queueItem[*binaryTreeNode[T]]{r, i, 0})
+	}
+
+	heap.Init(&pq)
+
+	// distances of the best candidates found so far, the largest first
+	best := &distanceHeap{}
+
+	for pq.Len() > 0 && len(idToDist) < totalBucketSize {
+		q, _ := heap.Pop(&pq).(*queueItem[*binaryTreeNode[T]])
+		n := q.value
+
+		if bounded && best.Len() > 0 && best.Len() == searchNum && q.priority >= (*best)[0] {
+			// the remaining leaves can't contain closer data points
+			break
+		}
+
+		if n.isLeaf() {
+			for _, id := range n.items {
+				if _, ok := idToDist[id]; ok {
+					continue
+				}
+
+				if _, ok := rejected[id]; ok {
+					continue
+				}
+
+				dp := bi.IDToDataPointMapping[id]
+				if options.filter != nil && !options.filter.Match(dp.Attributes) {
+					rejected[id] = struct{}{}
+
+					continue
+				}
+
+				dist := bi.DistanceMeasure.CalcDistance(dp.Code, code)
+				idToDist[id] = dist
+				ann = append(ann, id)
+
+				switch {
+				case best.Len() < searchNum:
+					heap.Push(best, dist)
+				case dist < (*best)[0]:
+					(*best)[0] = dist
+					heap.Fix(best, 0)
+				}
+			}
+
+			continue
+		}
+
+		// following the branch the query doesn't belong to costs at least one differing bit
+		left, right := q.priority+1, q.priority
+		if !bitAt(code, n.bit) {
+			left, right = q.priority, q.priority+1
+		}
+
+		heap.Push(&pq, &queueItem[*binaryTreeNode[T]]{value: n.left, priority: left})
+		heap.Push(&pq, &queueItem[*binaryTreeNode[T]]{value: n.right, priority: right})
+	}
+
+	sort.Slice(ann, func(i, j int) bool {
+		return idToDist[ann[i]] < idToDist[ann[j]]
+	})
+
+	if len(ann) > searchNum {
+		ann = ann[:searchNum]
+	}
+
+	searchResults := make([]BinarySearchResult[T], len(ann))
+	for i, id := range ann {
+		searchResults[i] = BinarySearchResult[T]{ID: id, Distance: idToDist[id], Score: -idToDist[id], Code: bi.IDToDataPointMapping[id].Code}
+	}
+
+	return &searchResults, nil
+}
+
+// SearchByItem returns the nearest neighbours of a data point that is already part of the index.
+// The queried item itself is not included in the results.
+func (bi *BinaryIndex[T]) SearchByItem(id T, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]BinarySearchResult[T], error) {
+	dp, ok := bi.IDToDataPointMapping[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	// search for one additional item since the queried item will most likely be part of the results
+	results, err := bi.SearchByCode(dp.Code, searchNum+1, numberOfBuckets, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	searchResults := make([]BinarySearchResult[T], 0, len(*results))
+
+	for _, r := range *results {
+		if r.ID != id && len(searchResults) < searchNum {
+			searchResults = append(searchResults, r)
+		}
+	}
+
+	return &searchResults, nil
+}
+
+func (node *binaryTreeNode[T]) build(dataPoints []*BinaryDataPoint[T]) {
+	node.left, node.right = nil, nil
+	node.items = make([]T, len(dataPoints))
+
+	for i, dp := range dataPoints {
+		node.items[i] = dp.ID
+	}
+
+	if len(dataPoints) <= node.index.MaxItemsPerLeafNode {
+		return
+	}
+
+	bit, ok := node.index.splitBit(dataPoints)
+	if !ok {
+		// all evaluated bits are equal for the data points, keep the oversized leaf
+		return
+	}
+
+	leftDataPoints := []*BinaryDataPoint[T]{}
+	rightDataPoints := []*BinaryDataPoint[T]{}
+
+	for _, dp := range dataPoints {
+		if bitAt(dp.Code, bit) {
+			rightDataPoints = append(rightDataPoints, dp)
+		} else {
+			leftDataPoints = append(leftDataPoints, dp)
+		}
+	}
+
+	node.bit = bit
+	node.items = nil
+	node.left = &binaryTreeNode[T]{index: node.index}
+	node.left.build(leftDataPoints)
+	node.right = &binaryTreeNode[T]{index: node.index}
+	node.right.build(rightDataPoints)
+}
+
+// splitBit returns the random bit position that divides the data points most evenly.
+// Returns false if none of the evaluated positions separates the data points.
+// nolint: gosec
+func (bi *BinaryIndex[T]) splitBit(dataPoints []*BinaryDataPoint[T]) (int, bool) {
+	bestBit, bestBalance := 0, len(dataPoints)
+
+	for i := 0; i < binarySplitCandidates; i++ {
+		bit := rand.Intn(bi.NumberOfBits)
+
+		ones := 0
+		for _, dp := range dataPoints {
+			if bitAt(dp.Code, bit) {
+				ones++
+			}
+		}
+
+		if balance := imath.Abs(2*ones - len(dataPoints)); balance < bestBalance {
+			bestBit, bestBalance = bit, balance
+		}
+	}
+
+	return bestBit, bestBalance < len(dataPoints)
+}
+
+func (node *binaryTreeNode[T]) insert(dataPoint *BinaryDataPoint[T]) {
+	leaf := node.findLeaf(dataPoint.Code)
+	leaf.items = append(leaf.items, dataPoint.ID)
+
+	if len(leaf.items) <= leaf.index.MaxItemsPerLeafNode {
+		return
+	}
+
+	// the leaf overflowed, split it into two new nodes
+	items := make([]*BinaryDataPoint[T], len(leaf.items))
+	for i := range items {
+		items[i] = node.index.IDToDataPointMapping[leaf.items[i]]
+	}
+
+	leaf.build(items)
+}
+
+func (node *binaryTreeNode[T]) findLeaf(code []uint64) *binaryTreeNode[T] {
+	if node.isLeaf() {
+		return node
+	}
+
+	if bitAt(code, node.bit) {
+		return node.right.findLeaf(code)
+	}
+
+	return node.left.findLeaf(code)
+}
+
+// remove deletes the data point from the subtree and merges children that fit into a single leaf.
+func (node *binaryTreeNode[T]) remove(dataPoint *BinaryDataPoint[T]) {
+	if node.isLeaf() {
+		for i, id := range node.items {
+			if id == dataPoint.ID {
+				node.items = append(node.items[:i], node.items[i+1:]...)
+
+				return
+			}
+		}
+
+		return
+	}
+
+	if bitAt(dataPoint.Code, node.bit) {
+		node.right.remove(dataPoint)
+	} else {
+		node.left.remove(dataPoint)
+	}
+
+	if node.left.isLeaf() && node.right.isLeaf() && len(node.left.items)+len(node.right.items) <= node.index.MaxItemsPerLeafNode {
+		node.items = append(node.left.items, node.right.items...)
+		node.left, node.right = nil, nil
+	}
+}
+
+func (node *binaryTreeNode[T]) isLeaf() bool {
+	return node.left == nil && node.right == nil
+}
+
+// distanceHeap is a max-heap of distances.
+type distanceHeap []float64
+
+func (h distanceHeap) Len() int { return len(h) }
+
+func (h distanceHeap) Less(i, j int) bool { return h[i] > h[j] }
+
+func (h distanceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *distanceHeap) Push(x interface{}) {
+	d, _ := x.(float64)
+	*h = append(*h, d)
+}
+
+func (h *distanceHeap) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return d
+}
@@ -0,0 +1,247 @@
+package index
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestHammingDistance_CalcDistance(t *testing.T) {
+	distanceMeasure := NewHammingDistanceMeasure()
+
+	assert.Equal(t, 0.0, distanceMeasure.CalcDistance([]uint64{0b1011}, []uint64{0b1011}))
+	assert.Equal(t, 2.0, distanceMeasure.CalcDistance([]uint64{0b1011}, []uint64{0b0001}))
+	assert.Equal(t, 65.0, distanceMeasure.CalcDistance([]uint64{0, 1}, []uint64{^uint64(0), 0}))
+}
+
+func TestBinarizeEmbedding(t *testing.T) {
+	embedding := make([]float64, 70)
+	embedding[0] = 0.5
+	embedding[1] = -0.5
+	embedding[69] = 1
+
+	assert.Equal(t, []uint64{1, 1 << 5}, BinarizeEmbedding(embedding))
+}
+
+func randCode(numberOfBits int) []uint64 {
+	code := make([]uint64, codeLength(numberOfBits))
+	for i := range code {
+		code[i] = rand.Uint64()
+	}
+
+	if rest := numberOfBits % 64; rest != 0 {
+		code[len(code)-1] &= 1<<rest - 1
+	}
+
+	return code
+}
+
+// nolint: funlen, cyclop
+func TestBinaryIndex_SearchByCode(t *testing.T) {
+	rawItems := make([]*BinaryDataPoint[int], 5000)
+	for i := range rawItems {
+		rawItems[i] = NewBinaryDataPoint(i, randCode(100))
+		rawItems[i].Attributes = Attributes{"even": i%2 == 0}
+	}
+
+	if _, err := NewBinaryIndex(5, 200, 10, rawItems, NewHammingDistanceMeasure()); !errors.Is(err, errShapeMismatch) {
+		t.Fatalf("expected errShapeMismatch, got %v", err)
+	}
+
+	idx, err := NewBinaryIndex(5, 100, 10, rawItems, NewHammingDistanceMeasure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	query := randCode(100)
+
+	// exact neighbors
+	ids := []int{}
+	for i := range rawItems {
+		if i%2 == 0 {
+			ids = append(ids, i)
+		}
+	}
+
+	dist := func(id int) float64 { return idx.DistanceMeasure.CalcDistance(rawItems[id].Code, query) }
+	sort.Slice(ids, func(i, j int) bool { return dist(ids[i]) < dist(ids[j]) })
+
+	// an unlimited number of candidates makes the search exact
+	ass, err := idx.SearchByCode(query, 10, float64(len(rawItems)), WithFilter(Eq("even", true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 10 {
+		t.Fatalf("expected 10 results, got %d", len(*ass))
+	}
+
+	for j, res := range *ass {
+		if res.ID%2 != 0 {
+			t.Fatalf("result %d does not match the filter", res.ID)
+		}
+
+		assert.Equal(t, dist(ids[j]), res.Distance)
+		assert.Equal(t, -res.Distance, res.Score)
+	}
+
+	if err := idx.AddDataPoint(NewBinaryDataPoint(0, randCode(100))); !errors.Is(err, ErrDataPointExists) {
+		t.Fatalf("expected ErrDataPointExists, got %v", err)
+	}
+
+	// a copy of the query with one flipped bit has to be found
+	near := append([]uint64{}, query...)
+	near[0] ^= 1
+
+	for i := 0; i < 100; i++ {
+		if err := idx.AddDataPoint(NewBinaryDataPoint(5000+i, randCode(100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := idx.AddDataPoint(NewBinaryDataPoint(-1, near)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the flipped bit might be a split bit, so leaves of the other trees are needed
+	ass, err = idx.SearchByCode(query, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 1 || (*ass)[0].ID != -1 || (*ass)[0].Distance != 1 {
+		t.Fatalf("expected the added item -1 at distance 1, got %v", *ass)
+	}
+
+	if err := idx.DeleteDataPoint(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.DeleteDataPoint(-1); !errors.Is(err, ErrDataPointNotFound) {
+		t.Fatalf("expected ErrDataPointNotFound, got %v", err)
+	}
+
+	ass, err = idx.SearchByItem(0, 5, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, res := range *ass {
+		if res.ID == -1 || res.ID == 0 {
+			t.Fatalf("unexpected item %d in the results", res.ID)
+		}
+	}
+
+	for _, root := range idx.Roots {
+		count := 0
+
+		var walk func(n *binaryTreeNode[int])
+		walk = func(n *binaryTreeNode[int]) {
+			if n.isLeaf() {
+				count += len(n.items)
+
+				return
+			}
+
+			walk(n.left)
+			walk(n.right)
+		}
+		walk(root)
+
+		assert.Equal(t, len(idx.DataPoints), count)
+	}
+}
+
+// nolint: funlen, cyclop
+func TestBinaryIndex_Modifications(t *testing.T) {
+	if _, err := NewBinaryIndex[int](2, 0, 10, nil, NewHammingDistanceMeasure()); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	rawItems := make([]*BinaryDataPoint[int], 1000)
+	for i := range rawItems {
+		rawItems[i] = NewBinaryDataPoint(i, randCode(64))
+	}
+
+	idx, err := NewBinaryIndex(3, 64, 5, rawItems, NewHammingDistanceMeasure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddDataPoint(NewBinaryDataPoint(1000, randCode(64))); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+
+	if err := idx.DeleteDataPoint(0); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+
+	if _, err := idx.SearchByCode(randCode(64), 1, DefaultBuckets); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+
+	idx.Build()
+
+	if err := idx.AddDataPoint(NewBinaryDataPoint(1000, randCode(128))); !errors.Is(err, errShapeMismatch) {
+		t.Fatalf("expected errShapeMismatch, got %v", err)
+	}
+
+	// delete most of the items, the trees merge the emptied leaves
+	for id := 0; id < 900; id++ {
+		if err := idx.DeleteDataPoint(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for id := 1000; id < 1100; id++ {
+		if err := idx.AddDataPoint(NewBinaryDataPoint(id, randCode(64))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(idx.DataPoints) != 200 || len(idx.IDToDataPointMapping) != 200 {
+		t.Fatalf("expected 200 data points, got %d and %d", len(idx.DataPoints), len(idx.IDToDataPointMapping))
+	}
+
+	for _, root := range idx.Roots {
+		items := map[int]int{}
+
+		var walk func(n *binaryTreeNode[int])
+		walk = func(n *binaryTreeNode[int]) {
+			if n.isLeaf() {
+				for _, id := range n.items {
+					items[id]++
+				}
+
+				return
+			}
+
+			walk(n.left)
+			walk(n.right)
+		}
+		walk(root)
+
+		if len(items) != 200 {
+			t.Fatalf("expected 200 items in the tree, got %d", len(items))
+		}
+
+		for id, count := range items {
+			if _, ok := idx.IDToDataPointMapping[id]; !ok || count != 1 {
+				t.Fatalf("expected item %d to be indexed once, got %d", id, count)
+			}
+		}
+	}
+
+	ass, err := idx.SearchByCode(randCode(64), 200, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 200 {
+		t.Fatalf("expected all 200 data points, got %d", len(*ass))
+	}
+}
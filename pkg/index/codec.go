@@ -0,0 +1,97 @@
+package index
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// IDCodec encodes and decodes the identifiers of data points when an index is persisted.
+type IDCodec[T comparable] interface {
+	EncodeID(w io.Writer, id T) error
+	DecodeID(r io.Reader) (T, error)
+}
+
+type intCodec struct{}
+
+// NewIntCodec returns a codec for int identifiers, which are stored as 64 bit integers.
+func NewIntCodec() IDCodec[int] {
+	return &intCodec{}
+}
+
+func (c *intCodec) EncodeID(w io.Writer, id int) error {
+	return binary.Write(w, binary.LittleEndian, int64(id))
+}
+
+func (c *intCodec) DecodeID(r io.Reader) (int, error) {
+	var id int64
+	if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+type stringCodec struct{}
+
+// NewStringCodec returns a codec for string identifiers, which are stored with a length prefix.
+func NewStringCodec() IDCodec[string] {
+	return &stringCodec{}
+}
+
+func (c *stringCodec) EncodeID(w io.Writer, id string) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(id))); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, id)
+
+	return err
+}
+
+func (c *stringCodec) DecodeID(r io.Reader) (string, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+
+	buf, err := readBytes(r, n)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+// readBytes reads exactly n bytes. The buffer grows while the bytes are read,
+// so a corrupt length fails once the input ends instead of allocating it upfront.
+func readBytes(r io.Reader, n uint32) ([]byte, error) {
+	buf, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) != int(n) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return buf, nil
+}
+
+type fixedSizeCodec[T comparable] struct{}
+
+// NewFixedSizeCodec returns a codec for fixed-size identifiers as supported by encoding/binary,
+// e.g. int64, uint32 or arrays and structs that only consist of fixed-size fields.
+func NewFixedSizeCodec[T comparable]() IDCodec[T] {
+	return &fixedSizeCodec[T]{}
+}
+
+func (c *fixedSizeCodec[T]) EncodeID(w io.Writer, id T) error {
+	return binary.Write(w, binary.LittleEndian, id)
+}
+
+func (c *fixedSizeCodec[T]) DecodeID(r io.Reader) (T, error) {
+	var id T
+	err := binary.Read(r, binary.LittleEndian, &id)
+
+	return id, err
+}
@@ -0,0 +1,38 @@
+package index
+
+import "context"
+
+// contextCheckInterval defines how many calls to contextChecker.err are needed until the context is actually checked.
+const contextCheckInterval = 64
+
+// contextChecker polls the context only every contextCheckInterval calls, since checking the context
+// on every step of the search is expensive compared to a single distance calculation.
+type contextChecker struct {
+	ctx   context.Context
+	calls int
+	// done is set once the context reported an error
+	done bool
+}
+
+func newContextChecker(ctx context.Context) *contextChecker {
+	return &contextChecker{ctx: ctx}
+}
+
+func (c *contextChecker) err() error {
+	// contexts that can never be canceled don't need to be checked at all
+	if c.ctx.Done() == nil {
+		return nil
+	}
+
+	c.calls++
+	if c.calls%contextCheckInterval != 1 {
+		return nil
+	}
+
+	err := c.ctx.Err()
+	if err != nil {
+		c.done = true
+	}
+
+	return err
+}
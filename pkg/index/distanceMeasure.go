@@ -1,61 +1,289 @@
 package index
 
-import "math"
+import (
+	"fmt"
+	"math"
 
-type DistanceMeasure interface {
-	CalcDistance(v1, v2 []float64) float64
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+	"golang.org/x/exp/constraints"
+)
+
+// Float is the element type of the embeddings, float32 halves the memory needed for the embeddings compared to float64.
+type Float interface {
+	constraints.Float
+}
+
+// DistanceMeasure calculates the distance between two embeddings with elements of type F.
+// The distances are float64 for both element types.
+type DistanceMeasure[F Float] interface {
+	CalcDistance(v1, v2 []F) float64
+}
+
+// ScoredDistanceMeasure is implemented by distance measures that define how the values returned by CalcDistance
+// relate to a distance and a similarity. All distance measures of this package implement it,
+// the indexes use it to fill the Distance and the Score of their search results.
+type ScoredDistanceMeasure[F Float] interface {
+	DistanceMeasure[F]
+	// Distance converts a value returned by CalcDistance into a distance, which grows with the dissimilarity
+	// of the vectors and is 0 for identical vectors. The inner product is the only exception, its distance can be negative.
+	Distance(value float64) float64
+	// Similarity converts a value returned by CalcDistance into a score, larger scores mean more similar vectors.
+	Similarity(value float64) float64
+	// PreNormalize reports whether the measure only depends on the direction of the vectors,
+	// so embeddings can be L2 normalized before they are added to an index without changing the results.
+	PreNormalize() bool
 }
 
-type cosineDistanceMeasure struct{}
+// distanceAndScore converts a value calculated by the distance measure into the Distance and the Score of a search result.
+// Measures that don't implement ScoredDistanceMeasure report the value as distance and its negation as score.
+func distanceAndScore[F Float](distanceMeasure DistanceMeasure[F], value float64) (float64, float64) {
+	scored, ok := distanceMeasure.(ScoredDistanceMeasure[F])
+	if !ok {
+		return value, -value
+	}
 
-func NewCosineDistanceMeasure() DistanceMeasure {
-	return &cosineDistanceMeasure{}
+	return scored.Distance(value), scored.Similarity(value)
 }
 
-func (cdm *cosineDistanceMeasure) CalcDistance(v1, v2 []float64) float64 {
+// metricConversion implements the conversions of measures whose values already are distances.
+// The similarity 1 / (1 + distance) is 1 for identical vectors and approaches 0 for distant ones.
+type metricConversion struct{}
+
+func (metricConversion) Distance(value float64) float64 {
+	return value
+}
+
+func (metricConversion) Similarity(value float64) float64 {
+	return 1 / (1 + value)
+}
+
+func (metricConversion) PreNormalize() bool {
+	return false
+}
+
+type cosineDistanceMeasure[F Float] struct{}
+
+func NewCosineDistanceMeasure[F Float]() DistanceMeasure[F] {
+	return &cosineDistanceMeasure[F]{}
+}
+
+func (cdm *cosineDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
 	// calculates the cosine distance between two vectors
 	if len(v1) != len(v2) || len(v1) == 0 {
 		return 0.0
 	}
 
-	dotProduct := 0.0
-	magA := 0.0
-	magB := 0.0
+	dotProduct := imath.VectorDotProduct(v1, v2)
+	magA := math.Sqrt(imath.VectorDotProduct(v1, v1))
+	magB := math.Sqrt(imath.VectorDotProduct(v2, v2))
 
-	for i := 0; i < len(v1); i++ {
-		dotProduct += v1[i] * v2[i]
-		magA += v1[i] * v1[i]
-		magB += v2[i] * v2[i]
+	if magA == 0 || magB == 0 {
+		return 0.0
 	}
 
-	magA = math.Sqrt(magA)
-	magB = math.Sqrt(magB)
+	return -dotProduct / (magA * magB)
+}
 
-	if magA == 0 || magB == 0 {
+// Distance returns the cosine distance 1 - cos, which lies in [0, 2].
+func (cdm *cosineDistanceMeasure[F]) Distance(value float64) float64 {
+	return 1 + value
+}
+
+// Similarity returns the cosine similarity.
+func (cdm *cosineDistanceMeasure[F]) Similarity(value float64) float64 {
+	return -value
+}
+
+func (cdm *cosineDistanceMeasure[F]) PreNormalize() bool {
+	return true
+}
+
+// unitCosineDistanceMeasure calculates the cosine distance of L2 normalized vectors, which is their negative dot product.
+// It is used by indexes that normalize their embeddings, see WithNormalization.
+type unitCosineDistanceMeasure[F Float] struct {
+	cosineDistanceMeasure[F]
+}
+
+func (ucdm *unitCosineDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
+	// calculates the negative dot product of two normalized vectors
+	if len(v1) != len(v2) || len(v1) == 0 {
 		return 0.0
 	}
 
-	return -dotProduct / (magA * magB)
+	return -imath.VectorDotProduct(v1, v2)
 }
 
-type euclideanDistanceMeasure struct{}
+type euclideanDistanceMeasure[F Float] struct {
+	metricConversion
+}
 
-func NewEuclideanDistanceMeasure() DistanceMeasure {
-	return &euclideanDistanceMeasure{}
+func NewEuclideanDistanceMeasure[F Float]() DistanceMeasure[F] {
+	return &euclideanDistanceMeasure[F]{}
 }
 
-func (cdm *euclideanDistanceMeasure) CalcDistance(v1, v2 []float64) float64 {
+func (cdm *euclideanDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
 	// calculates the euclidean distance between two vectors
 	if len(v1) != len(v2) || len(v1) == 0 {
 		return 0.0
 	}
 
+	return math.Sqrt(imath.SquaredEuclideanDistance(v1, v2))
+}
+
+type innerProductDistanceMeasure[F Float] struct{}
+
+// NewInnerProductDistanceMeasure returns a measure for maximum inner product search, the distance is the negative dot product.
+// Unlike cosine, the magnitude of the vectors matters, so it is suited for un-normalized embeddings.
+// VectorIndex builds its trees on transformed embeddings to keep the splits meaningful for this measure, see VectorIndex.Build.
+func NewInnerProductDistanceMeasure[F Float]() DistanceMeasure[F] {
+	return &innerProductDistanceMeasure[F]{}
+}
+
+func (ipdm *innerProductDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
+	// calculates the negative inner product of two vectors
+	if len(v1) != len(v2) || len(v1) == 0 {
+		return 0.0
+	}
+
+	return -imath.VectorDotProduct(v1, v2)
+}
+
+// Distance returns the negative inner product.
+func (ipdm *innerProductDistanceMeasure[F]) Distance(value float64) float64 {
+	return value
+}
+
+// Similarity returns the inner product.
+func (ipdm *innerProductDistanceMeasure[F]) Similarity(value float64) float64 {
+	return -value
+}
+
+func (ipdm *innerProductDistanceMeasure[F]) PreNormalize() bool {
+	return false
+}
+
+type manhattanDistanceMeasure[F Float] struct {
+	metricConversion
+}
+
+// NewManhattanDistanceMeasure returns the L1 distance, the sum of the absolute differences of all dimensions.
+func NewManhattanDistanceMeasure[F Float]() DistanceMeasure[F] {
+	return &manhattanDistanceMeasure[F]{}
+}
+
+func (mdm *manhattanDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
+	// calculates the manhattan distance between two vectors
+	if len(v1) != len(v2) || len(v1) == 0 {
+		return 0.0
+	}
+
+	sum := 0.0
+
+	for i := 0; i < len(v1); i++ {
+		sum += math.Abs(float64(v1[i]) - float64(v2[i]))
+	}
+
+	return sum
+}
+
+type chebyshevDistanceMeasure[F Float] struct {
+	metricConversion
+}
+
+// NewChebyshevDistanceMeasure returns the L∞ distance, the largest absolute difference of all dimensions.
+func NewChebyshevDistanceMeasure[F Float]() DistanceMeasure[F] {
+	return &chebyshevDistanceMeasure[F]{}
+}
+
+func (cdm *chebyshevDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
+	// calculates the chebyshev distance between two vectors
+	if len(v1) != len(v2) || len(v1) == 0 {
+		return 0.0
+	}
+
+	largest := 0.0
+
+	for i := 0; i < len(v1); i++ {
+		largest = math.Max(largest, math.Abs(float64(v1[i])-float64(v2[i])))
+	}
+
+	return largest
+}
+
+type minkowskiDistanceMeasure[F Float] struct {
+	metricConversion
+	p float64
+}
+
+// NewMinkowskiDistanceMeasure returns the Lp distance (sum |v1_i - v2_i|^p)^(1/p).
+// p = 1 equals the manhattan, p = 2 the euclidean and p = +Inf the chebyshev distance.
+// For p < 1 the measure violates the triangle inequality and is not a metric, the ordering of the neighbours is still well-defined.
+func NewMinkowskiDistanceMeasure[F Float](p float64) (DistanceMeasure[F], error) {
+	if math.IsNaN(p) || p <= 0 {
+		return nil, fmt.Errorf("%w: the exponent p must be positive", errInvalidParameter)
+	}
+
+	return &minkowskiDistanceMeasure[F]{p: p}, nil
+}
+
+func (mdm *minkowskiDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
+	// calculates the minkowski distance between two vectors
+	if len(v1) != len(v2) || len(v1) == 0 {
+		return 0.0
+	}
+
+	if math.IsInf(mdm.p, 1) {
+		return (&chebyshevDistanceMeasure[F]{}).CalcDistance(v1, v2)
+	}
+
 	sum := 0.0
 
 	for i := 0; i < len(v1); i++ {
-		diff := v1[i] - v2[i]
-		sum += diff * diff
+		sum += math.Pow(math.Abs(float64(v1[i])-float64(v2[i])), mdm.p)
+	}
+
+	return math.Pow(sum, 1/mdm.p)
+}
+
+type jaccardDistanceMeasure[F Float] struct{}
+
+// NewJaccardDistanceMeasure returns the weighted jaccard distance 1 - sum min(v1_i, v2_i) / sum max(v1_i, v2_i)
+// of vectors with non-negative weights, e.g. term frequencies of a set of features.
+// Binary vectors result in the jaccard distance of the sets of dimensions with weight 1.
+func NewJaccardDistanceMeasure[F Float]() DistanceMeasure[F] {
+	return &jaccardDistanceMeasure[F]{}
+}
+
+func (jdm *jaccardDistanceMeasure[F]) CalcDistance(v1, v2 []F) float64 {
+	// calculates the weighted jaccard distance between two vectors
+	if len(v1) != len(v2) || len(v1) == 0 {
+		return 0.0
+	}
+
+	intersection := 0.0
+	union := 0.0
+
+	for i := 0; i < len(v1); i++ {
+		intersection += math.Min(float64(v1[i]), float64(v2[i]))
+		union += math.Max(float64(v1[i]), float64(v2[i]))
+	}
+
+	if union <= 0 {
+		return 0.0
 	}
 
-	return math.Sqrt(sum)
+	return 1 - intersection/union
+}
+
+func (jdm *jaccardDistanceMeasure[F]) Distance(value float64) float64 {
+	return value
+}
+
+// Similarity returns the weighted jaccard similarity.
+func (jdm *jaccardDistanceMeasure[F]) Similarity(value float64) float64 {
+	return 1 - value
+}
+
+func (jdm *jaccardDistanceMeasure[F]) PreNormalize() bool {
+	return false
 }
@@ -1,7 +1,9 @@
 package index
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"testing"
 
 	"github.com/bmizerany/assert"
@@ -32,11 +34,11 @@ func TestCosineDistance_CalcDistance(t *testing.T) {
 		c := c
 
 		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
-			dp := make([]*DataPoint[int], 2)
+			dp := make([]*DataPoint[int, float64], 2)
 			dp[0] = NewDataPoint(0, c.v1)
 			dp[1] = NewDataPoint(1, c.v2)
 
-			distanceMeasure := NewCosineDistanceMeasure()
+			distanceMeasure := NewCosineDistanceMeasure[float64]()
 			actual := distanceMeasure.CalcDistance(c.v1, c.v2)
 			itesting.AlmostEqual(t, c.exp, actual, 1e-3)
 		})
@@ -66,17 +68,25 @@ func TestEuclideanDistance_CalcDistance(t *testing.T) {
 		c := c
 
 		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
-			dp := make([]*DataPoint[int], 2)
+			dp := make([]*DataPoint[int, float64], 2)
 			dp[0] = NewDataPoint(0, c.v1)
 			dp[1] = NewDataPoint(1, c.v2)
 
-			distanceMeasure := NewEuclideanDistanceMeasure()
+			distanceMeasure := NewEuclideanDistanceMeasure[float64]()
 			actual := distanceMeasure.CalcDistance(c.v1, c.v2)
 			itesting.AlmostEqual(t, c.exp, actual, 1e-2)
 		})
 	}
 }
 
+func TestInnerProductDistance_CalcDistance(t *testing.T) {
+	distanceMeasure := NewInnerProductDistanceMeasure[float64]()
+
+	itesting.AlmostEqual(t, 1.42, distanceMeasure.CalcDistance([]float64{1.2, 0.1}, []float64{-1.2, 0.2}), 1e-9)
+	itesting.AlmostEqual(t, -10, distanceMeasure.CalcDistance([]float64{2, 0}, []float64{5, 3}), 1e-9)
+	itesting.AlmostEqual(t, 0, distanceMeasure.CalcDistance([]float64{2, 0}, []float64{5}), 1e-9)
+}
+
 // nolint: dupl
 func TestCosineDistance_CalcDirectionPriority(t *testing.T) {
 	for i, c := range []struct {
@@ -105,3 +115,117 @@ func TestCosineDistance_CalcDirectionPriority(t *testing.T) {
 		})
 	}
 }
+
+func minkowski(p float64) DistanceMeasure[float64] {
+	distanceMeasure, err := NewMinkowskiDistanceMeasure[float64](p)
+	if err != nil {
+		panic(err)
+	}
+
+	return distanceMeasure
+}
+
+func TestMinkowskiDistance_CalcDistance(t *testing.T) {
+	v1, v2 := []float64{1, -2, 0.5}, []float64{-2, 2, 0.5}
+
+	for i, c := range []struct {
+		distanceMeasure DistanceMeasure[float64]
+		exp             float64
+	}{
+		{distanceMeasure: NewManhattanDistanceMeasure[float64](), exp: 7},
+		{distanceMeasure: NewChebyshevDistanceMeasure[float64](), exp: 4},
+		{distanceMeasure: minkowski(1), exp: 7},
+		{distanceMeasure: minkowski(2), exp: 5},
+		{distanceMeasure: minkowski(3), exp: math.Cbrt(91)},
+		{distanceMeasure: minkowski(math.Inf(1)), exp: 4},
+		// not a metric, but still a dissimilarity
+		{distanceMeasure: minkowski(0.5), exp: math.Pow(math.Sqrt(3)+2, 2)},
+	} {
+		itesting.AlmostEqual(t, c.exp, c.distanceMeasure.CalcDistance(v1, v2), 1e-9)
+		itesting.AlmostEqual(t, 0, c.distanceMeasure.CalcDistance(v1, v1), 1e-9)
+		assert.Equal(t, c.distanceMeasure.CalcDistance(v1, v2), c.distanceMeasure.CalcDistance(v2, v1), fmt.Sprintf("%d-th case", i))
+	}
+
+	for _, p := range []float64{0, -1, math.NaN()} {
+		if _, err := NewMinkowskiDistanceMeasure[float64](p); !errors.Is(err, errInvalidParameter) {
+			t.Fatalf("expected errInvalidParameter for p = %f, got %v", p, err)
+		}
+	}
+}
+
+func TestJaccardDistance_CalcDistance(t *testing.T) {
+	distanceMeasure := NewJaccardDistanceMeasure[float64]()
+
+	itesting.AlmostEqual(t, 0, distanceMeasure.CalcDistance([]float64{1, 0, 2}, []float64{1, 0, 2}), 1e-9)
+	itesting.AlmostEqual(t, 1, distanceMeasure.CalcDistance([]float64{1, 0}, []float64{0, 3}), 1e-9)
+	// 1 - (1 + 1) / (2 + 3)
+	itesting.AlmostEqual(t, 0.6, distanceMeasure.CalcDistance([]float64{1, 3, 0}, []float64{2, 1, 0}), 1e-9)
+	// binary vectors result in the set based jaccard distance
+	itesting.AlmostEqual(t, 2.0/3, distanceMeasure.CalcDistance([]float64{1, 1, 0}, []float64{0, 1, 1}), 1e-9)
+	itesting.AlmostEqual(t, 0, distanceMeasure.CalcDistance([]float64{0, 0}, []float64{0, 0}), 1e-9)
+}
+
+type unscoredDistanceMeasure struct{}
+
+func (unscoredDistanceMeasure) CalcDistance(v1, v2 []float64) float64 {
+	return NewManhattanDistanceMeasure[float64]().CalcDistance(v1, v2)
+}
+
+func TestDistanceMeasure_DistanceAndScore(t *testing.T) {
+	v1, v2 := []float64{3, 4}, []float64{4, 3}
+
+	for i, c := range []struct {
+		distanceMeasure         DistanceMeasure[float64]
+		expDistance, expScore   float64
+		expPreNormalize, scored bool
+	}{
+		{distanceMeasure: NewCosineDistanceMeasure[float64](), expDistance: 1 - 0.96, expScore: 0.96, expPreNormalize: true, scored: true},
+		{distanceMeasure: NewEuclideanDistanceMeasure[float64](), expDistance: math.Sqrt2, expScore: 1 / (1 + math.Sqrt2), scored: true},
+		{distanceMeasure: NewInnerProductDistanceMeasure[float64](), expDistance: -24, expScore: 24, scored: true},
+		{distanceMeasure: NewManhattanDistanceMeasure[float64](), expDistance: 2, expScore: 1.0 / 3, scored: true},
+		{distanceMeasure: NewChebyshevDistanceMeasure[float64](), expDistance: 1, expScore: 0.5, scored: true},
+		{distanceMeasure: minkowski(1), expDistance: 2, expScore: 1.0 / 3, scored: true},
+		{distanceMeasure: NewJaccardDistanceMeasure[float64](), expDistance: 1 - 6.0/8, expScore: 6.0 / 8, scored: true},
+		// measures without conversions report the value as distance and its negation as score
+		{distanceMeasure: unscoredDistanceMeasure{}, expDistance: 2, expScore: -2},
+	} {
+		distance, score := distanceAndScore(c.distanceMeasure, c.distanceMeasure.CalcDistance(v1, v2))
+		itesting.AlmostEqual(t, c.expDistance, distance, 1e-9)
+		itesting.AlmostEqual(t, c.expScore, score, 1e-9)
+
+		scored, ok := c.distanceMeasure.(ScoredDistanceMeasure[float64])
+		assert.Equal(t, c.scored, ok, fmt.Sprintf("%d-th case", i))
+
+		if ok {
+			assert.Equal(t, c.expPreNormalize, scored.PreNormalize(), fmt.Sprintf("%d-th case", i))
+			// identical vectors have a distance of 0, except for the inner product
+			if _, ip := c.distanceMeasure.(*innerProductDistanceMeasure[float64]); !ip {
+				itesting.AlmostEqual(t, 0, scored.Distance(c.distanceMeasure.CalcDistance(v1, v1)), 1e-9)
+			}
+		}
+	}
+}
+
+// BenchmarkDistanceMeasure_CalcDistance measures the distance measures backed by the vector kernels of internal/math.
+func BenchmarkDistanceMeasure_CalcDistance(b *testing.B) {
+	const dim = 768
+
+	v1, v2 := randVec(dim), randVec(dim)
+
+	for _, c := range []struct {
+		name            string
+		distanceMeasure DistanceMeasure[float64]
+	}{
+		{name: "cosine", distanceMeasure: NewCosineDistanceMeasure[float64]()},
+		{name: "euclidean", distanceMeasure: NewEuclideanDistanceMeasure[float64]()},
+		{name: "innerProduct", distanceMeasure: NewInnerProductDistanceMeasure[float64]()},
+	} {
+		c := c
+
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.distanceMeasure.CalcDistance(v1, v2)
+			}
+		})
+	}
+}
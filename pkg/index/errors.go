@@ -3,6 +3,21 @@ package index
 import "errors"
 
 var (
-	errShapeMismatch = errors.New("not all data points match the specified dimensionality")
-	errInvalidIndex  = errors.New("invalid index")
+	errShapeMismatch    = errors.New("not all data points match the specified dimensionality")
+	errInvalidIndex     = errors.New("invalid index")
+	errInvalidParameter = errors.New("invalid parameter")
+
+	errIndexNotBuilt              = errors.New("index has not been built")
+	errIndexNotTrained            = errors.New("index has not been trained")
+	errQuantizerNotTrained        = errors.New("quantizer has not been trained")
+	errInvalidFormat              = errors.New("invalid index format")
+	errUnsupportedVersion         = errors.New("unsupported index format version")
+	errUnsupportedDistanceMeasure = errors.New("distance measure can not be persisted")
+	errUnsupportedAttribute       = errors.New("attribute type can not be persisted")
+	errUnsupportedPlatform        = errors.New("mapped index files require a little endian platform")
+
+	// ErrDataPointNotFound is returned when an operation references an ID that is not part of the index.
+	ErrDataPointNotFound = errors.New("data point not found")
+	// ErrDataPointExists is returned when adding a data point whose ID is already part of the index.
+	ErrDataPointExists = errors.New("data point already exists")
 )
@@ -0,0 +1,288 @@
+package index
+
+import "time"
+
+// Attributes holds arbitrary metadata of a data point, e.g. tenant, language or timestamps.
+// Filters support strings, bools, all integer and float types and time.Time values.
+type Attributes map[string]interface{}
+
+// Filter decides whether a data point is eligible as search result based on its attributes.
+type Filter interface {
+	Match(attributes Attributes) bool
+}
+
+// FilterFunc adapts an ordinary function to the Filter interface.
+type FilterFunc func(attributes Attributes) bool
+
+func (f FilterFunc) Match(attributes Attributes) bool {
+	return f(attributes)
+}
+
+// Eq matches data points whose attribute equals the given value.
+func Eq(key string, value interface{}) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		c, ok := compareAttribute(attributes, key, value)
+
+		return ok && c == 0
+	})
+}
+
+// In matches data points whose attribute equals one of the given values.
+func In(key string, values ...interface{}) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		for _, value := range values {
+			if c, ok := compareAttribute(attributes, key, value); ok && c == 0 {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// Gt matches data points whose attribute is greater than the given value.
+func Gt(key string, value interface{}) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		c, ok := compareAttribute(attributes, key, value)
+
+		return ok && c > 0
+	})
+}
+
+// Gte matches data points whose attribute is greater than or equal to the given value.
+func Gte(key string, value interface{}) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		c, ok := compareAttribute(attributes, key, value)
+
+		return ok && c >= 0
+	})
+}
+
+// Lt matches data points whose attribute is less than the given value.
+func Lt(key string, value interface{}) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		c, ok := compareAttribute(attributes, key, value)
+
+		return ok && c < 0
+	})
+}
+
+// Lte matches data points whose attribute is less than or equal to the given value.
+func Lte(key string, value interface{}) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		c, ok := compareAttribute(attributes, key, value)
+
+		return ok && c <= 0
+	})
+}
+
+// Range matches data points whose attribute lies within [lower, upper].
+func Range(key string, lower, upper interface{}) Filter {
+	return And(Gte(key, lower), Lte(key, upper))
+}
+
+// And matches data points that match all of the given filters.
+func And(filters ...Filter) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		for _, f := range filters {
+			if !f.Match(attributes) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// Or matches data points that match at least one of the given filters.
+func Or(filters ...Filter) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		for _, f := range filters {
+			if f.Match(attributes) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// Not matches data points that don't match the given filter.
+func Not(filter Filter) Filter {
+	return FilterFunc(func(attributes Attributes) bool {
+		return !filter.Match(attributes)
+	})
+}
+
+// compareAttribute compares the attribute with the given value.
+// Returns false if the attribute is missing or the values are not comparable.
+func compareAttribute(attributes Attributes, key string, value interface{}) (int, bool) {
+	attribute, ok := attributes[key]
+	if !ok {
+		return 0, false
+	}
+
+	return compareValues(attribute, value)
+}
+
+// nolint: cyclop
+func compareValues(a, b interface{}) (int, bool) {
+	if _, ok := toFloat64(a); ok {
+		return compareNumbers(a, b)
+	}
+
+	switch va := a.(type) {
+	case string:
+		vb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+
+		return compareOrdered(va, vb), true
+	case bool:
+		vb, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+
+		return compareOrdered(boolToInt(va), boolToInt(vb)), true
+	case time.Time:
+		vb, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case va.Before(vb):
+			return -1, true
+		case va.After(vb):
+			return 1, true
+		default:
+			return 0, true
+		}
+	default:
+		return 0, false
+	}
+}
+
+// nolint: cyclop
+// compareNumbers compares integers exactly, so large values like UnixNano timestamps don't collapse.
+// The values are only compared as float64 if one of them is a float.
+func compareNumbers(a, b interface{}) (int, bool) {
+	ia, signedA := toInt64(a)
+	ib, signedB := toInt64(b)
+	ua, unsignedA := toUint64(a)
+	ub, unsignedB := toUint64(b)
+
+	switch {
+	case signedA && signedB:
+		return compareOrdered(ia, ib), true
+	case unsignedA && unsignedB:
+		return compareOrdered(ua, ub), true
+	case signedA && unsignedB:
+		if ia < 0 {
+			return -1, true
+		}
+
+		return compareOrdered(uint64(ia), ub), true
+	case unsignedA && signedB:
+		if ib < 0 {
+			return 1, true
+		}
+
+		return compareOrdered(ua, uint64(ib)), true
+	}
+
+	fa, okA := toFloat64(a)
+	fb, okB := toFloat64(b)
+
+	if !okA || !okB {
+		return 0, false
+	}
+
+	return compareOrdered(fa, fb), true
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func toUint64(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case uint:
+		return uint64(n), true
+	case uint8:
+		return uint64(n), true
+	case uint16:
+		return uint64(n), true
+	case uint32:
+		return uint64(n), true
+	case uint64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func compareOrdered[V int | int64 | uint64 | float64 | string](a, b V) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
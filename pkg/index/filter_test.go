@@ -0,0 +1,71 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestFilter_Match(t *testing.T) {
+	now := time.Now()
+	attributes := Attributes{
+		"tenant":  "acme",
+		"lang":    "de",
+		"version": 3,
+		"score":   float32(0.5),
+		"active":  true,
+		"created": now,
+		"nanos":   int64(1<<60 + 1),
+		"uid":     uint64(1<<63 + 1),
+		"delta":   -1,
+	}
+
+	for i, c := range []struct {
+		filter Filter
+		exp    bool
+	}{
+		{filter: Eq("tenant", "acme"), exp: true},
+		{filter: Eq("tenant", "other"), exp: false},
+		{filter: Eq("missing", "acme"), exp: false},
+		{filter: Eq("tenant", 1), exp: false},
+		{filter: Eq("version", int64(3)), exp: true},
+		{filter: Eq("version", 3.0), exp: true},
+		{filter: Eq("active", true), exp: true},
+		{filter: In("lang", "en", "de"), exp: true},
+		{filter: In("lang", "en", "fr"), exp: false},
+		{filter: Gt("version", 2), exp: true},
+		{filter: Gt("version", 3), exp: false},
+		{filter: Gte("version", 3), exp: true},
+		{filter: Lt("score", 0.6), exp: true},
+		{filter: Lte("score", 0.4), exp: false},
+		{filter: Range("version", 1, 5), exp: true},
+		{filter: Range("version", 4, 5), exp: false},
+		{filter: Range("created", now.Add(-time.Hour), now), exp: true},
+		{filter: Lt("created", now), exp: false},
+		{filter: Gt("tenant", "abc"), exp: true},
+		{filter: Eq("nanos", int64(1<<60+1)), exp: true},
+		{filter: Eq("nanos", int64(1<<60)), exp: false},
+		{filter: Gt("nanos", int64(1<<60)), exp: true},
+		{filter: Eq("uid", uint64(1<<63+1)), exp: true},
+		{filter: In("uid", uint64(1<<63), uint64(1<<63+2)), exp: false},
+		{filter: Range("uid", uint64(1<<63+1), uint64(1<<63+2)), exp: true},
+		{filter: Gt("uid", int64(1<<62)), exp: true},
+		{filter: Lt("delta", uint64(0)), exp: true},
+		{filter: Gt("delta", -1.5), exp: true},
+		{filter: And(Eq("tenant", "acme"), Eq("lang", "de")), exp: true},
+		{filter: And(Eq("tenant", "acme"), Eq("lang", "en")), exp: false},
+		{filter: Or(Eq("tenant", "other"), Eq("lang", "de")), exp: true},
+		{filter: Or(Eq("tenant", "other"), Eq("lang", "en")), exp: false},
+		{filter: Not(Eq("lang", "en")), exp: true},
+		{filter: Not(And(Eq("tenant", "acme"), Gte("version", 1))), exp: false},
+		{filter: FilterFunc(func(a Attributes) bool { return len(a) == 9 }), exp: true},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			assert.Equal(t, c.exp, c.filter.Match(attributes))
+		})
+	}
+}
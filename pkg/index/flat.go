@@ -0,0 +1,172 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+var _ Index[int, float64] = (*FlatIndex[int, float64])(nil)
+
+// FlatIndex answers searches exactly by comparing the input with every data point.
+// It serves as ground truth for the approximate indexes and is usually faster for small collections.
+type FlatIndex[T comparable, F Float] struct {
+	NumberOfDimensions   int
+	IDToDataPointMapping map[T]*DataPoint[T, F]
+	DataPoints           []*DataPoint[T, F]
+	DistanceMeasure      DistanceMeasure[F]
+}
+
+func NewFlatIndex[T comparable, F Float](numberOfDimensions int, dataPoints []*DataPoint[T, F], distanceMeasure DistanceMeasure[F]) (*FlatIndex[T, F], error) {
+	idToDataPointMapping := make(map[T]*DataPoint[T, F], len(dataPoints))
+
+	for _, dp := range dataPoints {
+		if len(dp.Embedding) != numberOfDimensions {
+			return nil, errShapeMismatch
+		}
+
+		idToDataPointMapping[dp.ID] = dp
+	}
+
+	return &FlatIndex[T, F]{
+		NumberOfDimensions:   numberOfDimensions,
+		IDToDataPointMapping: idToDataPointMapping,
+		DataPoints:           dataPoints,
+		DistanceMeasure:      distanceMeasure,
+	}, nil
+}
+
+// AddDataPoint adds a new data point to the index.
+// Returns ErrDataPointExists if the ID is already indexed, use UpsertDataPoint to replace existing data points.
+func (fi *FlatIndex[T, F]) AddDataPoint(dataPoint *DataPoint[T, F]) error {
+	if len(dataPoint.Embedding) != fi.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	if _, ok := fi.IDToDataPointMapping[dataPoint.ID]; ok {
+		return fmt.Errorf("%w: %v", ErrDataPointExists, dataPoint.ID)
+	}
+
+	fi.DataPoints = append(fi.DataPoints, dataPoint)
+	fi.IDToDataPointMapping[dataPoint.ID] = dataPoint
+
+	return nil
+}
+
+// UpsertDataPoint adds the data point if its ID is not indexed yet, otherwise it replaces the existing data point.
+func (fi *FlatIndex[T, F]) UpsertDataPoint(dataPoint *DataPoint[T, F]) error {
+	if len(dataPoint.Embedding) != fi.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	if _, ok := fi.IDToDataPointMapping[dataPoint.ID]; !ok {
+		return fi.AddDataPoint(dataPoint)
+	}
+
+	for i, dp := range fi.DataPoints {
+		if dp.ID == dataPoint.ID {
+			fi.DataPoints[i] = dataPoint
+
+			break
+		}
+	}
+
+	fi.IDToDataPointMapping[dataPoint.ID] = dataPoint
+
+	return nil
+}
+
+// DeleteDataPoint removes the data point with the given ID from the index.
+func (fi *FlatIndex[T, F]) DeleteDataPoint(id T) error {
+	if _, ok := fi.IDToDataPointMapping[id]; !ok {
+		return fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	delete(fi.IDToDataPointMapping, id)
+
+	for i, dp := range fi.DataPoints {
+		if dp.ID != id {
+			continue
+		}
+
+		copy(fi.DataPoints[i:], fi.DataPoints[i+1:])
+		fi.DataPoints[len(fi.DataPoints)-1] = nil
+		fi.DataPoints = fi.DataPoints[:len(fi.DataPoints)-1]
+
+		break
+	}
+
+	return nil
+}
+
+// SearchByVector returns the exact searchNum nearest neighbours of input.
+// numberOfBuckets is ignored, it only exists to satisfy the Index interface.
+func (fi *FlatIndex[T, F]) SearchByVector(input []F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	return fi.SearchByVectorContext(context.Background(), input, searchNum, numberOfBuckets, opts...)
+}
+
+// SearchByVectorContext works like SearchByVector but stops searching once the context is done.
+// It returns the context's error unless WithPartialResults is given, in which case the best results found so far are returned.
+func (fi *FlatIndex[T, F]) SearchByVectorContext(ctx context.Context, input []F, searchNum int, _ float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	if len(input) != fi.NumberOfDimensions {
+		return nil, errShapeMismatch
+	}
+
+	options := newSearchOptions(opts)
+	checker := newContextChecker(ctx)
+
+	type candidate struct {
+		dp   *DataPoint[T, F]
+		dist float64
+	}
+
+	candidates := make([]candidate, 0, len(fi.DataPoints))
+
+	for _, dp := range fi.DataPoints {
+		if err := checker.err(); err != nil {
+			if options.partialResults {
+				break
+			}
+
+			return nil, err
+		}
+
+		if options.filter != nil && !options.filter.Match(dp.Attributes) {
+			continue
+		}
+
+		candidates = append(candidates, candidate{dp, fi.DistanceMeasure.CalcDistance(dp.Embedding, input)})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].dist < candidates[j].dist
+	})
+
+	candidates = candidates[:imath.Min(searchNum, len(candidates))]
+
+	searchResults := make([]SearchResult[T, F], len(candidates))
+	for i, c := range candidates {
+		searchResults[i] = newSearchResult(fi.DistanceMeasure, c.dp.ID, c.dist, c.dp.Embedding)
+	}
+
+	return &searchResults, nil
+}
+
+// SearchByItem returns the exact nearest neighbours of a data point that is already part of the index.
+// The queried item itself is not included in the results.
+func (fi *FlatIndex[T, F]) SearchByItem(id T, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	dp, ok := fi.IDToDataPointMapping[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	// search for one additional item since the queried item will most likely be part of the results
+	results, err := fi.SearchByVector(dp.Embedding, searchNum+1, numberOfBuckets, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutItem(results, id, searchNum), nil
+}
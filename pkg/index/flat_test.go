@@ -0,0 +1,194 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// nolint: funlen, gocognit, cyclop
+func TestFlatIndex_SearchByVector(t *testing.T) {
+	for i, c := range []struct {
+		dim, num, searchNum int
+		distanceMeasure     DistanceMeasure[float64]
+		opts                []SearchOption
+		matches             func(id int) bool
+	}{
+		{
+			dim:             20,
+			num:             2000,
+			searchNum:       20,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+			matches:         func(id int) bool { return true },
+		},
+		{
+			dim:             5,
+			num:             1000,
+			searchNum:       10,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+			opts:            []SearchOption{WithFilter(Eq("even", true))},
+			matches:         func(id int) bool { return id%2 == 0 },
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPointWithAttributes(i, randVec(c.dim), Attributes{"even": i%2 == 0})
+			}
+
+			idx, err := NewFlatIndex(c.dim, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := randVec(c.dim)
+
+			// exact neighbors
+			aDist := map[int]float64{}
+			ids := []int{}
+			for i, v := range rawItems {
+				if !c.matches(i) {
+					continue
+				}
+				ids = append(ids, i)
+				aDist[i] = c.distanceMeasure.CalcDistance(v.Embedding, query)
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				return aDist[ids[i]] < aDist[ids[j]]
+			})
+
+			ass, err := idx.SearchByVector(query, c.searchNum, DefaultBuckets, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*ass) != c.searchNum {
+				t.Fatalf("expected %d results, got %d", c.searchNum, len(*ass))
+			}
+
+			for j, res := range *ass {
+				if res.ID != ids[j] {
+					t.Fatalf("expected item %d at position %d, got %d", ids[j], j, res.ID)
+				}
+
+				if j > 0 && (res.Distance < (*ass)[j-1].Distance || res.Score > (*ass)[j-1].Score) {
+					t.Fatalf("expected increasing distances and decreasing scores at position %d", j)
+				}
+			}
+		})
+	}
+}
+
+// nolint: funlen, cyclop
+func TestFlatIndex_Modifications(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 100)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(4))
+	}
+
+	var idx Index[int, float64]
+
+	idx, err := NewFlatIndex(4, rawItems, NewEuclideanDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddDataPoint(NewDataPoint(0, randVec(4))); !errors.Is(err, ErrDataPointExists) {
+		t.Fatalf("expected ErrDataPointExists, got %v", err)
+	}
+
+	if err := idx.AddDataPoint(NewDataPoint(100, randVec(5))); !errors.Is(err, errShapeMismatch) {
+		t.Fatalf("expected errShapeMismatch, got %v", err)
+	}
+
+	if err := idx.AddDataPoint(NewDataPoint(100, []float64{1, 1, 1, 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.UpsertDataPoint(NewDataPoint(5, []float64{1, 1, 1, 1.01})); err != nil {
+		t.Fatal(err)
+	}
+
+	ass, err := idx.SearchByItem(100, 1, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 1 || (*ass)[0].ID != 5 {
+		t.Fatalf("expected upserted item 5 as nearest neighbor of item 100, got %v", *ass)
+	}
+
+	if err := idx.DeleteDataPoint(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.DeleteDataPoint(5); !errors.Is(err, ErrDataPointNotFound) {
+		t.Fatalf("expected ErrDataPointNotFound, got %v", err)
+	}
+
+	ass, err = idx.SearchByVector([]float64{1, 1, 1, 1.01}, 101, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 100 || (*ass)[0].ID != 100 {
+		t.Fatalf("expected the deleted item to be gone, got %d results starting with %d", len(*ass), (*ass)[0].ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := idx.SearchByVectorContext(ctx, randVec(4), 10, DefaultBuckets); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// nolint: funlen
+func TestFlatIndex_GroundTruthForVectorIndex(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 5000)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(20))
+	}
+
+	flat, err := NewFlatIndex(20, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approx, err := NewVectorIndex(20, 20, 5, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx.Build()
+
+	query := make([]float64, 20)
+	query[0] = 0.1
+
+	results := make([]*[]SearchResult[int, float64], 2)
+
+	for i, idx := range []Index[int, float64]{flat, approx} {
+		if results[i], err = idx.SearchByVector(query, 50, 40); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectedIDsMap := map[int]struct{}{}
+	for _, res := range *results[0] {
+		expectedIDsMap[res.ID] = struct{}{}
+	}
+
+	var count int
+	for _, res := range *results[1] {
+		if _, ok := expectedIDsMap[res.ID]; ok {
+			count++
+		}
+	}
+
+	if ratio := float64(count) / 50; ratio < 0.85 {
+		t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, 50, ratio)
+	}
+}
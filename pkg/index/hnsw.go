@@ -0,0 +1,501 @@
+package index
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+const (
+	DefaultHNSWM              = 16
+	DefaultHNSWEfConstruction = 200
+	DefaultHNSWEfSearch       = 50
+	minHNSWM                  = 2
+)
+
+var _ Index[int, float64] = (*HNSWIndex[int, float64])(nil)
+
+// HNSWIndex is an approximate index based on a hierarchical navigable small world graph.
+// Every data point is a node of the graph and is connected to its nearest neighbours on each layer it is part of,
+// the upper layers contain exponentially fewer nodes and are used to quickly find a good entry point into the lower layers.
+// Deleted data points, including the previous embeddings of upserted ones, stay in the graph as tombstones to keep it connected.
+// Once the tombstones outnumber the live nodes, the graph is rebuilt from the live data points,
+// so an update-heavy workload periodically pays for a full reconstruction.
+type HNSWIndex[T comparable, F Float] struct {
+	NumberOfDimensions int
+	// maximum number of connections per node on the upper layers, the bottom layer allows 2 * M connections
+	M int
+	// size of the candidate list while inserting data points
+	EfConstruction int
+	// minimum size of the candidate list while searching
+	EfSearch             int
+	DistanceMeasure      DistanceMeasure[F]
+	IDToDataPointMapping map[T]*DataPoint[T, F]
+
+	nodes      []*hnswNode[T, F]
+	idToNode   map[T]uint32
+	entryPoint uint32
+	// number of deleted nodes that are still part of the graph
+	tombstones int
+	// highest layer of the graph, -1 if the graph is empty
+	maxLevel        int
+	levelMultiplier float64
+	rng             *rand.Rand
+}
+
+type hnswNode[T comparable, F Float] struct {
+	dataPoint *DataPoint[T, F]
+	// neighbors contains the connections of the node on every layer it is part of
+	neighbors [][]uint32
+	// deleted nodes are still used to navigate the graph but are never returned as results
+	deleted bool
+}
+
+func NewHNSWIndex[T comparable, F Float](numberOfDimensions int, m int, efConstruction int, efSearch int, dataPoints []*DataPoint[T, F], distanceMeasure DistanceMeasure[F]) (*HNSWIndex[T, F], error) {
+	if m < minHNSWM {
+		return nil, fmt.Errorf("%w: M must be at least %d", errInvalidParameter, minHNSWM)
+	}
+
+	if efConstruction < 1 || efSearch < 1 {
+		return nil, fmt.Errorf("%w: efConstruction and efSearch must be at least 1", errInvalidParameter)
+	}
+
+	hi := &HNSWIndex[T, F]{
+		NumberOfDimensions:   numberOfDimensions,
+		M:                    m,
+		EfConstruction:       efConstruction,
+		EfSearch:             efSearch,
+		DistanceMeasure:      distanceMeasure,
+		IDToDataPointMapping: make(map[T]*DataPoint[T, F], len(dataPoints)),
+		nodes:                make([]*hnswNode[T, F], 0, len(dataPoints)),
+		idToNode:             make(map[T]uint32, len(dataPoints)),
+		maxLevel:             -1,
+		levelMultiplier:      1 / math.Log(float64(m)),
+		rng:                  rand.New(rand.NewSource(time.Now().UnixNano())), // nolint: gosec
+	}
+
+	for _, dp := range dataPoints {
+		if err := hi.AddDataPoint(dp); err != nil {
+			return nil, err
+		}
+	}
+
+	return hi, nil
+}
+
+// AddDataPoint inserts a new node into the graph.
+// Returns ErrDataPointExists if the ID is already indexed, use UpsertDataPoint to replace existing data points.
+func (hi *HNSWIndex[T, F]) AddDataPoint(dataPoint *DataPoint[T, F]) error {
+	if len(dataPoint.Embedding) != hi.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	if _, ok := hi.IDToDataPointMapping[dataPoint.ID]; ok {
+		return fmt.Errorf("%w: %v", ErrDataPointExists, dataPoint.ID)
+	}
+
+	hi.IDToDataPointMapping[dataPoint.ID] = dataPoint
+	hi.insert(dataPoint)
+
+	return nil
+}
+
+// UpsertDataPoint adds the data point if its ID is not indexed yet, otherwise it replaces the existing data point.
+// If the embedding is unchanged, the node keeps its connections and only the attributes are replaced.
+func (hi *HNSWIndex[T, F]) UpsertDataPoint(dataPoint *DataPoint[T, F]) error {
+	if len(dataPoint.Embedding) != hi.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	existing, ok := hi.IDToDataPointMapping[dataPoint.ID]
+	if !ok {
+		return hi.AddDataPoint(dataPoint)
+	}
+
+	if imath.VectorsEqual(existing.Embedding, dataPoint.Embedding) {
+		hi.nodes[hi.idToNode[dataPoint.ID]].dataPoint = dataPoint
+		hi.IDToDataPointMapping[dataPoint.ID] = dataPoint
+
+		return nil
+	}
+
+	if err := hi.DeleteDataPoint(dataPoint.ID); err != nil {
+		return err
+	}
+
+	return hi.AddDataPoint(dataPoint)
+}
+
+// DeleteDataPoint removes the data point from the index.
+// The node stays part of the graph to keep it connected, but is never returned as search result.
+// The graph is rebuilt once more than half of its nodes are deleted.
+func (hi *HNSWIndex[T, F]) DeleteDataPoint(id T) error {
+	node, ok := hi.idToNode[id]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	hi.nodes[node].deleted = true
+	hi.tombstones++
+
+	delete(hi.idToNode, id)
+	delete(hi.IDToDataPointMapping, id)
+
+	if hi.tombstones > len(hi.idToNode) {
+		hi.rebuild()
+	}
+
+	return nil
+}
+
+// rebuild reconstructs the graph from the live nodes to get rid of the tombstones.
+func (hi *HNSWIndex[T, F]) rebuild() {
+	nodes := hi.nodes
+
+	hi.nodes = make([]*hnswNode[T, F], 0, len(hi.idToNode))
+	hi.idToNode = make(map[T]uint32, len(hi.idToNode))
+	hi.maxLevel = -1
+	hi.tombstones = 0
+
+	for _, node := range nodes {
+		if !node.deleted {
+			hi.insert(node.dataPoint)
+		}
+	}
+}
+
+// nolint: funlen
+func (hi *HNSWIndex[T, F]) insert(dataPoint *DataPoint[T, F]) {
+	level := int(-math.Log(1-hi.rng.Float64()) * hi.levelMultiplier)
+	node := &hnswNode[T, F]{
+		dataPoint: dataPoint,
+		neighbors: make([][]uint32, level+1),
+	}
+	id := uint32(len(hi.nodes))
+
+	hi.nodes = append(hi.nodes, node)
+	hi.idToNode[dataPoint.ID] = id
+
+	if hi.maxLevel < 0 {
+		hi.entryPoint = id
+		hi.maxLevel = level
+
+		return
+	}
+
+	checker := newContextChecker(context.Background())
+	query := dataPoint.Embedding
+	entryPoints := []hnswCandidate{{hi.entryPoint, hi.distance(query, hi.entryPoint)}}
+
+	// greedily find the closest node on the layers above the level of the new node
+	for lc := hi.maxLevel; lc > level; lc-- {
+		entryPoints, _ = hi.searchLayer(query, entryPoints, 1, lc, hi.isNavigable, checker)
+	}
+
+	for lc := imath.Min(hi.maxLevel, level); lc >= 0; lc-- {
+		candidates, _ := hi.searchLayer(query, entryPoints, hi.EfConstruction, lc, hi.isNotDeleted, checker)
+		if len(candidates) == 0 {
+			// only deleted nodes are left on this layer, use them to stay connected
+			candidates, _ = hi.searchLayer(query, entryPoints, hi.EfConstruction, lc, hi.isNavigable, checker)
+		}
+
+		neighbors := hi.selectNeighbors(candidates, hi.M)
+		node.neighbors[lc] = make([]uint32, len(neighbors))
+
+		for i, n := range neighbors {
+			node.neighbors[lc][i] = n.node
+
+			neighbor := hi.nodes[n.node]
+			neighbor.neighbors[lc] = append(neighbor.neighbors[lc], id)
+
+			if len(neighbor.neighbors[lc]) > hi.maxConnections(lc) {
+				hi.shrinkConnections(n.node, lc)
+			}
+		}
+
+		entryPoints = candidates
+	}
+
+	if level > hi.maxLevel {
+		hi.entryPoint = id
+		hi.maxLevel = level
+	}
+}
+
+// shrinkConnections reduces the connections of the node on the given layer to the maximum allowed number.
+func (hi *HNSWIndex[T, F]) shrinkConnections(node uint32, level int) {
+	embedding := hi.nodes[node].dataPoint.Embedding
+	connections := hi.nodes[node].neighbors[level]
+	candidates := make([]hnswCandidate, len(connections))
+
+	for i, c := range connections {
+		candidates[i] = hnswCandidate{c, hi.distance(embedding, c)}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].dist < candidates[j].dist
+	})
+
+	selected := hi.selectNeighbors(candidates, hi.maxConnections(level))
+	shrunk := connections[:0]
+
+	for _, s := range selected {
+		shrunk = append(shrunk, s.node)
+	}
+
+	hi.nodes[node].neighbors[level] = shrunk
+}
+
+// selectNeighbors picks up to m neighbors from the candidates, which have to be sorted by their distance.
+// Candidates that are closer to an already selected neighbor than to the query are skipped in favour of
+// candidates in other directions, skipped candidates are only used if not enough neighbors were found.
+func (hi *HNSWIndex[T, F]) selectNeighbors(candidates []hnswCandidate, m int) []hnswCandidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]hnswCandidate, 0, m)
+	skipped := make([]hnswCandidate, 0, len(candidates))
+
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+
+		good := true
+		embedding := hi.nodes[c.node].dataPoint.Embedding
+
+		for _, s := range selected {
+			if hi.distance(embedding, s.node) < c.dist {
+				good = false
+
+				break
+			}
+		}
+
+		if good {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+
+	for _, c := range skipped {
+		if len(selected) >= m {
+			break
+		}
+
+		selected = append(selected, c)
+	}
+
+	return selected
+}
+
+// searchLayer performs a best-first search on a single layer of the graph starting at the entry points.
+// Only nodes accepted by accept are part of the results, all other nodes are just used to navigate through the graph.
+// Returns up to ef results sorted by their distance and, if the context is done, the best results found so far together with its error.
+// nolint: cyclop
+func (hi *HNSWIndex[T, F]) searchLayer(query []F, entryPoints []hnswCandidate, ef int, level int,
+	accept func(node uint32) bool, checker *contextChecker,
+) ([]hnswCandidate, error) {
+	// the worst result bounds the search, so at least one result must be kept
+	ef = imath.Max(ef, 1)
+
+	visited := make(map[uint32]struct{}, ef*hi.M)
+	candidates := &candidateHeap{}
+	results := &candidateHeap{farthestFirst: true}
+
+	for _, ep := range entryPoints {
+		visited[ep.node] = struct{}{}
+
+		heap.Push(candidates, ep)
+
+		if accept(ep.node) {
+			heap.Push(results, ep)
+		}
+	}
+
+	for results.Len() > ef {
+		heap.Pop(results)
+	}
+
+	var err error
+
+	for candidates.Len() > 0 {
+		if err = checker.err(); err != nil {
+			break
+		}
+
+		c, _ := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && c.dist > results.peek().dist {
+			// all remaining candidates are farther away than the worst result
+			break
+		}
+
+		for _, neighbor := range hi.nodes[c.node].neighbors[level] {
+			if _, ok := visited[neighbor]; ok {
+				continue
+			}
+
+			visited[neighbor] = struct{}{}
+			dist := hi.distance(query, neighbor)
+
+			if results.Len() < ef || dist < results.peek().dist {
+				heap.Push(candidates, hnswCandidate{neighbor, dist})
+
+				if accept(neighbor) {
+					heap.Push(results, hnswCandidate{neighbor, dist})
+
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(results.items, func(i, j int) bool {
+		return results.items[i].dist < results.items[j].dist
+	})
+
+	return results.items, err
+}
+
+// SearchByVector returns the searchNum nearest neighbours of input.
+// The size of the candidate list is the maximum of EfSearch and searchNum, numberOfBuckets is ignored.
+func (hi *HNSWIndex[T, F]) SearchByVector(input []F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	return hi.SearchByVectorContext(context.Background(), input, searchNum, numberOfBuckets, opts...)
+}
+
+// SearchByVectorContext works like SearchByVector but stops searching once the context is done.
+// It returns the context's error unless WithPartialResults is given, in which case the best results found so far are returned.
+func (hi *HNSWIndex[T, F]) SearchByVectorContext(ctx context.Context, input []F, searchNum int, _ float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	if len(input) != hi.NumberOfDimensions {
+		return nil, errShapeMismatch
+	}
+
+	searchResults := []SearchResult[T, F]{}
+
+	if hi.maxLevel < 0 {
+		return &searchResults, nil
+	}
+
+	options := newSearchOptions(opts)
+	checker := newContextChecker(ctx)
+	entryPoints := []hnswCandidate{{hi.entryPoint, hi.distance(input, hi.entryPoint)}}
+
+	var err error
+
+	for lc := hi.maxLevel; lc > 0 && err == nil; lc-- {
+		entryPoints, err = hi.searchLayer(input, entryPoints, 1, lc, hi.isNavigable, checker)
+	}
+
+	accept := func(node uint32) bool {
+		n := hi.nodes[node]
+
+		return !n.deleted && (options.filter == nil || options.filter.Match(n.dataPoint.Attributes))
+	}
+
+	var candidates []hnswCandidate
+	if err == nil {
+		candidates, err = hi.searchLayer(input, entryPoints, imath.Max(hi.EfSearch, searchNum), 0, accept, checker)
+	}
+
+	if err != nil && !(checker.done && options.partialResults) {
+		return nil, err
+	}
+
+	for _, c := range candidates {
+		if len(searchResults) >= searchNum {
+			break
+		}
+
+		dp := hi.nodes[c.node].dataPoint
+		searchResults = append(searchResults, newSearchResult(hi.DistanceMeasure, dp.ID, c.dist, dp.Embedding))
+	}
+
+	return &searchResults, nil
+}
+
+// SearchByItem returns the nearest neighbours of a data point that is already part of the index.
+// The queried item itself is not included in the results.
+func (hi *HNSWIndex[T, F]) SearchByItem(id T, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	dp, ok := hi.IDToDataPointMapping[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	// search for one additional item since the queried item will most likely be part of the results
+	results, err := hi.SearchByVector(dp.Embedding, searchNum+1, numberOfBuckets, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutItem(results, id, searchNum), nil
+}
+
+func (hi *HNSWIndex[T, F]) distance(query []F, node uint32) float64 {
+	return hi.DistanceMeasure.CalcDistance(hi.nodes[node].dataPoint.Embedding, query)
+}
+
+func (hi *HNSWIndex[T, F]) maxConnections(level int) int {
+	if level == 0 {
+		return 2 * hi.M
+	}
+
+	return hi.M
+}
+
+func (hi *HNSWIndex[T, F]) isNavigable(_ uint32) bool {
+	return true
+}
+
+func (hi *HNSWIndex[T, F]) isNotDeleted(node uint32) bool {
+	return !hi.nodes[node].deleted
+}
+
+type hnswCandidate struct {
+	node uint32
+	dist float64
+}
+
+// candidateHeap orders candidates by their distance, either closest or farthest first.
+type candidateHeap struct {
+	items         []hnswCandidate
+	farthestFirst bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.farthestFirst {
+		return h.items[i].dist > h.items[j].dist
+	}
+
+	return h.items[i].dist < h.items[j].dist
+}
+
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *candidateHeap) Push(x interface{}) {
+	item, _ := x.(hnswCandidate)
+	h.items = append(h.items, item)
+}
+
+func (h *candidateHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+
+	return item
+}
+
+func (h *candidateHeap) peek() hnswCandidate {
+	return h.items[0]
+}
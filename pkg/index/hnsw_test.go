@@ -0,0 +1,256 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// nolint: funlen, gocognit, cyclop
+func TestHNSWIndex_SearchByVector(t *testing.T) {
+	for i, c := range []struct {
+		m, efConstruction, efSearch, dim, num, numAdd, searchNum int
+		threshold                                                float64
+		distanceMeasure                                          DistanceMeasure[float64]
+		opts                                                     []SearchOption
+	}{
+		{
+			m:               16,
+			efConstruction:  100,
+			efSearch:        100,
+			dim:             20,
+			num:             3000,
+			numAdd:          0,
+			searchNum:       20,
+			threshold:       0.9,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+		},
+		{
+			m:               8,
+			efConstruction:  100,
+			efSearch:        100,
+			dim:             10,
+			num:             1000,
+			numAdd:          1000,
+			searchNum:       10,
+			threshold:       0.9,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+		},
+		{
+			m:               16,
+			efConstruction:  100,
+			efSearch:        100,
+			dim:             20,
+			num:             3000,
+			searchNum:       20,
+			threshold:       0.9,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+			opts:            []SearchOption{WithFilter(Eq("even", true))},
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num+c.numAdd)
+			for i := range rawItems {
+				rawItems[i] = NewDataPointWithAttributes(i, randVec(c.dim), Attributes{"even": i%2 == 0})
+			}
+
+			idx, err := NewHNSWIndex(c.dim, c.m, c.efConstruction, c.efSearch, rawItems[:c.num], c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// incremental inserts after the initial construction
+			for _, dp := range rawItems[c.num:] {
+				if err := idx.AddDataPoint(dp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			flat, err := NewFlatIndex(c.dim, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var count int
+
+			for q := 0; q < 10; q++ {
+				query := randVec(c.dim)
+
+				expected, err := flat.SearchByVector(query, c.searchNum, DefaultBuckets, c.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				expectedIDsMap := map[int]struct{}{}
+				for _, res := range *expected {
+					expectedIDsMap[res.ID] = struct{}{}
+				}
+
+				ass, err := idx.SearchByVector(query, c.searchNum, DefaultBuckets, c.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(*ass) != c.searchNum {
+					t.Fatalf("expected %d results, got %d", c.searchNum, len(*ass))
+				}
+
+				for _, res := range *ass {
+					if _, ok := expectedIDsMap[res.ID]; ok {
+						count++
+					}
+				}
+			}
+
+			if ratio := float64(count) / float64(10*c.searchNum); ratio < c.threshold {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, 10*c.searchNum, ratio)
+			} else {
+				t.Logf("ratio of exact neighbors in approximated result: %d / %d = %f", count, 10*c.searchNum, ratio)
+			}
+		})
+	}
+}
+
+// nolint: funlen, cyclop
+func TestHNSWIndex_Modifications(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 500)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(8))
+	}
+
+	for _, params := range [][3]int{{1, 10, 10}, {8, 0, 10}, {8, 10, 0}} {
+		if _, err := NewHNSWIndex(8, params[0], params[1], params[2], rawItems, NewCosineDistanceMeasure[float64]()); !errors.Is(err, errInvalidParameter) {
+			t.Fatalf("expected errInvalidParameter for M, efConstruction and efSearch %v, got %v", params, err)
+		}
+	}
+
+	var idx Index[int, float64]
+
+	idx, err := NewHNSWIndex(8, 8, 50, 50, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddDataPoint(NewDataPoint(0, randVec(8))); !errors.Is(err, ErrDataPointExists) {
+		t.Fatalf("expected ErrDataPointExists, got %v", err)
+	}
+
+	// delete half of the items, none of them must be returned afterwards
+	for id := 0; id < 500; id += 2 {
+		if err := idx.DeleteDataPoint(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := idx.DeleteDataPoint(0); !errors.Is(err, ErrDataPointNotFound) {
+		t.Fatalf("expected ErrDataPointNotFound, got %v", err)
+	}
+
+	ass, err := idx.SearchByVector(rawItems[0].Embedding, 50, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 50 {
+		t.Fatalf("expected 50 results, got %d", len(*ass))
+	}
+
+	for _, res := range *ass {
+		if res.ID%2 == 0 {
+			t.Fatalf("deleted item %d returned by search", res.ID)
+		}
+	}
+
+	// the exported EfSearch can be changed after the construction
+	idx.(*HNSWIndex[int, float64]).EfSearch = 0
+
+	ass, err = idx.SearchByVector(rawItems[0].Embedding, 0, DefaultBuckets)
+	if err != nil || len(*ass) != 0 {
+		t.Fatalf("expected no results, got %v, %v", ass, err)
+	}
+
+	idx.(*HNSWIndex[int, float64]).EfSearch = 50
+
+	// move an item onto a deleted one, it must be found at its new position
+	if err := idx.UpsertDataPoint(NewDataPoint(1, rawItems[0].Embedding)); err != nil {
+		t.Fatal(err)
+	}
+
+	ass, err = idx.SearchByItem(3, 499, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[int]struct{}{}
+	for _, res := range *ass {
+		if res.ID == 3 {
+			t.Fatalf("queried item must not be part of the results")
+		}
+		if _, ok := seen[res.ID]; ok {
+			t.Fatalf("item %d returned multiple times", res.ID)
+		}
+		seen[res.ID] = struct{}{}
+	}
+
+	ass, err = idx.SearchByVector(rawItems[0].Embedding, 1, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*ass)[0].ID != 1 {
+		t.Fatalf("expected upserted item 1 as nearest neighbor, got %d", (*ass)[0].ID)
+	}
+}
+
+func TestHNSWIndex_UpsertRebuild(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 100)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(8))
+	}
+
+	idx, err := NewHNSWIndex(8, 8, 50, 50, rawItems, NewEuclideanDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every upsert with a changed embedding leaves a tombstone, they must not accumulate
+	for round := 0; round < 10; round++ {
+		for i := range rawItems {
+			rawItems[i] = NewDataPoint(i, randVec(8))
+			if err := idx.UpsertDataPoint(rawItems[i]); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(idx.nodes) > 2*len(rawItems)+1 {
+				t.Fatalf("expected at most %d nodes, got %d", 2*len(rawItems)+1, len(idx.nodes))
+			}
+		}
+	}
+
+	if len(idx.idToNode) != len(rawItems) || len(idx.IDToDataPointMapping) != len(rawItems) {
+		t.Fatalf("expected %d live nodes, got %d", len(rawItems), len(idx.idToNode))
+	}
+
+	for _, dp := range rawItems {
+		ass, err := idx.SearchByVector(dp.Embedding, 1, DefaultBuckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (*ass)[0].ID != dp.ID {
+			t.Fatalf("expected item %d at its upserted position, got %d", dp.ID, (*ass)[0].ID)
+		}
+	}
+
+	for i := range rawItems {
+		if err := idx.DeleteDataPoint(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(idx.nodes) != 0 || idx.maxLevel != -1 {
+		t.Fatalf("expected an empty graph after deleting all items, got %d nodes", len(idx.nodes))
+	}
+}
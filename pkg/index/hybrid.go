@@ -0,0 +1,174 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+const (
+	// DefaultRRFConstant is the constant k of reciprocal rank fusion proposed by Cormack et al.
+	DefaultRRFConstant = 60.0
+	// number of results requested from the dense and the sparse index per requested hybrid result,
+	// data points ranked low by one index can still make it into the fused results
+	hybridCandidateFactor = 2
+)
+
+// Fusion combines the results of the dense and the sparse search into a single ranking.
+type Fusion interface {
+	// Fuse receives the scores of the dense and the sparse results, each ordered by decreasing score,
+	// and returns the contribution of every result to its fused score. The fused score of a data point is the sum
+	// of its contributions, data points found by only one of the searches get no contribution from the other.
+	Fuse(dense, sparse []float64) ([]float64, []float64)
+}
+
+type weightedSumFusion struct {
+	alpha float64
+}
+
+// NewWeightedSumFusion returns a fusion that min-max normalizes the scores of both searches to [0, 1]
+// and weights the dense ones by alpha and the sparse ones by 1 - alpha.
+// alpha = 1 ranks by the dense scores only, alpha = 0 by the sparse scores only.
+func NewWeightedSumFusion(alpha float64) (Fusion, error) {
+	if math.IsNaN(alpha) || alpha < 0 || alpha > 1 {
+		return nil, fmt.Errorf("%w: alpha must be within [0, 1], got %f", errInvalidParameter, alpha)
+	}
+
+	return &weightedSumFusion{alpha: alpha}, nil
+}
+
+func (wsf *weightedSumFusion) Fuse(dense, sparse []float64) ([]float64, []float64) {
+	return minMaxNormalized(dense, wsf.alpha), minMaxNormalized(sparse, 1-wsf.alpha)
+}
+
+// minMaxNormalized maps the scores linearly to [0, weight], a single score or equal scores are mapped to weight.
+func minMaxNormalized(scores []float64, weight float64) []float64 {
+	res := make([]float64, len(scores))
+	if len(scores) == 0 {
+		return res
+	}
+
+	lo, hi := scores[0], scores[0]
+	for _, s := range scores {
+		lo = imath.Min(lo, s)
+		hi = imath.Max(hi, s)
+	}
+
+	for i, s := range scores {
+		if hi == lo {
+			res[i] = weight
+		} else {
+			res[i] = weight * (s - lo) / (hi - lo)
+		}
+	}
+
+	return res
+}
+
+type reciprocalRankFusion struct {
+	k float64
+}
+
+// NewReciprocalRankFusion returns a fusion that ignores the scores and adds up 1 / (k + rank) of both searches,
+// the best result has rank 1. Unlike NewWeightedSumFusion it doesn't depend on the scales of the scores.
+// Larger constants k reduce the influence of the top ranks, see DefaultRRFConstant.
+func NewReciprocalRankFusion(k float64) (Fusion, error) {
+	if math.IsNaN(k) || k < 0 {
+		return nil, fmt.Errorf("%w: k must not be negative, got %f", errInvalidParameter, k)
+	}
+
+	return &reciprocalRankFusion{k: k}, nil
+}
+
+func (rrf *reciprocalRankFusion) Fuse(dense, sparse []float64) ([]float64, []float64) {
+	return rrf.contributions(len(dense)), rrf.contributions(len(sparse))
+}
+
+func (rrf *reciprocalRankFusion) contributions(n int) []float64 {
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = 1 / (rrf.k + float64(i+1))
+	}
+
+	return res
+}
+
+// HybridIndex answers searches with a dense and a sparse query, e.g. an embedding and the BM25 weights of the same text,
+// by searching a dense and a sparse index and fusing both result lists.
+// The data points of both indexes are matched by their IDs.
+type HybridIndex[T comparable, F Float] struct {
+	Dense  Index[T, F]
+	Sparse *SparseIndex[T, F]
+	Fusion Fusion
+}
+
+func NewHybridIndex[T comparable, F Float](dense Index[T, F], sparse *SparseIndex[T, F], fusion Fusion) *HybridIndex[T, F] {
+	return &HybridIndex[T, F]{Dense: dense, Sparse: sparse, Fusion: fusion}
+}
+
+// Search returns the searchNum data points with the largest fused scores, numberOfBuckets is passed to the dense index.
+// The Score of the search results is the fused score and the Distance its negation.
+// The Vector is the dense embedding of data points found by the dense search and nil for all others.
+func (hi *HybridIndex[T, F]) Search(dense []F, sparse SparseVector[F], searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	return hi.SearchContext(context.Background(), dense, sparse, searchNum, numberOfBuckets, opts...)
+}
+
+// SearchContext works like Search but stops searching once the context is done.
+// It returns the context's error unless WithPartialResults is given, in which case the best results found so far are fused.
+func (hi *HybridIndex[T, F]) SearchContext(ctx context.Context, dense []F, sparse SparseVector[F], searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	denseResults, err := hi.Dense.SearchByVectorContext(ctx, dense, searchNum*hybridCandidateFactor, numberOfBuckets, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	sparseResults, err := hi.Sparse.SearchContext(ctx, sparse, searchNum*hybridCandidateFactor, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	denseContributions, sparseContributions := hi.Fusion.Fuse(resultScores(*denseResults), resultScores(*sparseResults))
+
+	fused := make(map[T]*SearchResult[T, F], len(*denseResults)+len(*sparseResults))
+	order := make([]*SearchResult[T, F], 0, len(*denseResults)+len(*sparseResults))
+
+	add := func(results []SearchResult[T, F], contributions []float64) {
+		for i, res := range results {
+			r, ok := fused[res.ID]
+			if !ok {
+				r = &SearchResult[T, F]{ID: res.ID, Vector: res.Vector}
+				fused[res.ID] = r
+				order = append(order, r)
+			}
+
+			r.Score += contributions[i]
+		}
+	}
+
+	add(*denseResults, denseContributions)
+	add(*sparseResults, sparseContributions)
+
+	// the stable sort keeps the dense order for equal fused scores
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].Score > order[j].Score
+	})
+
+	searchResults := make([]SearchResult[T, F], imath.Min(searchNum, len(order)))
+	for i := range searchResults {
+		searchResults[i] = *order[i]
+		searchResults[i].Distance = -searchResults[i].Score
+	}
+
+	return &searchResults, nil
+}
+
+func resultScores[T comparable, F Float](results []SearchResult[T, F]) []float64 {
+	scores := make([]float64, len(results))
+	for i, res := range results {
+		scores[i] = res.Score
+	}
+
+	return scores
+}
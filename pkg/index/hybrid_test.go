@@ -0,0 +1,137 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestFusion(t *testing.T) {
+	if _, err := NewWeightedSumFusion(1.5); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	if _, err := NewReciprocalRankFusion(-1); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	weighted, err := NewWeightedSumFusion(0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dense, sparse := weighted.Fuse([]float64{0.9, 0.5, 0.1}, []float64{12})
+	if fmt.Sprint(dense) != "[0.25 0.125 0]" || fmt.Sprint(sparse) != "[0.75]" {
+		t.Fatalf("unexpected weighted contributions %v, %v", dense, sparse)
+	}
+
+	rrf, err := NewReciprocalRankFusion(DefaultRRFConstant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dense, sparse = rrf.Fuse([]float64{0.9, 0.5}, nil)
+	if len(sparse) != 0 || math.Abs(dense[0]-1.0/61) > 1e-15 || math.Abs(dense[1]-1.0/62) > 1e-15 {
+		t.Fatalf("unexpected reciprocal rank contributions %v, %v", dense, sparse)
+	}
+}
+
+// nolint: funlen
+func TestHybridIndex_Search(t *testing.T) {
+	// the dense embeddings rank 0 < 1 < 2 < 3, the sparse vectors 3 < 2 < 1 < 0 and item 4 is only found by the sparse index
+	query := []float64{1, 0}
+	denseItems := []*DataPoint[int, float64]{
+		NewDataPoint(0, []float64{1, 0}),
+		NewDataPoint(1, []float64{1, 0.2}),
+		NewDataPoint(2, []float64{1, 0.5}),
+		NewDataPoint(3, []float64{0, 1}),
+	}
+
+	sparseQuery := NewSparseVectorFromMap(map[uint32]float64{7: 1})
+	sparseItems := make([]*SparseDataPoint[int, float64], 5)
+
+	for i := range sparseItems {
+		sparseItems[i] = NewSparseDataPointWithAttributes(i, NewSparseVectorFromMap(map[uint32]float64{7: float64(i + 1)}), Attributes{"id": i})
+	}
+
+	for i, dp := range denseItems {
+		dp.Attributes = Attributes{"id": i}
+	}
+
+	dense, err := NewFlatIndex(2, denseItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sparse, err := NewSparseIndex(sparseItems, NewSparseDotProductDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range []struct {
+		alpha    float64
+		expected string
+	}{
+		{alpha: 1, expected: "[0 1 2 3 4]"},
+		{alpha: 0, expected: "[4 3 2 1 0]"},
+		{alpha: 0.7, expected: "[2 1 0 4 3]"},
+	} {
+		fusion, err := NewWeightedSumFusion(c.alpha)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := NewHybridIndex[int, float64](dense, sparse, fusion).Search(query, sparseQuery, 5, DefaultBuckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]int, len(*results))
+		for j, res := range *results {
+			ids[j] = res.ID
+
+			if res.Distance != -res.Score {
+				t.Fatalf("expected the distance to be the negative score, got %v", res)
+			}
+
+			if (res.Vector == nil) != (res.ID == 4) {
+				t.Fatalf("expected the dense embedding for the items of the dense index, got %v", res)
+			}
+		}
+
+		if fmt.Sprint(ids) != c.expected {
+			t.Fatalf("%d-th case: expected %s, got %v", i, c.expected, ids)
+		}
+	}
+
+	rrf, err := NewReciprocalRankFusion(DefaultRRFConstant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hybrid := NewHybridIndex[int, float64](dense, sparse, rrf)
+
+	// item 0 ranks first in the dense and last in the sparse results, which still beats all items ranking in the middle of both
+	results, err := hybrid.Search(query, sparseQuery, 5, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*results) != 5 || (*results)[0].ID != 0 || math.Abs((*results)[0].Score-(1.0/61+1.0/65)) > 1e-15 {
+		t.Fatalf("expected item 0 with a score of 1/61 + 1/65, got %v", *results)
+	}
+
+	results, err = hybrid.Search(query, sparseQuery, 10, DefaultBuckets, WithFilter(In("id", 1, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*results) != 2 || (*results)[0].ID != 1 || (*results)[1].ID != 4 {
+		t.Fatalf("expected the items 1 and 4, got %v", *results)
+	}
+
+	if _, err := hybrid.Search(query[1:], sparseQuery, 10, DefaultBuckets); !errors.Is(err, errShapeMismatch) {
+		t.Fatalf("expected errShapeMismatch, got %v", err)
+	}
+}
@@ -2,8 +2,11 @@ package index
 
 import (
 	"container/heap"
+	"context"
+	"fmt"
 	"math"
 	"math/rand"
+	"runtime"
 	"sort"
 	"sync"
 	"time"
@@ -15,72 +18,164 @@ import (
 const (
 	minDataPointsRequired = 2
 	DefaultBuckets        = 10.0
+	// number of consecutive leaves per tree without new results after which a radius search stops
+	radiusSearchPatience = 2
 )
 
-type DataPoint[T comparable] struct {
-	ID        T
-	Embedding []float64
+// DataPoint is an embedding identified by an ID of type T, F is the element type of the embedding.
+type DataPoint[T comparable, F Float] struct {
+	ID         T
+	Embedding  []F
+	Attributes Attributes
 }
 
-type SearchResult[T comparable] struct {
-	ID       T
+// SearchResult is a data point found by a search.
+// Results are ordered by increasing Distance, which is the same as decreasing Score.
+type SearchResult[T comparable, F Float] struct {
+	ID T
+	// Distance between the query and the data point as defined by ScoredDistanceMeasure.Distance,
+	// e.g. 1 - cos for the cosine and the euclidean distance for the euclidean distance measure
 	Distance float64
-	Vector   []float64
+	// Score is the similarity of the query and the data point as defined by ScoredDistanceMeasure.Similarity,
+	// e.g. cos for the cosine and 1 / (1 + distance) for the euclidean distance measure
+	Score  float64
+	Vector []F
 }
 
-func NewDataPoint[T comparable](id T, embedding []float64) *DataPoint[T] {
-	return &DataPoint[T]{id, embedding}
+// newSearchResult creates the search result of a data point, value is the value calculated by the distance measure.
+func newSearchResult[T comparable, F Float](distanceMeasure DistanceMeasure[F], id T, value float64, vector []F) SearchResult[T, F] {
+	distance, score := distanceAndScore(distanceMeasure, value)
+
+	return SearchResult[T, F]{ID: id, Distance: distance, Score: score, Vector: vector}
+}
+
+func NewDataPoint[T comparable, F Float](id T, embedding []F) *DataPoint[T, F] {
+	return &DataPoint[T, F]{ID: id, Embedding: embedding}
 }
 
-// T is the type of the identifier used to identify data points
-type VectorIndex[T comparable] struct {
+// NewDataPointWithAttributes creates a data point carrying metadata that can be used to filter search results.
+func NewDataPointWithAttributes[T comparable, F Float](id T, embedding []F, attributes Attributes) *DataPoint[T, F] {
+	return &DataPoint[T, F]{ID: id, Embedding: embedding, Attributes: attributes}
+}
+
+// Index is implemented by all index types, so callers can swap the underlying structure.
+type Index[T comparable, F Float] interface {
+	AddDataPoint(dataPoint *DataPoint[T, F]) error
+	UpsertDataPoint(dataPoint *DataPoint[T, F]) error
+	DeleteDataPoint(id T) error
+	SearchByVector(input []F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error)
+	SearchByVectorContext(ctx context.Context, input []F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error)
+	SearchByItem(id T, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error)
+}
+
+var _ Index[int, float64] = (*VectorIndex[int, float64])(nil)
+
+// T is the type of the identifier used to identify data points, F is the element type of the embeddings.
+// All methods are safe for concurrent use: searches run in parallel, while Build, adding, upserting and deleting data points,
+// Quantize and SetStorage wait for the running searches and block new ones until they are done.
+// The fields must not be modified while the index is in use.
+type VectorIndex[T comparable, F Float] struct {
 	NumberOfRoots        int
 	NumberOfDimensions   int
 	MaxItemsPerLeafNode  int
-	Roots                []*treeNode[T]
-	IDToTreeNodeMapping  map[string]*treeNode[T]
-	IDToDataPointMapping map[T]*DataPoint[T]
-	DataPoints           []*DataPoint[T]
-	DistanceMeasure      DistanceMeasure
-	Mutex                *sync.Mutex
+	Roots                []*treeNode[T, F]
+	IDToTreeNodeMapping  map[string]*treeNode[T, F]
+	IDToDataPointMapping map[T]*DataPoint[T, F]
+	DataPoints           []*DataPoint[T, F]
+	DistanceMeasure      DistanceMeasure[F]
+	// Mutex guards IDToTreeNodeMapping while the trees of all roots are built or updated in parallel
+	Mutex *sync.Mutex
+
+	// scores the search candidates by their product quantization codes if set, see Quantize
+	quantizer *ProductQuantizer[F]
+	codes     map[T][]byte
+	// holds the embeddings if they are not stored as float64, see SetStorage
+	storage embeddingStorage[T, F]
+	// largest norm of the data points when the trees were built, used to augment the embeddings for inner product search
+	maxNorm float64
+	// the embeddings are L2 normalized, norms holds the magnitudes of the original embeddings, see WithNormalization
+	normalized bool
+	norms      map[T]float64
+	// lock is held for reading by searches and for writing by all methods modifying the index
+	lock sync.RWMutex
 }
 
-func NewVectorIndex[T comparable](numberOfRoots int, numberOfDimensions int, maxIetmsPerLeafNode int, dataPoints []*DataPoint[T], distanceMeasure DistanceMeasure) (*VectorIndex[T], error) {
+func NewVectorIndex[T comparable, F Float](numberOfRoots int, numberOfDimensions int, maxIetmsPerLeafNode int, dataPoints []*DataPoint[T, F], distanceMeasure DistanceMeasure[F], opts ...IndexOption) (*VectorIndex[T, F], error) {
 	for _, dp := range dataPoints {
 		if len(dp.Embedding) != numberOfDimensions {
 			return nil, errShapeMismatch
 		}
 	}
 
-	idToDataPointMapping := make(map[T]*DataPoint[T], len(dataPoints))
+	options := newIndexOptions(opts)
+
+	var norms map[T]float64
+
+	if options.normalize {
+		if scored, ok := distanceMeasure.(ScoredDistanceMeasure[F]); !ok || !scored.PreNormalize() {
+			return nil, fmt.Errorf("%w: the distance measure depends on the magnitude of the embeddings", errInvalidParameter)
+		}
+
+		// normalize copies of the data points, the embeddings of the caller stay untouched
+		norms = make(map[T]float64, len(dataPoints))
+		normalized := make([]*DataPoint[T, F], len(dataPoints))
+
+		for i, dp := range dataPoints {
+			normalized[i], norms[dp.ID] = normalizedDataPoint(dp)
+		}
+
+		dataPoints = normalized
+	}
+
+	idToDataPointMapping := make(map[T]*DataPoint[T, F], len(dataPoints))
 	for _, dp := range dataPoints {
 		idToDataPointMapping[dp.ID] = dp
 	}
 
 	rand.Seed(time.Now().UnixNano())
 
-	return &VectorIndex[T]{
+	return &VectorIndex[T, F]{
 		NumberOfRoots:        numberOfRoots,
 		NumberOfDimensions:   numberOfDimensions,
 		MaxItemsPerLeafNode:  maxIetmsPerLeafNode,
-		Roots:                make([]*treeNode[T], numberOfRoots),
+		Roots:                make([]*treeNode[T, F], numberOfRoots),
 		IDToDataPointMapping: idToDataPointMapping,
-		IDToTreeNodeMapping:  map[string]*treeNode[T]{},
+		IDToTreeNodeMapping:  map[string]*treeNode[T, F]{},
 		DataPoints:           dataPoints,
 		DistanceMeasure:      distanceMeasure,
 		Mutex:                &sync.Mutex{},
+		normalized:           options.normalize,
+		norms:                norms,
 	}, nil
 }
 
-func (vi *VectorIndex[T]) Build() {
+// Build creates the trees of the index.
+// With the inner product distance measure the trees are built on the embeddings x augmented by the coordinate sqrt(M² - |x|²),
+// M being the largest norm of all data points. Queries are augmented by 0, which turns maximum inner product search
+// into nearest neighbour search. Data points added later on whose norm exceeds M are augmented by 0.
+func (vi *VectorIndex[T, F]) Build() {
+	vi.lock.Lock()
+	defer vi.lock.Unlock()
+
+	if vi.mips() {
+		vi.maxNorm = 0
+
+		for _, dp := range vi.DataPoints {
+			embedding := vi.embedding(dp, nil)
+			vi.maxNorm = math.Max(vi.maxNorm, math.Sqrt(imath.VectorDotProduct(embedding, embedding)))
+		}
+	}
+
 	for i := 0; i < vi.NumberOfRoots; i++ {
-		normalVec := vi.GetNormalVector(vi.DataPoints)
-		rootNode := &treeNode[T]{
+		normalVec, offset := vi.splitHyperplane(vi.DataPoints)
+		rootNode := &treeNode[T, F]{
 			nodeID:    uuid.New().String(),
 			index:     vi,
 			normalVec: normalVec,
+			offset:    offset,
 			left:      nil,
 			right:     nil,
+			leaves:    make(map[T]*treeNode[T, F], len(vi.DataPoints)),
 		}
 		vi.Roots[i] = rootNode
 		vi.IDToTreeNodeMapping[rootNode.nodeID] = rootNode
@@ -101,14 +196,176 @@ func (vi *VectorIndex[T]) Build() {
 	wg.Wait()
 }
 
-func (vi *VectorIndex[T]) AddDataPoint(dataPoint *DataPoint[T]) error {
+// AddDataPoint inserts a new data point into all trees of the index.
+// Returns ErrDataPointExists if the ID is already indexed, use UpsertDataPoint to replace existing data points.
+func (vi *VectorIndex[T, F]) AddDataPoint(dataPoint *DataPoint[T, F]) error {
+	vi.lock.Lock()
+	defer vi.lock.Unlock()
+
+	return vi.addDataPoint(dataPoint)
+}
+
+func (vi *VectorIndex[T, F]) addDataPoint(dataPoint *DataPoint[T, F]) error {
 	if len(dataPoint.Embedding) != vi.NumberOfDimensions {
 		return errShapeMismatch
 	}
 
+	if !vi.built() {
+		return errIndexNotBuilt
+	}
+
+	if _, ok := vi.IDToDataPointMapping[dataPoint.ID]; ok {
+		return fmt.Errorf("%w: %v", ErrDataPointExists, dataPoint.ID)
+	}
+
+	dataPoint = vi.normalize(dataPoint)
+
+	if err := vi.encode(dataPoint); err != nil {
+		return err
+	}
+
+	dataPoint = vi.store(dataPoint)
+
 	vi.DataPoints = append(vi.DataPoints, dataPoint)
 	vi.IDToDataPointMapping[dataPoint.ID] = dataPoint
 
+	vi.insert(dataPoint)
+
+	return nil
+}
+
+// UpsertDataPoint adds the data point if its ID is not indexed yet, otherwise it replaces the existing data point.
+// If the embedding changed, the item is relocated in every tree, otherwise only the attributes are replaced.
+func (vi *VectorIndex[T, F]) UpsertDataPoint(dataPoint *DataPoint[T, F]) error {
+	vi.lock.Lock()
+	defer vi.lock.Unlock()
+
+	if len(dataPoint.Embedding) != vi.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	if !vi.built() {
+		return errIndexNotBuilt
+	}
+
+	existing, ok := vi.IDToDataPointMapping[dataPoint.ID]
+	if !ok {
+		return vi.addDataPoint(dataPoint)
+	}
+
+	dataPoint = vi.normalize(dataPoint)
+
+	if vi.unchanged(existing, dataPoint.Embedding) {
+		// the item stays in place, the stored embedding is kept as it might be encoded
+		vi.replace(&DataPoint[T, F]{ID: existing.ID, Embedding: existing.Embedding, Attributes: dataPoint.Attributes})
+
+		return nil
+	}
+
+	if err := vi.encode(dataPoint); err != nil {
+		return err
+	}
+
+	vi.remove(existing)
+
+	dataPoint = vi.store(dataPoint)
+
+	vi.replace(dataPoint)
+	vi.insert(dataPoint)
+
+	return nil
+}
+
+// replace stores the data point in place of the indexed data point with the same ID.
+func (vi *VectorIndex[T, F]) replace(dataPoint *DataPoint[T, F]) {
+	for i, dp := range vi.DataPoints {
+		if dp.ID == dataPoint.ID {
+			vi.DataPoints[i] = dataPoint
+
+			break
+		}
+	}
+
+	vi.IDToDataPointMapping[dataPoint.ID] = dataPoint
+}
+
+// built reports whether the trees of all roots have been created by Build.
+func (vi *VectorIndex[T, F]) built() bool {
+	for _, root := range vi.Roots {
+		if root == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// insert adds the data point to the trees of all roots.
+func (vi *VectorIndex[T, F]) insert(dataPoint *DataPoint[T, F]) {
+	embedding := vi.treeVector(dataPoint, nil)
+
+	var wg sync.WaitGroup
+
+	wg.Add(vi.NumberOfRoots)
+
+	for _, rootNode := range vi.Roots {
+		rootNode := rootNode
+		go func() {
+			defer wg.Done()
+			rootNode.insert(dataPoint.ID, embedding)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// DeleteDataPoint removes the data point with the given ID from the index and all of its trees.
+func (vi *VectorIndex[T, F]) DeleteDataPoint(id T) error {
+	vi.lock.Lock()
+	defer vi.lock.Unlock()
+
+	return vi.deleteDataPoint(id)
+}
+
+func (vi *VectorIndex[T, F]) deleteDataPoint(id T) error {
+	if !vi.built() {
+		return errIndexNotBuilt
+	}
+
+	dataPoint, ok := vi.IDToDataPointMapping[id]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	vi.remove(dataPoint)
+
+	delete(vi.IDToDataPointMapping, id)
+	delete(vi.codes, id)
+	delete(vi.norms, id)
+
+	if vi.storage != nil {
+		vi.storage.delete(id)
+	}
+
+	for i, dp := range vi.DataPoints {
+		if dp.ID != id {
+			continue
+		}
+
+		copy(vi.DataPoints[i:], vi.DataPoints[i+1:])
+		vi.DataPoints[len(vi.DataPoints)-1] = nil
+		vi.DataPoints = vi.DataPoints[:len(vi.DataPoints)-1]
+
+		break
+	}
+
+	return nil
+}
+
+// remove deletes the data point from the trees of all roots.
+func (vi *VectorIndex[T, F]) remove(dataPoint *DataPoint[T, F]) {
+	embedding := vi.treeVector(dataPoint, nil)
+
 	var wg sync.WaitGroup
 
 	wg.Add(vi.NumberOfRoots)
@@ -117,103 +374,458 @@ func (vi *VectorIndex[T]) AddDataPoint(dataPoint *DataPoint[T]) error {
 		rootNode := rootNode
 		go func() {
 			defer wg.Done()
-			rootNode.insert(dataPoint)
+			rootNode.remove(dataPoint.ID, embedding)
 		}()
 	}
 
 	wg.Wait()
+}
+
+// Quantize encodes all data points with the trained product quantizer, data points added later on are encoded as well.
+// Afterwards searches rank the candidates by the distances between the query and the codes, which only approximate the actual distances.
+// The trees and re-ranking the best candidates, see WithReRank, still need embeddings, so the index has to store them in a compact
+// format first: with StorageInt8 a data point takes one byte per dimension plus NumberOfSubspaces bytes for its code,
+// instead of 4 or 8 bytes per dimension. Returns errInvalidParameter if the index uses StorageFloat64, see SetStorage.
+// The quantizer is not persisted by Save, it has to be set again after loading the index.
+func (vi *VectorIndex[T, F]) Quantize(pq *ProductQuantizer[F]) error {
+	vi.lock.Lock()
+	defer vi.lock.Unlock()
+
+	if pq.Codebooks == nil {
+		return errQuantizerNotTrained
+	}
+
+	if vi.storage == nil {
+		return fmt.Errorf("%w: quantizing requires StorageFloat16 or StorageInt8", errInvalidParameter)
+	}
+
+	if pq.NumberOfDimensions != vi.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	codes := make(map[T][]byte, len(vi.DataPoints))
+	buf := make([]F, vi.NumberOfDimensions)
+
+	for _, dp := range vi.DataPoints {
+		code, err := pq.Encode(vi.embedding(dp, buf))
+		if err != nil {
+			return err
+		}
+
+		codes[dp.ID] = code
+	}
+
+	vi.quantizer = pq
+	vi.codes = codes
+
+	return nil
+}
+
+// Quantizer returns the product quantizer set by Quantize, or nil if the index is not quantized.
+func (vi *VectorIndex[T, F]) Quantizer() *ProductQuantizer[F] {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	return vi.quantizer
+}
+
+// encode stores the code of the data point if the index is quantized.
+func (vi *VectorIndex[T, F]) encode(dataPoint *DataPoint[T, F]) error {
+	if vi.quantizer == nil {
+		return nil
+	}
+
+	code, err := vi.quantizer.Encode(dataPoint.Embedding)
+	if err != nil {
+		return err
+	}
+
+	vi.codes[dataPoint.ID] = code
 
 	return nil
 }
 
+// SearchByVector returns the searchNum nearest neighbours of input.
+// numberOfBuckets controls how many candidates (searchNum * numberOfBuckets) are collected from the trees before they are ranked.
+func (vi *VectorIndex[T, F]) SearchByVector(input []F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	return vi.SearchByVectorContext(context.Background(), input, searchNum, numberOfBuckets, opts...)
+}
+
+// SearchByVectorContext works like SearchByVector but stops searching once the context is done.
+// It returns the context's error unless WithPartialResults is given, in which case the best results found so far are returned.
+func (vi *VectorIndex[T, F]) SearchByVectorContext(ctx context.Context, input []F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	return vi.search(ctx, newSearchScratch[T, F](), input, searchNum, numberOfBuckets, newSearchOptions(opts))
+}
+
 // nolint: funlen, cyclop
-func (vi *VectorIndex[T]) SearchByVector(input []float64, searchNum int, numberOfBuckets float64) (*[]SearchResult[T], error) {
+func (vi *VectorIndex[T, F]) search(ctx context.Context, scratch *searchScratch[T, F], input []F, searchNum int, numberOfBuckets float64, options *searchOptions) (*[]SearchResult[T, F], error) {
 	if len(input) != vi.NumberOfDimensions {
 		return nil, errShapeMismatch
 	}
 
+	scratch.reset()
+
+	if vi.normalized {
+		input = scratch.normalizedQuery(input)
+	}
+
+	checker := newContextChecker(ctx)
 	totalBucketSize := int(float64(searchNum) * numberOfBuckets)
-	annMap := make(map[T]struct{}, totalBucketSize)
-	pq := priorityQueue{}
+	// distances of the collected candidates, calculated as soon as a candidate is found
+	idToDist := scratch.idToDist
+	distance := vi.candidateDistance(scratch, input)
+
+	// search all trees until we found enough data points
+	err := vi.walkLeaves(scratch, input, checker, func(leaf *treeNode[T, F]) (bool, error) {
+		for _, id := range leaf.items {
+			if _, ok := idToDist[id]; ok {
+				continue
+			}
+
+			if err := checker.err(); err != nil {
+				return false, err
+			}
+
+			dp, ok := vi.matchingDataPoint(scratch, id, options)
+			if !ok {
+				continue
+			}
+
+			idToDist[id] = distance(dp)
+		}
+
+		return len(idToDist) < totalBucketSize, nil
+	})
+	if err != nil && !(checker.done && options.partialResults) {
+		return nil, err
+	}
+
+	ann := scratch.ann
+	for id := range idToDist {
+		ann = append(ann, id)
+	}
+
+	scratch.ann = ann
+
+	// sort the found items by their actual distance
+	sort.Slice(ann, func(i, j int) bool {
+		return idToDist[ann[i]] < idToDist[ann[j]]
+	})
+
+	// replace the approximated distances of the best candidates by their exact distances
+	if vi.quantizer != nil && options.reRank > 0 {
+		reRank := ann[:imath.Min(imath.Max(options.reRank, searchNum), len(ann))]
+		for _, id := range reRank {
+			embedding := vi.embedding(vi.IDToDataPointMapping[id], scratch.buffer(vi.NumberOfDimensions))
+			idToDist[id] = vi.distanceMeasure().CalcDistance(embedding, input)
+		}
+
+		sort.Slice(reRank, func(i, j int) bool {
+			return idToDist[reRank[i]] < idToDist[reRank[j]]
+		})
+	}
+
+	// return the top n items
+	if len(ann) > searchNum {
+		ann = ann[:searchNum]
+	}
+
+	searchResults := make([]SearchResult[T, F], len(ann))
+	for i, id := range ann {
+		searchResults[i] = newSearchResult(vi.DistanceMeasure, id, idToDist[id], vi.embedding(vi.IDToDataPointMapping[id], nil))
+	}
+
+	return &searchResults, nil
+}
+
+// candidateDistance returns the function used to calculate the distances between input and the search candidates.
+func (vi *VectorIndex[T, F]) candidateDistance(scratch *searchScratch[T, F], input []F) func(dp *DataPoint[T, F]) float64 {
+	if vi.quantizer == nil {
+		buf := scratch.buffer(vi.NumberOfDimensions)
+
+		return func(dp *DataPoint[T, F]) float64 {
+			return vi.distanceMeasure().CalcDistance(vi.embedding(dp, buf), input)
+		}
+	}
+
+	table := vi.quantizer.distanceTable(input, vi.DistanceMeasure)
+
+	return func(dp *DataPoint[T, F]) float64 {
+		return table.distance(vi.codes[dp.ID])
+	}
+}
+
+// walkLeaves visits the leaf nodes of all trees, starting with the leaves closest to the input,
+// until visit returns false, all leaves have been visited or an error occurred.
+func (vi *VectorIndex[T, F]) walkLeaves(scratch *searchScratch[T, F], input []F, checker *contextChecker, visit func(leaf *treeNode[T, F]) (bool, error)) error {
+	pq := scratch.pq
+
+	// keep the grown queue for the next search
+	defer func() { scratch.pq = pq }()
 
 	// insert root nodes into pq
 	for i, r := range vi.Roots {
-		pq = append(pq, &queueItem{r.nodeID, i, math.Inf(-1)})
+		if r == nil {
+			return errIndexNotBuilt
+		}
+
+		pq = append(pq, &queueItem[string]{r.nodeID, i, math.Inf(-1)})
 	}
 
 	heap.Init(&pq)
 
-	// search all trees until we found enough data points
-	for pq.Len() > 0 && len(annMap) < totalBucketSize {
-		q, _ := heap.Pop(&pq).(*queueItem)
+	for pq.Len() > 0 {
+		if err := checker.err(); err != nil {
+			return err
+		}
+
+		q, _ := heap.Pop(&pq).(*queueItem[string])
 		n, ok := vi.IDToTreeNodeMapping[q.value]
 
 		if !ok {
-			return nil, errInvalidIndex
+			return errInvalidIndex
 		}
 
-		if len(n.items) > 0 {
-			for _, id := range n.items {
-				annMap[id] = struct{}{}
+		if n.isLeaf() {
+			next, err := visit(n)
+			if err != nil || !next {
+				return err
 			}
 
 			continue
 		}
 
-		dp := imath.VectorDotProduct(n.normalVec, input)
-		heap.Push(&pq, &queueItem{
+		// the normal vectors of inner product indexes have an additional dimension, which is 0 for queries
+		dp := n.margin(input)
+		heap.Push(&pq, &queueItem[string]{
 			value:    n.left.nodeID,
 			priority: imath.Max(q.priority, dp),
 		})
-		heap.Push(&pq, &queueItem{
+		heap.Push(&pq, &queueItem[string]{
 			value:    n.right.nodeID,
 			priority: imath.Max(q.priority, -dp),
 		})
 	}
 
-	// calculate actual distances
-	idToDist := make(map[T]float64, len(annMap))
-	ann := make([]T, 0, len(annMap))
+	return nil
+}
 
-	for id := range annMap {
-		ann = append(ann, id)
-		idToDist[id] = vi.DistanceMeasure.CalcDistance(vi.IDToDataPointMapping[id].Embedding, input)
+// matchingDataPoint returns the data point if it matches the filter of the search.
+// Rejected items are remembered, so they don't have to be checked again when found in another tree.
+func (vi *VectorIndex[T, F]) matchingDataPoint(scratch *searchScratch[T, F], id T, options *searchOptions) (*DataPoint[T, F], bool) {
+	dp := vi.IDToDataPointMapping[id]
+
+	if options.filter == nil {
+		return dp, true
 	}
 
-	// sort the found items by their actual distance
-	sort.Slice(ann, func(i, j int) bool {
-		return idToDist[ann[i]] < idToDist[ann[j]]
+	if _, ok := scratch.rejected[id]; ok {
+		return nil, false
+	}
+
+	if !options.filter.Match(dp.Attributes) {
+		scratch.rejected[id] = struct{}{}
+
+		return nil, false
+	}
+
+	return dp, true
+}
+
+// SearchWithinRadius returns all data points whose distance to input is at most radius.
+// The radius refers to the Distance of the search results, e.g. 1 - cos for the cosine distance measure.
+// The trees are searched as long as new data points within the radius keep appearing in the visited leaves.
+// The results are sorted by distance and limited to maxResults, if maxResults is positive.
+func (vi *VectorIndex[T, F]) SearchWithinRadius(input []F, radius float64, maxResults int, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	if len(input) != vi.NumberOfDimensions {
+		return nil, errShapeMismatch
+	}
+
+	options := newSearchOptions(opts)
+	scratch := newSearchScratch[T, F]()
+	checker := newContextChecker(context.Background())
+	idToDist := scratch.idToDist
+	inRadius := scratch.ann
+	buf := scratch.buffer(vi.NumberOfDimensions)
+
+	if vi.normalized {
+		input = scratch.normalizedQuery(input)
+	}
+
+	// give every tree the chance to contribute before we stop searching
+	patience := vi.NumberOfRoots * radiusSearchPatience
+	misses := 0
+
+	err := vi.walkLeaves(scratch, input, checker, func(leaf *treeNode[T, F]) (bool, error) {
+		found := false
+
+		for _, id := range leaf.items {
+			if _, ok := idToDist[id]; ok {
+				continue
+			}
+
+			dp, ok := vi.matchingDataPoint(scratch, id, options)
+			if !ok {
+				continue
+			}
+
+			dist := vi.distanceMeasure().CalcDistance(vi.embedding(dp, buf), input)
+			idToDist[id] = dist
+
+			if distance, _ := distanceAndScore(vi.DistanceMeasure, dist); distance <= radius {
+				inRadius = append(inRadius, id)
+				found = true
+			}
+		}
+
+		if found {
+			misses = 0
+		} else {
+			misses++
+		}
+
+		return misses < patience, nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	// return the top n items
-	if len(ann) > searchNum {
-		ann = ann[:searchNum]
+	sort.Slice(inRadius, func(i, j int) bool {
+		return idToDist[inRadius[i]] < idToDist[inRadius[j]]
+	})
+
+	if maxResults > 0 && len(inRadius) > maxResults {
+		inRadius = inRadius[:maxResults]
 	}
 
-	searchResults := make([]SearchResult[T], len(ann))
-	for i, id := range ann {
-		searchResults[i] = SearchResult[T]{ID: id, Distance: math.Abs(idToDist[id]), Vector: vi.IDToDataPointMapping[id].Embedding}
+	searchResults := make([]SearchResult[T, F], len(inRadius))
+	for i, id := range inRadius {
+		searchResults[i] = newSearchResult(vi.DistanceMeasure, id, idToDist[id], vi.embedding(vi.IDToDataPointMapping[id], nil))
 	}
 
 	return &searchResults, nil
 }
 
-func (vi *VectorIndex[T]) SearchByItem() ([]int, error) {
-	return nil, nil
+// SearchBatch answers many queries in parallel using a bounded pool of workers, see WithConcurrency.
+// The returned results and errors are aligned with the queries.
+func (vi *VectorIndex[T, F]) SearchBatch(queries [][]F, searchNum int, numberOfBuckets float64, opts ...SearchOption) ([]*[]SearchResult[T, F], []error) {
+	options := newSearchOptions(opts)
+	results := make([]*[]SearchResult[T, F], len(queries))
+	errs := make([]error, len(queries))
+
+	workers := options.concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	workers = imath.Min(workers, len(queries))
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			// every worker reuses its buffers for all of its queries
+			scratch := newSearchScratch[T, F]()
+			for i := range jobs {
+				// the lock is taken per query, so modifications of the index don't have to wait for the whole batch
+				vi.lock.RLock()
+				results[i], errs[i] = vi.search(context.Background(), scratch, queries[i], searchNum, numberOfBuckets, options)
+				vi.lock.RUnlock()
+			}
+		}()
+	}
+
+	for i := range queries {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results, errs
+}
+
+// SearchByItem returns the nearest neighbours of a data point that is already part of the index.
+// The queried item itself is not included in the results.
+func (vi *VectorIndex[T, F]) SearchByItem(id T, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	dp, ok := vi.IDToDataPointMapping[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	// search for one additional item since the queried item will most likely be part of the results
+	results, err := vi.search(context.Background(), newSearchScratch[T, F](), vi.embedding(dp, nil), searchNum+1, numberOfBuckets, newSearchOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutItem(results, id, searchNum), nil
+}
+
+// withoutItem removes the item with the given ID from the results and limits them to searchNum items.
+func withoutItem[T comparable, F Float](results *[]SearchResult[T, F], id T, searchNum int) *[]SearchResult[T, F] {
+	searchResults := make([]SearchResult[T, F], 0, len(*results))
+
+	for _, r := range *results {
+		if r.ID == id {
+			continue
+		}
+
+		searchResults = append(searchResults, r)
+	}
+
+	if len(searchResults) > searchNum {
+		searchResults = searchResults[:searchNum]
+	}
+
+	return &searchResults
 }
 
 const (
 	cosineMetricsMaxIteration      = 200
 	cosineMetricsMaxTargetSample   = 100
 	cosineMetricsTwoMeansThreshold = 0.7
-	cosineMetricsCentroidCalcRatio = 0.0001
 )
 
 // GetNormalVector calculates the normal vector of a hyperplane that separates
-// the two clusters of data points.
+// the two clusters of data points, see splitHyperplane.
+func (vi *VectorIndex[T, F]) GetNormalVector(dataPoints []*DataPoint[T, F]) []F {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	normalVec, _ := vi.splitHyperplane(dataPoints)
+
+	return normalVec
+}
+
+// splitHyperplane calculates the normal vector and the offset of a hyperplane that separates
+// the two clusters of data points. A vector x lies on the left side of the hyperplane if normal·x + offset < 0.
+// The clusters are found by two-means clustering on a sample of the data points, every sampled vector is assigned
+// to the centroid that is closer according to the DistanceMeasure. Only the order of the distances is used,
+// so measures that are not metrics, like cosine or Minkowski with p < 1, split the data points as well.
+// The centroids are the means of their clusters, which is not the minimizer of every measure (e.g. the median for manhattan),
+// but a good enough approximation to separate two groups of data points.
+// For angular measures the hyperplane passes through the origin. For euclidean and the other translation invariant
+// measures the hyperplane is equidistant to both centroids, so the offset is -(|c0|² - |c1|²) / 2 with the normal c0 - c1.
 // nolint: funlen, gocognit, cyclop, gosec
-func (vi *VectorIndex[T]) GetNormalVector(dataPoints []*DataPoint[T]) []float64 {
-	lvs := len(dataPoints)
+func (vi *VectorIndex[T, F]) splitHyperplane(dataPoints []*DataPoint[T, F]) ([]F, float64) {
+	dims := vi.treeDimensions()
+	distanceMeasure := vi.splitDistanceMeasure()
 	// Initialize two centroids randomly from the data points.
 	c0, c1 := vi.getRandomCentroids(dataPoints)
 
@@ -222,35 +834,27 @@ func (vi *VectorIndex[T]) GetNormalVector(dataPoints []*DataPoint[T]) []float64
 	for i := 0; i < cosineMetricsMaxIteration; i++ {
 		// Create a map from cluster ID to a slice of vectors assigned to that
 		// cluster during clustering.
-		clusterToVecs := map[int][][]float64{}
+		clusterToVecs := map[int][][]F{}
 
 		// Randomly sample a subset of the data points.
 		iter := imath.Min(cosineMetricsMaxTargetSample, len(dataPoints))
 
 		// Assign each of the sampled vectors to the cluster with the nearest centroid.
 		for i := 0; i < iter; i++ {
-			v := dataPoints[rand.Intn(len(dataPoints))].Embedding
-			ip0 := vi.DistanceMeasure.CalcDistance(c0, v)
-			ip1 := vi.DistanceMeasure.CalcDistance(c1, v)
+			v := vi.treeVector(dataPoints[rand.Intn(len(dataPoints))], nil)
+			dist0 := distanceMeasure.CalcDistance(c0, v)
+			dist1 := distanceMeasure.CalcDistance(c1, v)
 
-			if ip0 > ip1 {
+			if dist0 < dist1 {
 				clusterToVecs[0] = append(clusterToVecs[0], v)
 			} else {
 				clusterToVecs[1] = append(clusterToVecs[1], v)
 			}
 		}
 
-		// Calculate the ratio of data points assigned to each cluster. If the
-		// ratio is below a threshold, the clustering is considered to be
-		// sufficiently separated, and the algorithm terminates.
 		lc0 := len(clusterToVecs[0])
 		lc1 := len(clusterToVecs[1])
 
-		if (float64(lc0)/float64(iter) <= cosineMetricsTwoMeansThreshold) &&
-			(float64(lc1)/float64(iter) <= cosineMetricsTwoMeansThreshold) {
-			break
-		}
-
 		// If one of the clusters has no data points assigned to it, re-initialize
 		// the centroids randomly and continue.
 		if lc0 == 0 || lc1 == 0 {
@@ -260,40 +864,61 @@ func (vi *VectorIndex[T]) GetNormalVector(dataPoints []*DataPoint[T]) []float64
 		}
 
 		// Update the centroids based on the data points assigned to each cluster
-		c0 = make([]float64, vi.NumberOfDimensions)
-		it0 := int(float64(lvs) * cosineMetricsCentroidCalcRatio)
-
-		for i := 0; i < it0; i++ {
-			for d := 0; d < vi.NumberOfDimensions; d++ {
-				c0[d] += clusterToVecs[0][rand.Intn(lc0)][d] / float64(it0)
-			}
-		}
+		c0 = meanVector(clusterToVecs[0], dims)
+		c1 = meanVector(clusterToVecs[1], dims)
 
-		c1 = make([]float64, vi.NumberOfDimensions)
-		it1 := int(float64(lvs)*cosineMetricsCentroidCalcRatio + 1)
-
-		for i := 0; i < int(float64(lc1)*cosineMetricsCentroidCalcRatio+1); i++ {
-			for d := 0; d < vi.NumberOfDimensions; d++ {
-				c1[d] += clusterToVecs[1][rand.Intn(lc1)][d] / float64(it1)
-			}
+		// Calculate the ratio of data points assigned to each cluster. If the
+		// ratio is below a threshold, the clustering is considered to be
+		// sufficiently separated, and the algorithm terminates. The centroids are
+		// updated before, so the normal vector is derived from the cluster means
+		// and not from the randomly chosen initial centroids.
+		if (float64(lc0)/float64(iter) <= cosineMetricsTwoMeansThreshold) &&
+			(float64(lc1)/float64(iter) <= cosineMetricsTwoMeansThreshold) {
+			break
 		}
 	}
 
 	// Create a new array to hold the resulting normal vector.
-	ret := make([]float64, vi.NumberOfDimensions)
+	ret := make([]F, dims)
 
 	// Calculate the normal vector by subtracting the coordinates of the second centroid from those of the first centroid.
 	// Store the resulting value in the corresponding coordinate of the ret slice.
-	for d := 0; d < vi.NumberOfDimensions; d++ {
+	for d := 0; d < dims; d++ {
 		v := c0[d] - c1[d]
 		ret[d] += v
 	}
 
-	return ret
+	var offset float64
+	if vi.offsetSplits() {
+		offset = -(imath.VectorDotProduct(c0, c0) - imath.VectorDotProduct(c1, c1)) / 2
+	}
+
+	// The lengths of the normal vectors of augmented embeddings vary strongly, normalize them
+	// so the margins of different nodes are comparable when searching the trees.
+	if norm := math.Sqrt(imath.VectorDotProduct(ret, ret)); vi.mips() && norm > 0 {
+		for d := range ret {
+			ret[d] /= F(norm)
+		}
+	}
+
+	return ret, offset
+}
+
+// meanVector returns the element-wise mean of the vectors.
+func meanVector[F Float](vectors [][]F, dims int) []F {
+	mean := make([]F, dims)
+
+	for _, v := range vectors {
+		for d := 0; d < dims; d++ {
+			mean[d] += v[d] / F(len(vectors))
+		}
+	}
+
+	return mean
 }
 
 // nolint: gosec
-func (vi *VectorIndex[T]) getRandomCentroids(dataPoints []*DataPoint[T]) ([]float64, []float64) {
+func (vi *VectorIndex[T, F]) getRandomCentroids(dataPoints []*DataPoint[T, F]) ([]F, []F) {
 	lvs := len(dataPoints)
 	k := rand.Intn(lvs)
 	l := rand.Intn(lvs - 1)
@@ -302,8 +927,132 @@ func (vi *VectorIndex[T]) getRandomCentroids(dataPoints []*DataPoint[T]) ([]floa
 		l++
 	}
 
-	c0 := dataPoints[k].Embedding
-	c1 := dataPoints[l].Embedding
+	c0 := vi.treeVector(dataPoints[k], nil)
+	c1 := vi.treeVector(dataPoints[l], nil)
 
 	return c0, c1
 }
+
+// mips reports whether the index answers maximum inner product searches.
+func (vi *VectorIndex[T, F]) mips() bool {
+	_, ok := vi.DistanceMeasure.(*innerProductDistanceMeasure[F])
+
+	return ok
+}
+
+// treeDimensions returns the number of dimensions of the vectors the trees are built on.
+func (vi *VectorIndex[T, F]) treeDimensions() int {
+	if vi.mips() {
+		return vi.NumberOfDimensions + 1
+	}
+
+	return vi.NumberOfDimensions
+}
+
+// offsetSplits reports whether the hyperplanes of the trees are placed between the centroids of the clusters they separate
+// instead of passing through the origin. This is the case for the measures that only depend on the difference of two vectors.
+func (vi *VectorIndex[T, F]) offsetSplits() bool {
+	switch vi.DistanceMeasure.(type) {
+	case *euclideanDistanceMeasure[F], *manhattanDistanceMeasure[F], *chebyshevDistanceMeasure[F], *minkowskiDistanceMeasure[F]:
+		return true
+	default:
+		return false
+	}
+}
+
+// splitDistanceMeasure returns the distance measure used to find the hyperplanes splitting the tree vectors.
+// The augmented vectors of inner product indexes are nearest neighbours by their euclidean distance.
+func (vi *VectorIndex[T, F]) splitDistanceMeasure() DistanceMeasure[F] {
+	if vi.mips() {
+		return NewEuclideanDistanceMeasure[F]()
+	}
+
+	return vi.distanceMeasure()
+}
+
+// distanceMeasure returns the measure used to calculate the distances between the stored embeddings and other vectors.
+// The cosine distance of normalized embeddings reduces to the dot product.
+func (vi *VectorIndex[T, F]) distanceMeasure() DistanceMeasure[F] {
+	if _, ok := vi.DistanceMeasure.(*cosineDistanceMeasure[F]); ok && vi.normalized {
+		return &unitCosineDistanceMeasure[F]{}
+	}
+
+	return vi.DistanceMeasure
+}
+
+// Magnitude returns the L2 norm of the embedding the data point was added with.
+// Indexes created WithNormalization store normalized embeddings, multiplying them by the magnitude restores the original ones.
+func (vi *VectorIndex[T, F]) Magnitude(id T) (float64, error) {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	dp, ok := vi.IDToDataPointMapping[id]
+	if !ok {
+		return 0, fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	if vi.normalized {
+		return vi.norms[id], nil
+	}
+
+	embedding := vi.embedding(dp, nil)
+
+	return math.Sqrt(imath.VectorDotProduct(embedding, embedding)), nil
+}
+
+// normalize returns a copy of the data point with a normalized embedding and remembers the original magnitude,
+// if the index normalizes its embeddings. Otherwise the data point is returned as it is.
+func (vi *VectorIndex[T, F]) normalize(dataPoint *DataPoint[T, F]) *DataPoint[T, F] {
+	if !vi.normalized {
+		return dataPoint
+	}
+
+	normalized, norm := normalizedDataPoint(dataPoint)
+	vi.norms[dataPoint.ID] = norm
+
+	return normalized
+}
+
+// normalizedDataPoint returns a copy of the data point with its embedding scaled to unit length and the original magnitude.
+func normalizedDataPoint[T comparable, F Float](dataPoint *DataPoint[T, F]) (*DataPoint[T, F], float64) {
+	embedding := make([]F, len(dataPoint.Embedding))
+	norm := normalizeInto(embedding, dataPoint.Embedding)
+
+	return &DataPoint[T, F]{ID: dataPoint.ID, Embedding: embedding, Attributes: dataPoint.Attributes}, norm
+}
+
+// normalizeInto writes v scaled to unit length into dst and returns the magnitude of v.
+// Zero vectors are copied as they are.
+func normalizeInto[F Float](dst, v []F) float64 {
+	norm := math.Sqrt(imath.VectorDotProduct(v, v))
+
+	for i := range v {
+		if norm == 0 {
+			dst[i] = v[i]
+		} else {
+			dst[i] = v[i] / F(norm)
+		}
+	}
+
+	return norm
+}
+
+// treeVector returns the vector the trees use to place the data point, see Build.
+// The vector is written to buf, which is allocated if it is nil.
+func (vi *VectorIndex[T, F]) treeVector(dataPoint *DataPoint[T, F], buf []F) []F {
+	if !vi.mips() {
+		return vi.embedding(dataPoint, buf)
+	}
+
+	if buf == nil {
+		buf = make([]F, vi.NumberOfDimensions+1)
+	}
+
+	embedding := vi.embedding(dataPoint, buf[:vi.NumberOfDimensions])
+	copy(buf, embedding)
+
+	norm := imath.VectorDotProduct(embedding, embedding)
+	buf[vi.NumberOfDimensions] = F(math.Sqrt(math.Max(0, vi.maxNorm*vi.maxNorm-norm)))
+
+	return buf[:vi.NumberOfDimensions+1]
+}
@@ -1,12 +1,19 @@
 package index
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
 	"sort"
 	"strconv"
+	"sync"
 	"testing"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+	itesting "github.com/tobias-mayer/vector-db/internal/testing"
 )
 
 // nolint: funlen, gocognit, cyclop, gosec
@@ -37,7 +44,7 @@ func TestIndex_SearchByVector(t *testing.T) {
 		c := c
 
 		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
-			rawItems := make([]*DataPoint[int], c.num)
+			rawItems := make([]*DataPoint[int, float64], c.num)
 			for i := range rawItems {
 				v := make([]float64, c.dim)
 
@@ -56,7 +63,7 @@ func TestIndex_SearchByVector(t *testing.T) {
 				rawItems[i] = NewDataPoint(i, v)
 			}
 
-			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure())
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -123,7 +130,7 @@ func TestIndex_AddAfterBuild(t *testing.T) {
 		c := c
 
 		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
-			rawItems := make([]*DataPoint[int], c.num)
+			rawItems := make([]*DataPoint[int, float64], c.num)
 			for i := range rawItems {
 				v := randVec(c.dim)
 
@@ -131,13 +138,13 @@ func TestIndex_AddAfterBuild(t *testing.T) {
 			}
 
 			// we currently need at least two initial data points to build the index
-			dataPointsToAdd := make([]*DataPoint[int], c.n)
+			dataPointsToAdd := make([]*DataPoint[int, float64], c.n)
 			for i := range dataPointsToAdd {
 				v := randVec(c.dim)
 				dataPointsToAdd[i] = NewDataPoint(c.num+i, v)
 			}
 
-			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure())
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -220,7 +227,7 @@ func TestIndex_SearchByVectoxStringIndexType(t *testing.T) {
 		c := c
 
 		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
-			rawItems := make([]*DataPoint[string], c.num)
+			rawItems := make([]*DataPoint[string, float64], c.num)
 			for i := range rawItems {
 				v := make([]float64, c.dim)
 
@@ -239,7 +246,7 @@ func TestIndex_SearchByVectoxStringIndexType(t *testing.T) {
 				rawItems[i] = NewDataPoint(strconv.Itoa(i), v)
 			}
 
-			idx, err := NewVectorIndex[string](c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure())
+			idx, err := NewVectorIndex[string](c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -286,53 +293,1590 @@ func TestIndex_SearchByVectoxStringIndexType(t *testing.T) {
 	}
 }
 
-// nolint: gosec
-func TestIndex_GetSplittingVector(t *testing.T) {
+// nolint: funlen, gocognit, cyclop
+func TestIndex_SearchByItem(t *testing.T) {
 	for i, c := range []struct {
-		dim, num int
+		k, dim, num, nTree, searchNum, queryID int
+		threshold, bucketScale                 float64
 	}{
 		{
-			dim: 5, num: 100,
+			k:           2,
+			dim:         20,
+			num:         10000,
+			nTree:       20,
+			threshold:   0.90,
+			searchNum:   200,
+			bucketScale: 20,
+			queryID:     42,
 		},
 	} {
 		c := c
 
 		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
-			vs := make([][]float64, c.num)
-			for i := 0; i < c.num; i++ {
-				v := make([]float64, c.dim)
-				for d := 0; d < c.dim; d++ {
-					v[d] = rand.Float64()
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint(i, randVec(c.dim))
+			}
+
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			query := rawItems[c.queryID].Embedding
+
+			// exact neighbors, excluding the queried item
+			aDist := map[int]float64{}
+			ids := make([]int, 0, len(rawItems)-1)
+			for i, v := range rawItems {
+				if i == c.queryID {
+					continue
 				}
-				vs[i] = v
+				ids = append(ids, i)
+				aDist[i] = idx.DistanceMeasure.CalcDistance(v.Embedding, query)
 			}
+			sort.Slice(ids, func(i, j int) bool {
+				return aDist[ids[i]] < aDist[ids[j]]
+			})
 
-			dp := make([]*DataPoint[int], c.num)
-			for i := 0; i < c.num; i++ {
-				dp[i] = NewDataPoint(i, vs[i])
+			expectedIDsMap := make(map[int]struct{}, c.searchNum)
+			for _, id := range ids[:c.searchNum] {
+				expectedIDsMap[id] = struct{}{}
+			}
+
+			ass, err := idx.SearchByItem(c.queryID, c.searchNum, c.bucketScale)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*ass) != c.searchNum {
+				t.Fatalf("expected %d results, got %d", c.searchNum, len(*ass))
+			}
+
+			var count int
+			for _, res := range *ass {
+				if res.ID == c.queryID {
+					t.Fatalf("queried item %d must not be part of the results", c.queryID)
+				}
+				if _, ok := expectedIDsMap[res.ID]; ok {
+					count++
+				}
+			}
+
+			if ratio := float64(count) / float64(c.searchNum); ratio < c.threshold {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, c.searchNum, ratio)
+			} else {
+				t.Logf("ratio of exact neighbors in approximated result: %d / %d = %f", count, c.searchNum, ratio)
+			}
+
+			if _, err := idx.SearchByItem(-1, c.searchNum, c.bucketScale); !errors.Is(err, ErrDataPointNotFound) {
+				t.Fatalf("expected ErrDataPointNotFound for unknown id, got %v", err)
 			}
-			idx, _ := NewVectorIndex(1, c.dim, 1, dp, NewCosineDistanceMeasure())
-			idx.GetNormalVector(dp)
 		})
 	}
 }
 
-// nolint: gosec
-func randVec(dim int) []float64 {
-	v := make([]float64, dim)
+// nolint: funlen, gocognit, cyclop, gosec
+func TestIndex_DeleteDataPoint(t *testing.T) {
+	for i, c := range []struct {
+		k, dim, num, numDelete, nTree, searchNum int
+		threshold, bucketScale                   float64
+	}{
+		{
+			k:           5,
+			dim:         20,
+			num:         4000,
+			numDelete:   3000,
+			nTree:       10,
+			threshold:   0.90,
+			searchNum:   50,
+			bucketScale: 40,
+		},
+		{
+			k:           2,
+			dim:         5,
+			num:         100,
+			numDelete:   100,
+			nTree:       3,
+			threshold:   0,
+			searchNum:   10,
+			bucketScale: 10,
+		},
+	} {
+		c := c
 
-	var norm float64
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint(i, randVec(c.dim))
+			}
 
-	for j := range v {
-		cof := rand.Float64() - 0.5
-		v[j] = cof
-		norm += cof * cof
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			deleted := make(map[int]struct{}, c.numDelete)
+			for _, id := range rand.Perm(c.num)[:c.numDelete] {
+				if err := idx.DeleteDataPoint(id); err != nil {
+					t.Fatal(err)
+				}
+				deleted[id] = struct{}{}
+			}
+
+			if err := idx.DeleteDataPoint(rand.Perm(c.num)[0] + c.num); !errors.Is(err, ErrDataPointNotFound) {
+				t.Fatalf("expected ErrDataPointNotFound for unknown id, got %v", err)
+			}
+
+			remaining := c.num - c.numDelete
+			if len(idx.DataPoints) != remaining || len(idx.IDToDataPointMapping) != remaining {
+				t.Fatalf("expected %d remaining data points, got %d / %d", remaining, len(idx.DataPoints), len(idx.IDToDataPointMapping))
+			}
+
+			// every remaining item must be stored exactly once per tree and no dropped node must be referenced
+			reachable := map[string]struct{}{}
+			for _, r := range idx.Roots {
+				items := map[int]int{}
+				collectTree(r, items, reachable)
+				checkLeaves(t, r)
+
+				if len(items) != remaining {
+					t.Fatalf("expected %d items in tree, got %d", remaining, len(items))
+				}
+
+				for id, n := range items {
+					if _, ok := deleted[id]; ok {
+						t.Fatalf("deleted item %d is still part of the tree", id)
+					}
+					if n != 1 {
+						t.Fatalf("item %d is stored %d times in the same tree", id, n)
+					}
+				}
+			}
+
+			if len(reachable) != len(idx.IDToTreeNodeMapping) {
+				t.Fatalf("node mapping contains %d nodes, but only %d are reachable", len(idx.IDToTreeNodeMapping), len(reachable))
+			}
+
+			query := make([]float64, c.dim)
+			query[0] = 0.1
+
+			ass, err := idx.SearchByVector(query, c.searchNum, c.bucketScale)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if remaining == 0 {
+				if len(*ass) != 0 {
+					t.Fatalf("expected no results on an empty index, got %d", len(*ass))
+				}
+
+				return
+			}
+
+			// exact neighbors among the remaining items
+			aDist := map[int]float64{}
+			ids := make([]int, 0, remaining)
+			for _, v := range idx.DataPoints {
+				ids = append(ids, v.ID)
+				aDist[v.ID] = idx.DistanceMeasure.CalcDistance(v.Embedding, query)
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				return aDist[ids[i]] < aDist[ids[j]]
+			})
+
+			expectedIDsMap := make(map[int]struct{}, c.searchNum)
+			for _, id := range ids[:c.searchNum] {
+				expectedIDsMap[id] = struct{}{}
+			}
+
+			var count int
+			for _, res := range *ass {
+				if _, ok := deleted[res.ID]; ok {
+					t.Fatalf("deleted item %d returned by search", res.ID)
+				}
+				if _, ok := expectedIDsMap[res.ID]; ok {
+					count++
+				}
+			}
+
+			if ratio := float64(count) / float64(c.searchNum); ratio < c.threshold {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, c.searchNum, ratio)
+			} else {
+				t.Logf("ratio of exact neighbors in approximated result: %d / %d = %f", count, c.searchNum, ratio)
+			}
+		})
 	}
+}
 
-	norm = math.Sqrt(norm)
-	for j := range v {
-		v[j] /= norm
+func TestIndex_DeleteMisplacedDataPoint(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 500)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(4))
 	}
 
-	return v
+	idx, err := NewVectorIndex(2, 4, 5, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	// move item 0 into a leaf of the other subspace of the first root, as if it had been placed using a different vector
+	root := idx.Roots[0]
+	if !root.remove(0, idx.treeVector(rawItems[0], nil)) {
+		t.Fatalf("item 0 is not part of the first tree")
+	}
+
+	other := root.right
+	if root.margin(rawItems[0].Embedding) >= 0 {
+		other = root.left
+	}
+
+	for !other.isLeaf() {
+		other = other.left
+	}
+
+	other.items = append(other.items, 0)
+	root.leaves[0] = other
+
+	if err := idx.DeleteDataPoint(0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range idx.Roots {
+		items := map[int]int{}
+		collectTree(r, items, map[string]struct{}{})
+		checkLeaves(t, r)
+
+		if _, ok := items[0]; ok || len(items) != len(rawItems)-1 {
+			t.Fatalf("expected %d items without the deleted one, got %d", len(rawItems)-1, len(items))
+		}
+	}
+
+	if _, err := idx.SearchByVector(randVec(4), 10, DefaultBuckets); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndex_NotBuilt(t *testing.T) {
+	rawItems := []*DataPoint[int, float64]{NewDataPoint(0, randVec(4)), NewDataPoint(1, randVec(4))}
+
+	idx, err := NewVectorIndex(2, 4, 5, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddDataPoint(NewDataPoint(2, randVec(4))); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+
+	if err := idx.UpsertDataPoint(NewDataPoint(0, randVec(4))); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+
+	if err := idx.DeleteDataPoint(0); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+
+	if _, err := idx.SearchByVector(randVec(4), 1, DefaultBuckets); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+}
+
+// nolint: funlen
+func TestIndex_UpsertAttributes(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 200)
+	for i := range rawItems {
+		rawItems[i] = NewDataPointWithAttributes(i, randVec(8), Attributes{"lang": "en"})
+	}
+
+	for i, newIndex := range []func() (Index[int, float64], error){
+		func() (Index[int, float64], error) {
+			idx, err := NewVectorIndex(3, 8, 10, append([]*DataPoint[int, float64]{}, rawItems...), NewCosineDistanceMeasure[float64]())
+			if err == nil {
+				idx.Build()
+			}
+
+			return idx, err
+		},
+		func() (Index[int, float64], error) {
+			idx, err := NewVectorIndex(3, 8, 10, append([]*DataPoint[int, float64]{}, rawItems...), NewCosineDistanceMeasure[float64]())
+			if err == nil {
+				idx.Build()
+				err = idx.SetStorage(StorageInt8)
+			}
+
+			return idx, err
+		},
+		func() (Index[int, float64], error) {
+			return NewHNSWIndex(8, 8, 50, 50, rawItems, NewCosineDistanceMeasure[float64]())
+		},
+		func() (Index[int, float64], error) {
+			idx, err := NewIVFIndex[int](8, 4, 4, NewCosineDistanceMeasure[float64]())
+			if err == nil {
+				err = idx.Train(rawItems)
+			}
+
+			return idx, err
+		},
+	} {
+		idx, err := newIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the embedding is unchanged, only the attributes are replaced
+		if err := idx.UpsertDataPoint(NewDataPointWithAttributes(0, rawItems[0].Embedding, Attributes{"lang": "de"})); err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := idx.SearchByVector(rawItems[0].Embedding, 10, DefaultBuckets, WithFilter(Eq("lang", "de")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(*results) != 1 || (*results)[0].ID != 0 {
+			t.Fatalf("%d-th index: expected item 0 with the upserted attributes, got %v", i, *results)
+		}
+	}
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestIndex_UpsertDataPoint(t *testing.T) {
+	for i, c := range []struct {
+		k, dim, num, numUpsert, nTree, searchNum int
+		bucketScale                              float64
+	}{
+		{
+			k:           5,
+			dim:         20,
+			num:         2000,
+			numUpsert:   500,
+			nTree:       10,
+			searchNum:   20,
+			bucketScale: 20,
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint(i, randVec(c.dim))
+			}
+
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			if err := idx.AddDataPoint(NewDataPoint(0, randVec(c.dim))); !errors.Is(err, ErrDataPointExists) {
+				t.Fatalf("expected ErrDataPointExists when adding an existing id, got %v", err)
+			}
+
+			// upserting an unchanged embedding must not modify the trees
+			numberOfNodes := len(idx.IDToTreeNodeMapping)
+			if err := idx.UpsertDataPoint(NewDataPoint(0, rawItems[0].Embedding)); err != nil {
+				t.Fatal(err)
+			}
+			if len(idx.IDToTreeNodeMapping) != numberOfNodes {
+				t.Fatalf("upserting an unchanged data point modified the trees")
+			}
+
+			// move the items to new random positions
+			for id := 0; id < c.numUpsert; id++ {
+				if err := idx.UpsertDataPoint(NewDataPoint(id, randVec(c.dim))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// insert a new item via upsert
+			if err := idx.UpsertDataPoint(NewDataPoint(c.num, randVec(c.dim))); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(idx.DataPoints) != c.num+1 || len(idx.IDToDataPointMapping) != c.num+1 {
+				t.Fatalf("expected %d data points, got %d / %d", c.num+1, len(idx.DataPoints), len(idx.IDToDataPointMapping))
+			}
+
+			for _, r := range idx.Roots {
+				items := map[int]int{}
+				collectTree(r, items, map[string]struct{}{})
+
+				if len(items) != c.num+1 {
+					t.Fatalf("expected %d items in tree, got %d", c.num+1, len(items))
+				}
+
+				for id, n := range items {
+					if n != 1 {
+						t.Fatalf("item %d is stored %d times in the same tree", id, n)
+					}
+				}
+			}
+
+			// every moved item must be found at its new position
+			for id := 0; id < c.numUpsert; id += 50 {
+				query := idx.IDToDataPointMapping[id].Embedding
+
+				ass, err := idx.SearchByVector(query, c.searchNum, c.bucketScale)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if (*ass)[0].ID != id {
+					t.Fatalf("expected upserted item %d to be the nearest neighbor of its own embedding, got %d", id, (*ass)[0].ID)
+				}
+
+				seen := map[int]struct{}{}
+				for _, res := range *ass {
+					if _, ok := seen[res.ID]; ok {
+						t.Fatalf("item %d returned multiple times", res.ID)
+					}
+					seen[res.ID] = struct{}{}
+				}
+			}
+		})
+	}
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestIndex_SearchByVectorWithFilter(t *testing.T) {
+	for i, c := range []struct {
+		k, dim, num, nTree, searchNum int
+		threshold, bucketScale        float64
+		filter                        Filter
+		matches                       func(id int) bool
+	}{
+		{
+			k:           5,
+			dim:         20,
+			num:         5000,
+			nTree:       20,
+			threshold:   0.90,
+			searchNum:   20,
+			bucketScale: 20,
+			filter:      Eq("tenant", 3),
+			matches:     func(id int) bool { return id%10 == 3 },
+		},
+		{
+			k:           5,
+			dim:         20,
+			num:         5000,
+			nTree:       20,
+			threshold:   0.90,
+			searchNum:   20,
+			bucketScale: 20,
+			filter:      And(In("tenant", 1, 2), Not(Eq("lang", "en"))),
+			matches:     func(id int) bool { return (id%10 == 1 || id%10 == 2) && id%2 != 0 },
+		},
+		{
+			// only a few items match, all of them must be found by expanding the search
+			k:           5,
+			dim:         20,
+			num:         5000,
+			nTree:       20,
+			threshold:   1,
+			searchNum:   20,
+			bucketScale: 1,
+			filter:      Range("position", 100, 109),
+			matches:     func(id int) bool { return id >= 100 && id <= 109 },
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				lang := "de"
+				if i%2 == 0 {
+					lang = "en"
+				}
+
+				rawItems[i] = NewDataPointWithAttributes(i, randVec(c.dim), Attributes{"tenant": i % 10, "lang": lang, "position": i})
+			}
+
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			query := make([]float64, c.dim)
+			query[0] = 0.1
+
+			// exact neighbors among the matching items
+			aDist := map[int]float64{}
+			ids := []int{}
+			for i, v := range rawItems {
+				if !c.matches(i) {
+					continue
+				}
+				ids = append(ids, i)
+				aDist[i] = idx.DistanceMeasure.CalcDistance(v.Embedding, query)
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				return aDist[ids[i]] < aDist[ids[j]]
+			})
+
+			expectedNum := c.searchNum
+			if len(ids) < expectedNum {
+				expectedNum = len(ids)
+			}
+
+			expectedIDsMap := make(map[int]struct{}, expectedNum)
+			for _, id := range ids[:expectedNum] {
+				expectedIDsMap[id] = struct{}{}
+			}
+
+			ass, err := idx.SearchByVector(query, c.searchNum, c.bucketScale, WithFilter(c.filter))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*ass) != expectedNum {
+				t.Fatalf("expected %d results, got %d", expectedNum, len(*ass))
+			}
+
+			var count int
+			for _, res := range *ass {
+				if !c.matches(res.ID) {
+					t.Fatalf("item %d does not match the filter", res.ID)
+				}
+				if _, ok := expectedIDsMap[res.ID]; ok {
+					count++
+				}
+			}
+
+			if ratio := float64(count) / float64(expectedNum); ratio < c.threshold {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, expectedNum, ratio)
+			} else {
+				t.Logf("ratio of exact neighbors in approximated result: %d / %d = %f", count, expectedNum, ratio)
+			}
+		})
+	}
+}
+
+// nolint: funlen, cyclop
+func TestIndex_SearchByVectorContext(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 5000)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(20))
+	}
+
+	idx, err := NewVectorIndex(20, 20, 5, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	query := randVec(20)
+
+	expected, err := idx.SearchByVectorContext(context.Background(), query, 20, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*expected) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(*expected))
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := idx.SearchByVectorContext(canceled, query, 20, 20); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	ass, err := idx.SearchByVectorContext(canceled, query, 20, 20, WithPartialResults())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 0 {
+		t.Fatalf("expected no results for a context canceled before the search, got %d", len(*ass))
+	}
+
+	// the context expires during the search -> the results found so far are returned in order
+	ass, err = idx.SearchByVectorContext(newExpiringContext(3), query, 20, 20, WithPartialResults())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) == 0 || len(*ass) > 20 {
+		t.Fatalf("expected partial results, got %d", len(*ass))
+	}
+
+	if !sort.SliceIsSorted(*ass, func(i, j int) bool {
+		return idx.DistanceMeasure.CalcDistance((*ass)[i].Vector, query) < idx.DistanceMeasure.CalcDistance((*ass)[j].Vector, query)
+	}) {
+		t.Fatalf("partial results are not sorted by distance")
+	}
+
+	if _, err := idx.SearchByVectorContext(newExpiringContext(3), query, 20, 20); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// expiringContext reports context.DeadlineExceeded after Err has been called the given number of times.
+type expiringContext struct {
+	context.Context
+	done      chan struct{}
+	remaining int
+}
+
+func newExpiringContext(checks int) *expiringContext {
+	return &expiringContext{Context: context.Background(), done: make(chan struct{}), remaining: checks}
+}
+
+func (c *expiringContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *expiringContext) Err() error {
+	if c.remaining > 0 {
+		c.remaining--
+
+		return nil
+	}
+
+	return context.DeadlineExceeded
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestIndex_SearchBatch(t *testing.T) {
+	for i, c := range []struct {
+		k, dim, num, nTree, numQueries, searchNum int
+		bucketScale                               float64
+		opts                                      []SearchOption
+	}{
+		{
+			k:           5,
+			dim:         20,
+			num:         5000,
+			nTree:       10,
+			numQueries:  200,
+			searchNum:   10,
+			bucketScale: 10,
+		},
+		{
+			k:           5,
+			dim:         20,
+			num:         5000,
+			nTree:       10,
+			numQueries:  50,
+			searchNum:   10,
+			bucketScale: 10,
+			opts:        []SearchOption{WithConcurrency(3), WithFilter(Eq("even", true))},
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPointWithAttributes(i, randVec(c.dim), Attributes{"even": i%2 == 0})
+			}
+
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			queries := make([][]float64, c.numQueries)
+			for i := range queries {
+				queries[i] = randVec(c.dim)
+			}
+
+			// a query with the wrong number of dimensions must only fail itself
+			queries[c.numQueries/2] = randVec(c.dim + 1)
+
+			results, errs := idx.SearchBatch(queries, c.searchNum, c.bucketScale, c.opts...)
+
+			if len(results) != c.numQueries || len(errs) != c.numQueries {
+				t.Fatalf("expected %d results and errors, got %d / %d", c.numQueries, len(results), len(errs))
+			}
+
+			for i, query := range queries {
+				if i == c.numQueries/2 {
+					if !errors.Is(errs[i], errShapeMismatch) || results[i] != nil {
+						t.Fatalf("expected errShapeMismatch for query %d, got %v", i, errs[i])
+					}
+
+					continue
+				}
+
+				if errs[i] != nil {
+					t.Fatal(errs[i])
+				}
+
+				expected, err := idx.SearchByVector(query, c.searchNum, c.bucketScale, c.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(*expected) != len(*results[i]) {
+					t.Fatalf("expected %d results for query %d, got %d", len(*expected), i, len(*results[i]))
+				}
+
+				for j := range *expected {
+					if (*expected)[j].ID != (*results[i])[j].ID {
+						t.Fatalf("results of query %d differ at position %d: %d != %d", i, j, (*expected)[j].ID, (*results[i])[j].ID)
+					}
+				}
+			}
+		})
+	}
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestIndex_SearchWithinRadius(t *testing.T) {
+	for i, c := range []struct {
+		k, dim, num, nTree, maxResults int
+		radius, threshold              float64
+		distanceMeasure                DistanceMeasure[float64]
+	}{
+		{
+			k:               5,
+			dim:             10,
+			num:             5000,
+			nTree:           20,
+			radius:          0.8,
+			threshold:       0.9,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+		},
+		{
+			k:               5,
+			dim:             10,
+			num:             5000,
+			nTree:           20,
+			radius:          0.8,
+			threshold:       0.9,
+			maxResults:      5,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+		},
+		{
+			k:               5,
+			dim:             10,
+			num:             5000,
+			nTree:           20,
+			radius:          0.0001,
+			threshold:       1,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+		},
+		{
+			k:         5,
+			dim:       10,
+			num:       5000,
+			nTree:     20,
+			radius:    0.3,
+			threshold: 0.9,
+			// the radius refers to the cosine distance 1 - cos
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint(i, randVec(c.dim))
+			}
+
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			query := rawItems[0].Embedding
+
+			// exact neighbors within the radius
+			aDist := map[int]float64{}
+			ids := []int{}
+			for i, v := range rawItems {
+				if d, _ := distanceAndScore(idx.DistanceMeasure, idx.DistanceMeasure.CalcDistance(v.Embedding, query)); d <= c.radius {
+					ids = append(ids, i)
+					aDist[i] = d
+				}
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				return aDist[ids[i]] < aDist[ids[j]]
+			})
+
+			if c.maxResults > 0 && len(ids) > c.maxResults {
+				ids = ids[:c.maxResults]
+			}
+
+			ass, err := idx.SearchWithinRadius(query, c.radius, c.maxResults)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.maxResults > 0 && len(*ass) > c.maxResults {
+				t.Fatalf("expected at most %d results, got %d", c.maxResults, len(*ass))
+			}
+
+			var count int
+			for j, res := range *ass {
+				if res.Distance > c.radius {
+					t.Fatalf("item %d is outside of the radius: %f", res.ID, res.Distance)
+				}
+				if j > 0 && res.Distance < (*ass)[j-1].Distance {
+					t.Fatalf("results are not sorted by distance")
+				}
+				if _, ok := aDist[res.ID]; ok {
+					count++
+				}
+			}
+
+			if ratio := float64(count) / float64(len(ids)); ratio < c.threshold {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, len(ids), ratio)
+			} else {
+				t.Logf("ratio of exact neighbors in approximated result: %d / %d = %f", count, len(ids), ratio)
+			}
+		})
+	}
+}
+
+// nolint: funlen, gosec
+func TestIndex_SearchByVectorInnerProduct(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 5000)
+	for i := range rawItems {
+		// un-normalized embeddings, the norm matters for the inner product
+		v := randVec(20)
+		scale := 0.1 + 10*rand.Float64()
+
+		for d := range v {
+			v[d] *= scale
+		}
+
+		rawItems[i] = NewDataPoint(i, v)
+	}
+
+	flat, err := NewFlatIndex(20, rawItems, NewInnerProductDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := NewVectorIndex(20, 20, 5, append([]*DataPoint[int, float64]{}, rawItems[:4900]...), NewInnerProductDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	for _, dp := range rawItems[4900:] {
+		if err := idx.AddDataPoint(dp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, root := range idx.Roots {
+		if len(root.normalVec) != 21 {
+			t.Fatalf("expected normal vectors of the augmented embeddings, got %d dimensions", len(root.normalVec))
+		}
+	}
+
+	// single queries whose neighbours have a large norm are hard, so the recall is averaged over several queries
+	var count int
+
+	for q := 0; q < 10; q++ {
+		query := randVec(20)
+
+		expected, err := flat.SearchByVector(query, 20, DefaultBuckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ass, err := idx.SearchByVector(query, 20, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectedIDsMap := map[int]struct{}{}
+		for _, res := range *expected {
+			expectedIDsMap[res.ID] = struct{}{}
+		}
+
+		for _, res := range *ass {
+			if _, ok := expectedIDsMap[res.ID]; ok {
+				count++
+			}
+		}
+	}
+
+	if ratio := float64(count) / 200; ratio < 0.7 {
+		t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, 200, ratio)
+	}
+
+	// the augmented embeddings are used to find the data points in the trees
+	for _, dp := range rawItems[:100] {
+		if err := idx.DeleteDataPoint(dp.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items := map[int]int{}
+	for _, root := range idx.Roots {
+		collectTree(root, items, map[string]struct{}{})
+	}
+
+	for id, count := range items {
+		if id < 100 || count != idx.NumberOfRoots {
+			t.Fatalf("expected item %d to be part of every tree exactly once, got %d", id, count)
+		}
+	}
+}
+
+// nolint: funlen, gocognit, cyclop, gosec
+func TestIndex_SearchByVectorEuclideanOffset(t *testing.T) {
+	// data points far away from the origin, hyperplanes through the origin can't split them
+	shifted := func() []float64 {
+		v := make([]float64, 20)
+		for d := range v {
+			v[d] = 10 + rand.Float64()
+		}
+
+		return v
+	}
+
+	rawItems := make([]*DataPoint[int, float64], 5000)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, shifted())
+	}
+
+	flat, err := NewFlatIndex(20, rawItems, NewEuclideanDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := NewVectorIndex(10, 20, 10, append([]*DataPoint[int, float64]{}, rawItems[:4900]...), NewEuclideanDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	for _, dp := range rawItems[4900:] {
+		if err := idx.AddDataPoint(dp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, root := range idx.Roots {
+		if root.isLeaf() || root.offset == 0 {
+			t.Fatalf("expected the root to split the data points with an offset hyperplane")
+		}
+
+		items := map[int]int{}
+		collectTree(root, items, map[string]struct{}{})
+
+		if len(items) != len(rawItems) {
+			t.Fatalf("expected %d items in the tree, got %d", len(rawItems), len(items))
+		}
+	}
+
+	// a leaf holding most of the data points would make the search exhaustive
+	var maxLeafSize int
+
+	var walk func(n *treeNode[int, float64])
+	walk = func(n *treeNode[int, float64]) {
+		if n.isLeaf() {
+			maxLeafSize = imath.Max(maxLeafSize, len(n.items))
+
+			return
+		}
+
+		walk(n.left)
+		walk(n.right)
+	}
+
+	for _, root := range idx.Roots {
+		walk(root)
+	}
+
+	if maxLeafSize > 100 {
+		t.Fatalf("expected small leaves, got a leaf with %d items", maxLeafSize)
+	}
+
+	var count int
+
+	for q := 0; q < 10; q++ {
+		query := shifted()
+
+		expected, err := flat.SearchByVector(query, 10, DefaultBuckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ass, err := idx.SearchByVector(query, 10, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectedIDsMap := map[int]struct{}{}
+		for _, res := range *expected {
+			expectedIDsMap[res.ID] = struct{}{}
+		}
+
+		for _, res := range *ass {
+			if _, ok := expectedIDsMap[res.ID]; ok {
+				count++
+			}
+		}
+	}
+
+	if ratio := float64(count) / 100; ratio < 0.8 {
+		t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, 100, ratio)
+	}
+}
+
+// nolint: funlen, gocognit, cyclop, gosec
+func TestIndex_WithNormalization(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 2000)
+	for i := range rawItems {
+		v := randVec(16)
+		scale := 0.5 + 5*rand.Float64()
+
+		for d := range v {
+			v[d] *= scale
+		}
+
+		rawItems[i] = NewDataPoint(i, v)
+	}
+
+	if _, err := NewVectorIndex(10, 16, 10, rawItems, NewEuclideanDistanceMeasure[float64](), WithNormalization()); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	flat, err := NewFlatIndex(16, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := append([]float64{}, rawItems[0].Embedding...)
+
+	idx, err := NewVectorIndex(10, 16, 10, rawItems[:1900], NewCosineDistanceMeasure[float64](), WithNormalization())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	for _, dp := range rawItems[1900:] {
+		if err := idx.AddDataPoint(dp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !imath.VectorsEqual(original, rawItems[0].Embedding) {
+		t.Fatalf("expected the embeddings of the caller to stay untouched")
+	}
+
+	for _, dp := range rawItems {
+		norm := math.Sqrt(imath.VectorDotProduct(dp.Embedding, dp.Embedding))
+
+		magnitude, err := idx.Magnitude(dp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		itesting.AlmostEqual(t, norm, magnitude, 1e-9)
+		itesting.AlmostEqual(t, 1, imath.VectorDotProduct(idx.IDToDataPointMapping[dp.ID].Embedding, idx.IDToDataPointMapping[dp.ID].Embedding), 1e-9)
+	}
+
+	query := randVec(16)
+	for d := range query {
+		query[d] *= 3
+	}
+
+	expected, err := flat.SearchByVector(query, 10, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ass, err := idx.SearchByVector(query, 10, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedIDsMap := map[int]struct{}{}
+	for _, res := range *expected {
+		expectedIDsMap[res.ID] = struct{}{}
+	}
+
+	var count int
+	for _, res := range *ass {
+		if _, ok := expectedIDsMap[res.ID]; ok {
+			count++
+		}
+
+		// the scores of the normalized embeddings are the cosine similarities of the original ones
+		itesting.AlmostEqual(t, -NewCosineDistanceMeasure[float64]().CalcDistance(rawItems[res.ID].Embedding, query), res.Score, 1e-9)
+	}
+
+	if ratio := float64(count) / 10; ratio < 0.7 {
+		t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, 10, ratio)
+	}
+
+	// upserting a scaled embedding only changes the magnitude
+	scaled := make([]float64, 16)
+	for d := range scaled {
+		scaled[d] = 2 * rawItems[0].Embedding[d]
+	}
+
+	if err := idx.UpsertDataPoint(NewDataPoint(0, scaled)); err != nil {
+		t.Fatal(err)
+	}
+
+	magnitude, err := idx.Magnitude(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	itesting.AlmostEqual(t, 2*math.Sqrt(imath.VectorDotProduct(rawItems[0].Embedding, rawItems[0].Embedding)), magnitude, 1e-9)
+
+	// the magnitudes are persisted
+	var buf bytes.Buffer
+	if err := idx.Save(&buf, NewIntCodec()); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadVectorIndex[int, float64](&buf, NewIntCodec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := loaded.distanceMeasure().(*unitCosineDistanceMeasure[float64]); !ok {
+		t.Fatalf("expected the loaded index to calculate the cosine distances by dot products")
+	}
+
+	for _, dp := range rawItems[1:] {
+		magnitude, err := loaded.Magnitude(dp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		itesting.AlmostEqual(t, math.Sqrt(imath.VectorDotProduct(dp.Embedding, dp.Embedding)), magnitude, 1e-9)
+	}
+
+	if err := idx.DeleteDataPoint(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := idx.Magnitude(1); !errors.Is(err, ErrDataPointNotFound) {
+		t.Fatalf("expected ErrDataPointNotFound, got %v", err)
+	}
+}
+
+// nolint: gosec
+func TestIndex_GetSplittingVector(t *testing.T) {
+	for i, c := range []struct {
+		dim, num int
+	}{
+		{
+			dim: 5, num: 100,
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			vs := make([][]float64, c.num)
+			for i := 0; i < c.num; i++ {
+				v := make([]float64, c.dim)
+				for d := 0; d < c.dim; d++ {
+					v[d] = rand.Float64()
+				}
+				vs[i] = v
+			}
+
+			dp := make([]*DataPoint[int, float64], c.num)
+			for i := 0; i < c.num; i++ {
+				dp[i] = NewDataPoint(i, vs[i])
+			}
+			idx, _ := NewVectorIndex(1, c.dim, 1, dp, NewCosineDistanceMeasure[float64]())
+			idx.GetNormalVector(dp)
+		})
+	}
+}
+
+// nolint: gosec
+func TestIndex_GetNormalVectorSeparatesClusters(t *testing.T) {
+	for i, distanceMeasure := range []DistanceMeasure[float64]{
+		NewCosineDistanceMeasure[float64](),
+		NewEuclideanDistanceMeasure[float64](),
+		NewManhattanDistanceMeasure[float64](),
+		NewChebyshevDistanceMeasure[float64](),
+		minkowski(0.5),
+	} {
+		distanceMeasure := distanceMeasure
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			// two clusters around (3, 0, 0, 0, 0) and (-3, 0, 0, 0, 0)
+			dp := make([]*DataPoint[int, float64], 200)
+			for i := range dp {
+				v := make([]float64, 5)
+				for d := range v {
+					v[d] = rand.Float64() - 0.5
+				}
+
+				v[0] += 3
+				if i%2 == 1 {
+					v[0] -= 6
+				}
+
+				dp[i] = NewDataPoint(i, v)
+			}
+
+			idx, err := NewVectorIndex(1, 5, 1, dp, distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// two-means clustering can end up in a local optimum that splits both clusters,
+			// but most of the normal vectors have to separate them
+			separated := 0
+
+			for j := 0; j < 20; j++ {
+				normalVec := idx.GetNormalVector(dp)
+				side := func(v []float64) bool { return imath.VectorDotProduct(normalVec, v) < 0 }
+
+				ok := true
+				for _, d := range dp {
+					ok = ok && (side(d.Embedding) == side(dp[0].Embedding)) == (d.ID%2 == 0)
+				}
+
+				if ok {
+					separated++
+				}
+			}
+
+			if separated < 15 {
+				t.Fatalf("expected most hyperplanes to separate the clusters, %d / 20 did", separated)
+			}
+		})
+	}
+}
+
+// nolint: gosec
+func randVec(dim int) []float64 {
+	v := make([]float64, dim)
+
+	var norm float64
+
+	for j := range v {
+		cof := rand.Float64() - 0.5
+		v[j] = cof
+		norm += cof * cof
+	}
+
+	norm = math.Sqrt(norm)
+	for j := range v {
+		v[j] /= norm
+	}
+
+	return v
+}
+
+func collectTree[T comparable, F Float](n *treeNode[T, F], items map[T]int, nodeIDs map[string]struct{}) {
+	nodeIDs[n.nodeID] = struct{}{}
+
+	if n.isLeaf() {
+		for _, id := range n.items {
+			items[id]++
+		}
+
+		return
+	}
+
+	collectTree(n.left, items, nodeIDs)
+	collectTree(n.right, items, nodeIDs)
+}
+
+// checkLeaves verifies that the leaves map of the tree references the leaf of every item and nothing else.
+func checkLeaves[T comparable, F Float](t *testing.T, root *treeNode[T, F]) {
+	t.Helper()
+
+	var (
+		count int
+		walk  func(n *treeNode[T, F])
+	)
+
+	walk = func(n *treeNode[T, F]) {
+		if !n.isLeaf() {
+			walk(n.left)
+			walk(n.right)
+
+			return
+		}
+
+		for _, id := range n.items {
+			if root.leaves[id] != n {
+				t.Fatalf("expected item %v to be mapped to the leaf containing it", id)
+			}
+		}
+
+		count += len(n.items)
+	}
+
+	walk(root)
+
+	if len(root.leaves) != count {
+		t.Fatalf("expected %d mapped items, got %d", count, len(root.leaves))
+	}
+}
+
+// nolint: funlen, gosec
+func TestIndex_Float32(t *testing.T) {
+	const (
+		dim       = 8
+		num       = 2000
+		searchNum = 10
+	)
+
+	rawItems := make([]*DataPoint[string, float32], num)
+	rawItems64 := make([]*DataPoint[string, float64], num)
+
+	for i := range rawItems {
+		v := randVec(dim)
+		v32 := make([]float32, dim)
+
+		for d := range v {
+			v32[d] = float32(v[d])
+		}
+
+		rawItems[i] = NewDataPoint(strconv.Itoa(i), v32)
+		rawItems64[i] = NewDataPoint(strconv.Itoa(i), v)
+	}
+
+	idx, err := NewVectorIndex(10, dim, 20, rawItems, NewCosineDistanceMeasure[float32]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	flat, err := NewFlatIndex(dim, rawItems, NewCosineDistanceMeasure[float32]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+
+	for q := 0; q < 20; q++ {
+		query := rawItems[rand.Intn(num)].Embedding
+
+		expected, err := flat.SearchByVector(query, searchNum, DefaultBuckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := idx.SearchByVector(query, searchNum, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := map[string]struct{}{}
+		for _, r := range *results {
+			ids[r.ID] = struct{}{}
+		}
+
+		for _, r := range *expected {
+			if _, ok := ids[r.ID]; ok {
+				found++
+			}
+		}
+
+		// the query is part of the index
+		itesting.AlmostEqual(t, 0, (*expected)[0].Distance, 1e-6)
+	}
+
+	if recall := float64(found) / (20 * searchNum); recall < 0.8 {
+		t.Fatalf("expected a recall of at least 0.8, got %f", recall)
+	}
+
+	idx64, err := NewVectorIndex(10, dim, 20, rawItems64, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if idx.embeddingsSize()*2 != idx64.embeddingsSize() {
+		t.Fatalf("expected float32 embeddings to use half the memory, got %d and %d bytes", idx.embeddingsSize(), idx64.embeddingsSize())
+	}
+
+	// the distances of both element types agree up to the precision of float32
+	for i := 0; i < 100; i++ {
+		a, b := rand.Intn(num), rand.Intn(num)
+		d32 := idx.DistanceMeasure.CalcDistance(rawItems[a].Embedding, rawItems[b].Embedding)
+		d64 := idx64.DistanceMeasure.CalcDistance(rawItems64[a].Embedding, rawItems64[b].Embedding)
+		itesting.AlmostEqual(t, d64, d32, 1e-5)
+	}
+}
+
+// nolint: funlen, gocognit, cyclop, gosec
+func TestIndex_ConcurrentReadsAndWrites(t *testing.T) {
+	const (
+		dim       = 8
+		num       = 500
+		writers   = 3
+		readers   = 4
+		writerOps = 150
+	)
+
+	rawItems := make([]*DataPoint[int, float64], num)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(dim))
+	}
+
+	idx, err := NewVectorIndex(4, dim, 5, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	// every writer owns a disjoint range of the initial items and of the items it adds,
+	// so the expected content of the index is known once all writers are done
+	expected := make([]map[int]struct{}, writers)
+
+	var writersDone sync.WaitGroup
+
+	writersDone.Add(writers)
+
+	for w := 0; w < writers; w++ {
+		w := w
+		expected[w] = map[int]struct{}{}
+
+		for id := w; id < num; id += writers {
+			expected[w][id] = struct{}{}
+		}
+
+		go func() {
+			defer writersDone.Done()
+
+			next := num * (w + 1) * 10
+			owned := make([]int, 0, len(expected[w]))
+
+			for id := range expected[w] {
+				owned = append(owned, id)
+			}
+
+			for op := 0; op < writerOps; op++ {
+				var err error
+
+				switch op % 3 {
+				case 0:
+					err = idx.AddDataPoint(NewDataPoint(next, randVec(dim)))
+					expected[w][next] = struct{}{}
+					owned = append(owned, next)
+					next++
+				case 1:
+					err = idx.UpsertDataPoint(NewDataPoint(owned[rand.Intn(len(owned))], randVec(dim)))
+				default:
+					i := rand.Intn(len(owned))
+					err = idx.DeleteDataPoint(owned[i])
+					delete(expected[w], owned[i])
+					owned[i] = owned[len(owned)-1]
+					owned = owned[:len(owned)-1]
+				}
+
+				if err != nil {
+					t.Error(err)
+
+					return
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+
+	var readersDone sync.WaitGroup
+
+	readersDone.Add(readers)
+
+	for r := 0; r < readers; r++ {
+		r := r
+
+		go func() {
+			defer readersDone.Done()
+
+			for op := 0; ; op++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				var err error
+
+				switch (op + r) % 6 {
+				case 0:
+					_, err = idx.SearchByVector(randVec(dim), 10, DefaultBuckets)
+				case 1:
+					_, err = idx.SearchByItem(rand.Intn(num), 10, DefaultBuckets)
+				case 2:
+					_, err = idx.SearchWithinRadius(randVec(dim), 0.2, 10)
+				case 3:
+					_, errs := idx.SearchBatch([][]float64{randVec(dim), randVec(dim)}, 5, DefaultBuckets, WithConcurrency(2))
+					for _, e := range errs {
+						if e != nil {
+							err = e
+						}
+					}
+				case 4:
+					_, err = idx.Magnitude(rand.Intn(num))
+				default:
+					var buf bytes.Buffer
+					err = idx.Save(&buf, NewIntCodec())
+				}
+
+				// the initial items may have been deleted by a writer
+				if err != nil && !errors.Is(err, ErrDataPointNotFound) {
+					t.Error(err)
+
+					return
+				}
+			}
+		}()
+	}
+
+	writersDone.Wait()
+	close(done)
+	readersDone.Wait()
+
+	if t.Failed() {
+		return
+	}
+
+	remaining := map[int]struct{}{}
+	for _, ids := range expected {
+		for id := range ids {
+			remaining[id] = struct{}{}
+		}
+	}
+
+	if len(idx.DataPoints) != len(remaining) || len(idx.IDToDataPointMapping) != len(remaining) {
+		t.Fatalf("expected %d data points, got %d / %d", len(remaining), len(idx.DataPoints), len(idx.IDToDataPointMapping))
+	}
+
+	// every remaining item must be stored exactly once per tree and no dropped node must be referenced
+	reachable := map[string]struct{}{}
+	for _, r := range idx.Roots {
+		items := map[int]int{}
+		collectTree(r, items, reachable)
+
+		if len(items) != len(remaining) {
+			t.Fatalf("expected %d items in tree, got %d", len(remaining), len(items))
+		}
+
+		for id, n := range items {
+			if _, ok := remaining[id]; !ok || n != 1 {
+				t.Fatalf("item %d is stored %d times in the same tree", id, n)
+			}
+		}
+	}
+
+	if len(reachable) != len(idx.IDToTreeNodeMapping) {
+		t.Fatalf("node mapping contains %d nodes, but only %d are reachable", len(idx.IDToTreeNodeMapping), len(reachable))
+	}
 }
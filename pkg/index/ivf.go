@@ -0,0 +1,251 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+var _ Index[int, float64] = (*IVFIndex[int, float64])(nil)
+
+// IVFIndex is an approximate index based on an inverted file.
+// A k-means coarse quantizer partitions the space into NumberOfLists cells and every data point is stored in the list
+// of its nearest centroid. A search only scans the lists of the NumberOfProbes centroids closest to the query.
+type IVFIndex[T comparable, F Float] struct {
+	NumberOfDimensions int
+	NumberOfLists      int
+	// number of lists scanned per search, trades recall for speed
+	NumberOfProbes       int
+	DistanceMeasure      DistanceMeasure[F]
+	Centroids            [][]F
+	IDToDataPointMapping map[T]*DataPoint[T, F]
+
+	lists    [][]*DataPoint[T, F]
+	idToList map[T]int
+	rng      *rand.Rand
+}
+
+// NewIVFIndex creates an untrained index, Train has to be called before data points can be added.
+func NewIVFIndex[T comparable, F Float](numberOfDimensions int, numberOfLists int, numberOfProbes int, distanceMeasure DistanceMeasure[F]) (*IVFIndex[T, F], error) {
+	if numberOfLists < 1 || numberOfProbes < 1 {
+		return nil, fmt.Errorf("%w: the number of lists and probes must be positive", errInvalidParameter)
+	}
+
+	return &IVFIndex[T, F]{
+		NumberOfDimensions:   numberOfDimensions,
+		NumberOfLists:        numberOfLists,
+		NumberOfProbes:       numberOfProbes,
+		DistanceMeasure:      distanceMeasure,
+		IDToDataPointMapping: map[T]*DataPoint[T, F]{},
+		idToList:             map[T]int{},
+		rng:                  rand.New(rand.NewSource(time.Now().UnixNano())), // nolint: gosec
+	}, nil
+}
+
+// Train computes the centroids of the lists by running k-means on the sample, which needs to contain at least NumberOfLists data points.
+// Data points that were already added are re-assigned to the new lists.
+func (ii *IVFIndex[T, F]) Train(sample []*DataPoint[T, F]) error {
+	if len(sample) < ii.NumberOfLists {
+		return fmt.Errorf("%w: at least %d data points are required for training", errInvalidParameter, ii.NumberOfLists)
+	}
+
+	vectors := make([][]F, len(sample))
+
+	for i, dp := range sample {
+		if len(dp.Embedding) != ii.NumberOfDimensions {
+			return errShapeMismatch
+		}
+
+		vectors[i] = dp.Embedding
+	}
+
+	ii.Centroids = kMeans(vectors, ii.NumberOfLists, ii.DistanceMeasure, kMeansMaxIterations, ii.rng)
+	ii.lists = make([][]*DataPoint[T, F], ii.NumberOfLists)
+
+	for _, dp := range ii.IDToDataPointMapping {
+		ii.assign(dp)
+	}
+
+	return nil
+}
+
+// AddDataPoint adds the data point to the list of its nearest centroid.
+// Returns ErrDataPointExists if the ID is already indexed, use UpsertDataPoint to replace existing data points.
+func (ii *IVFIndex[T, F]) AddDataPoint(dataPoint *DataPoint[T, F]) error {
+	if ii.Centroids == nil {
+		return errIndexNotTrained
+	}
+
+	if len(dataPoint.Embedding) != ii.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	if _, ok := ii.IDToDataPointMapping[dataPoint.ID]; ok {
+		return fmt.Errorf("%w: %v", ErrDataPointExists, dataPoint.ID)
+	}
+
+	ii.IDToDataPointMapping[dataPoint.ID] = dataPoint
+	ii.assign(dataPoint)
+
+	return nil
+}
+
+// UpsertDataPoint adds the data point if its ID is not indexed yet, otherwise it replaces the existing data point.
+// If the embedding is unchanged, the data point stays in its list and only the attributes are replaced.
+func (ii *IVFIndex[T, F]) UpsertDataPoint(dataPoint *DataPoint[T, F]) error {
+	if len(dataPoint.Embedding) != ii.NumberOfDimensions {
+		return errShapeMismatch
+	}
+
+	existing, ok := ii.IDToDataPointMapping[dataPoint.ID]
+	if !ok {
+		return ii.AddDataPoint(dataPoint)
+	}
+
+	if imath.VectorsEqual(existing.Embedding, dataPoint.Embedding) {
+		list := ii.lists[ii.idToList[dataPoint.ID]]
+		for i, dp := range list {
+			if dp.ID == dataPoint.ID {
+				list[i] = dataPoint
+
+				break
+			}
+		}
+
+		ii.IDToDataPointMapping[dataPoint.ID] = dataPoint
+
+		return nil
+	}
+
+	if err := ii.DeleteDataPoint(dataPoint.ID); err != nil {
+		return err
+	}
+
+	return ii.AddDataPoint(dataPoint)
+}
+
+// DeleteDataPoint removes the data point from its list.
+func (ii *IVFIndex[T, F]) DeleteDataPoint(id T) error {
+	if _, ok := ii.IDToDataPointMapping[id]; !ok {
+		return fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	list := ii.lists[ii.idToList[id]]
+	for i, dp := range list {
+		if dp.ID != id {
+			continue
+		}
+
+		list[i] = list[len(list)-1]
+		list[len(list)-1] = nil
+		ii.lists[ii.idToList[id]] = list[:len(list)-1]
+
+		break
+	}
+
+	delete(ii.IDToDataPointMapping, id)
+	delete(ii.idToList, id)
+
+	return nil
+}
+
+func (ii *IVFIndex[T, F]) assign(dataPoint *DataPoint[T, F]) {
+	list, _ := nearestCentroid(ii.Centroids, dataPoint.Embedding, ii.DistanceMeasure)
+	ii.lists[list] = append(ii.lists[list], dataPoint)
+	ii.idToList[dataPoint.ID] = list
+}
+
+// SearchByVector returns the searchNum nearest neighbours of input found in the NumberOfProbes lists closest to input.
+// numberOfBuckets is ignored, it only exists to satisfy the Index interface.
+func (ii *IVFIndex[T, F]) SearchByVector(input []F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	return ii.SearchByVectorContext(context.Background(), input, searchNum, numberOfBuckets, opts...)
+}
+
+// SearchByVectorContext works like SearchByVector but stops searching once the context is done.
+// It returns the context's error unless WithPartialResults is given, in which case the best results found so far are returned.
+// nolint: cyclop
+func (ii *IVFIndex[T, F]) SearchByVectorContext(ctx context.Context, input []F, searchNum int, _ float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	if len(input) != ii.NumberOfDimensions {
+		return nil, errShapeMismatch
+	}
+
+	if ii.Centroids == nil {
+		return nil, errIndexNotTrained
+	}
+
+	options := newSearchOptions(opts)
+	checker := newContextChecker(ctx)
+
+	// find the lists closest to the input
+	lists := make([]int, len(ii.Centroids))
+	listToDist := make([]float64, len(ii.Centroids))
+
+	for i, centroid := range ii.Centroids {
+		lists[i] = i
+		listToDist[i] = ii.DistanceMeasure.CalcDistance(centroid, input)
+	}
+
+	sort.Slice(lists, func(i, j int) bool {
+		return listToDist[lists[i]] < listToDist[lists[j]]
+	})
+
+	type candidate struct {
+		dp   *DataPoint[T, F]
+		dist float64
+	}
+
+	candidates := []candidate{}
+
+probe:
+	for _, list := range lists[:imath.Min(ii.NumberOfProbes, len(lists))] {
+		for _, dp := range ii.lists[list] {
+			if err := checker.err(); err != nil {
+				if options.partialResults {
+					break probe
+				}
+
+				return nil, err
+			}
+
+			if options.filter != nil && !options.filter.Match(dp.Attributes) {
+				continue
+			}
+
+			candidates = append(candidates, candidate{dp, ii.DistanceMeasure.CalcDistance(dp.Embedding, input)})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].dist < candidates[j].dist
+	})
+
+	candidates = candidates[:imath.Min(searchNum, len(candidates))]
+
+	searchResults := make([]SearchResult[T, F], len(candidates))
+	for i, c := range candidates {
+		searchResults[i] = newSearchResult(ii.DistanceMeasure, c.dp.ID, c.dist, c.dp.Embedding)
+	}
+
+	return &searchResults, nil
+}
+
+// SearchByItem returns the nearest neighbours of a data point that is already part of the index.
+// The queried item itself is not included in the results.
+func (ii *IVFIndex[T, F]) SearchByItem(id T, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	dp, ok := ii.IDToDataPointMapping[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	// search for one additional item since the queried item will most likely be part of the results
+	results, err := ii.SearchByVector(dp.Embedding, searchNum+1, numberOfBuckets, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutItem(results, id, searchNum), nil
+}
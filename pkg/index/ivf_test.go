@@ -0,0 +1,180 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// nolint: funlen, gocognit, cyclop
+func TestIVFIndex_SearchByVector(t *testing.T) {
+	for i, c := range []struct {
+		dim, num, lists, probes, searchNum int
+		distanceMeasure                    DistanceMeasure[float64]
+		opts                               []SearchOption
+		matches                            func(id int) bool
+	}{
+		{
+			dim:             20,
+			num:             5000,
+			lists:           32,
+			probes:          16,
+			searchNum:       20,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+			matches:         func(id int) bool { return true },
+		},
+		{
+			dim:             5,
+			num:             2000,
+			lists:           16,
+			probes:          6,
+			searchNum:       10,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+			opts:            []SearchOption{WithFilter(Eq("even", true))},
+			matches:         func(id int) bool { return id%2 == 0 },
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPointWithAttributes(i, randVec(c.dim), Attributes{"even": i%2 == 0})
+			}
+
+			flat, err := NewFlatIndex(c.dim, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			idx, err := NewIVFIndex[int](c.dim, c.lists, c.probes, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := idx.Train(rawItems); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, dp := range rawItems {
+				if err := idx.AddDataPoint(dp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			query := randVec(c.dim)
+
+			expected, err := flat.SearchByVector(query, c.searchNum, DefaultBuckets, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ass, err := idx.SearchByVector(query, c.searchNum, DefaultBuckets, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*ass) != c.searchNum {
+				t.Fatalf("expected %d results, got %d", c.searchNum, len(*ass))
+			}
+
+			expectedIDsMap := map[int]struct{}{}
+			for _, res := range *expected {
+				expectedIDsMap[res.ID] = struct{}{}
+			}
+
+			var count int
+			for _, res := range *ass {
+				if !c.matches(res.ID) {
+					t.Fatalf("result %d does not match the filter", res.ID)
+				}
+
+				if _, ok := expectedIDsMap[res.ID]; ok {
+					count++
+				}
+			}
+
+			if ratio := float64(count) / float64(c.searchNum); ratio < 0.8 {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, c.searchNum, ratio)
+			}
+		})
+	}
+}
+
+// nolint: funlen, cyclop
+func TestIVFIndex_Modifications(t *testing.T) {
+	if _, err := NewIVFIndex[int](4, 0, 1, NewEuclideanDistanceMeasure[float64]()); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	rawItems := make([]*DataPoint[int, float64], 100)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(4))
+	}
+
+	idx, err := NewIVFIndex[int](4, 4, 4, NewEuclideanDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddDataPoint(rawItems[0]); !errors.Is(err, errIndexNotTrained) {
+		t.Fatalf("expected errIndexNotTrained, got %v", err)
+	}
+
+	if err := idx.Train(rawItems[:3]); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	if err := idx.Train(rawItems); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dp := range rawItems {
+		if err := idx.AddDataPoint(dp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := idx.AddDataPoint(NewDataPoint(0, randVec(4))); !errors.Is(err, ErrDataPointExists) {
+		t.Fatalf("expected ErrDataPointExists, got %v", err)
+	}
+
+	if err := idx.AddDataPoint(NewDataPoint(100, []float64{1, 1, 1, 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.UpsertDataPoint(NewDataPoint(5, []float64{1, 1, 1, 1.01})); err != nil {
+		t.Fatal(err)
+	}
+
+	ass, err := idx.SearchByItem(100, 1, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 1 || (*ass)[0].ID != 5 {
+		t.Fatalf("expected upserted item 5 as nearest neighbor of item 100, got %v", *ass)
+	}
+
+	if err := idx.DeleteDataPoint(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.DeleteDataPoint(5); !errors.Is(err, ErrDataPointNotFound) {
+		t.Fatalf("expected ErrDataPointNotFound, got %v", err)
+	}
+
+	// retraining keeps all data points, probing every list makes the search exact
+	if err := idx.Train(rawItems); err != nil {
+		t.Fatal(err)
+	}
+
+	ass, err = idx.SearchByVector([]float64{1, 1, 1, 1.01}, 101, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*ass) != 100 || (*ass)[0].ID != 100 {
+		t.Fatalf("expected the deleted item to be gone, got %d results starting with %d", len(*ass), (*ass)[0].ID)
+	}
+}
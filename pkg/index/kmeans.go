@@ -0,0 +1,85 @@
+package index
+
+import (
+	"math"
+	"math/rand"
+)
+
+const kMeansMaxIterations = 25
+
+// kMeans clusters the vectors into k clusters using Lloyd's algorithm and returns the centroids.
+// The centroids are initialized with randomly chosen vectors, clusters that run empty are re-initialized the same way.
+func kMeans[F Float](vectors [][]F, k int, distanceMeasure DistanceMeasure[F], maxIterations int, rng *rand.Rand) [][]F {
+	dims := len(vectors[0])
+	centroids := make([][]F, k)
+
+	for i, p := range rng.Perm(len(vectors))[:k] {
+		centroids[i] = append([]F{}, vectors[p]...)
+	}
+
+	assignments := make([]int, len(vectors))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		// assign each vector to the cluster with the nearest centroid
+		changed := false
+
+		for i, v := range vectors {
+			c, _ := nearestCentroid(centroids, v, distanceMeasure)
+			if c != assignments[i] {
+				assignments[i] = c
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+
+		// move the centroids to the mean of the vectors assigned to them
+		counts := make([]int, k)
+		for c := range centroids {
+			centroids[c] = make([]F, dims)
+		}
+
+		for i, v := range vectors {
+			c := assignments[i]
+			counts[c]++
+
+			for d := range v {
+				centroids[c][d] += v[d]
+			}
+		}
+
+		for c := range centroids {
+			if counts[c] == 0 {
+				centroids[c] = append([]F{}, vectors[rng.Intn(len(vectors))]...)
+
+				continue
+			}
+
+			for d := range centroids[c] {
+				centroids[c][d] /= F(counts[c])
+			}
+		}
+	}
+
+	return centroids
+}
+
+// nearestCentroid returns the position of and the distance to the centroid nearest to v.
+func nearestCentroid[F Float](centroids [][]F, v []F, distanceMeasure DistanceMeasure[F]) (int, float64) {
+	nearest := 0
+	nearestDist := math.Inf(1)
+
+	for c, centroid := range centroids {
+		if dist := distanceMeasure.CalcDistance(centroid, v); dist < nearestDist {
+			nearest = c
+			nearestDist = dist
+		}
+	}
+
+	return nearest, nearestDist
+}
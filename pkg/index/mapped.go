@@ -0,0 +1,481 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"unsafe"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+// the mapped index file has the following layout, all numbers are encoded in little endian and every section
+// starts at an offset aligned to 8 bytes, so the sections can be used directly from the mapped memory:
+//
+//	header                                      mappedHeader
+//	roots                                       node index of every root as uint32
+//	nodes                                       flattened nodes of all trees as mappedNode
+//	embeddings                                  contiguous block of number of data points * dimensions float32
+//	normals                                     contiguous block of number of inner nodes * dimensions float32
+//	leaf items                                  positions of the items of all leaf nodes as uint32
+//	ids                                         ids of all data points encoded with the IDCodec
+const mappedFormatVersion uint32 = 1
+
+var mappedFormatMagic = [4]byte{'V', 'D', 'B', 'M'}
+
+type mappedHeader struct {
+	Magic               [4]byte
+	Version             uint32
+	NumberOfRoots       uint32
+	NumberOfDimensions  uint32
+	MaxItemsPerLeafNode uint32
+	DistanceMeasureKind uint32
+	// DistanceMeasureParameter is the parameter p of the minkowski distance measure
+	DistanceMeasureParameter float64
+	NumberOfDataPoints       uint64
+	NumberOfNodes            uint64
+	NumberOfNormals          uint64
+	NumberOfLeafItems        uint64
+	RootsOffset              uint64
+	NodesOffset              uint64
+	EmbeddingsOffset         uint64
+	NormalsOffset            uint64
+	LeafItemsOffset          uint64
+	IDsOffset                uint64
+}
+
+// mappedNode is the flattened representation of a tree node.
+// For inner nodes first and second are the positions of the left and right child, normal is the position of the normal vector
+// and offset the offset of the hyperplane. For leaf nodes first and second describe the range of the items in the leaf items section.
+type mappedNode struct {
+	kind   uint32
+	first  uint32
+	second uint32
+	normal uint32
+	offset float32
+}
+
+const (
+	mappedSectionAlignment = 8
+	mappedNodeSize         = 20
+	float32Size            = 4
+	float64Size            = 8
+	uint32Size             = 4
+)
+
+// MappedIndex is a read-only index which operates directly on the memory mapped file written by VectorIndex.SaveMapped.
+// Embeddings and normal vectors are stored as float32, only the identifiers are decoded into memory when the file is opened.
+type MappedIndex[T comparable, F Float] struct {
+	NumberOfRoots      int
+	NumberOfDimensions int
+	DistanceMeasure    DistanceMeasure[F]
+
+	ids        []T
+	roots      []uint32
+	nodes      []mappedNode
+	embeddings []float32
+	normals    []float32
+	leafItems  []uint32
+
+	data []byte
+}
+
+// SaveMapped writes the index in the layout expected by OpenMappedIndex.
+// The identifiers of the data points are encoded using the given codec, attributes are not part of the mapped layout.
+// nolint: funlen
+func (vi *VectorIndex[T, F]) SaveMapped(w io.Writer, codec IDCodec[T]) error {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	kind, parameter, err := distanceMeasureKind(vi.DistanceMeasure)
+	if err != nil {
+		return err
+	}
+
+	positions := make(map[T]uint32, len(vi.DataPoints))
+	for i, dp := range vi.DataPoints {
+		positions[dp.ID] = uint32(i)
+	}
+
+	f := &mappedFlattener[T, F]{positions: positions}
+	roots := make([]uint32, len(vi.Roots))
+
+	for i, root := range vi.Roots {
+		if root == nil {
+			return errIndexNotBuilt
+		}
+
+		roots[i] = f.flatten(root)
+	}
+
+	dims := uint64(vi.NumberOfDimensions)
+	header := mappedHeader{
+		Magic:                    mappedFormatMagic,
+		Version:                  mappedFormatVersion,
+		NumberOfRoots:            uint32(vi.NumberOfRoots),
+		NumberOfDimensions:       uint32(vi.NumberOfDimensions),
+		MaxItemsPerLeafNode:      uint32(vi.MaxItemsPerLeafNode),
+		DistanceMeasureKind:      uint32(kind),
+		DistanceMeasureParameter: parameter,
+		NumberOfDataPoints:       uint64(len(vi.DataPoints)),
+		NumberOfNodes:            uint64(len(f.nodes)),
+		NumberOfNormals:          uint64(len(f.normals)),
+		NumberOfLeafItems:        uint64(len(f.leafItems)),
+	}
+	header.RootsOffset = alignSection(uint64(binary.Size(header)))
+	header.NodesOffset = alignSection(header.RootsOffset + uint64(len(roots))*uint32Size)
+	header.EmbeddingsOffset = alignSection(header.NodesOffset + header.NumberOfNodes*mappedNodeSize)
+	header.NormalsOffset = alignSection(header.EmbeddingsOffset + header.NumberOfDataPoints*dims*float32Size)
+	header.LeafItemsOffset = alignSection(header.NormalsOffset + header.NumberOfNormals*dims*float32Size)
+	header.IDsOffset = alignSection(header.LeafItemsOffset + header.NumberOfLeafItems*uint32Size)
+
+	bw := &binaryWriter{w: bufio.NewWriter(w)}
+	bw.write(header)
+	bw.pad(header.RootsOffset)
+	bw.write(roots)
+	bw.pad(header.NodesOffset)
+
+	for _, n := range f.nodes {
+		bw.write([]uint32{n.kind, n.first, n.second, n.normal, math.Float32bits(n.offset)})
+	}
+
+	bw.pad(header.EmbeddingsOffset)
+
+	embedding := make([]float32, vi.NumberOfDimensions)
+	buf := make([]F, vi.NumberOfDimensions)
+
+	for _, dp := range vi.DataPoints {
+		for d, v := range vi.embedding(dp, buf) {
+			embedding[d] = float32(v)
+		}
+
+		bw.write(embedding)
+	}
+
+	bw.pad(header.NormalsOffset)
+
+	for _, normal := range f.normals {
+		// the additional dimension of inner product indexes is not needed, since it is 0 for queries
+		for d, v := range normal[:vi.NumberOfDimensions] {
+			embedding[d] = float32(v)
+		}
+
+		bw.write(embedding)
+	}
+
+	bw.pad(header.LeafItemsOffset)
+	bw.write(f.leafItems)
+	bw.pad(header.IDsOffset)
+
+	for _, dp := range vi.DataPoints {
+		binaryWriteID(bw, codec, dp.ID)
+	}
+
+	if bw.err != nil {
+		return bw.err
+	}
+
+	return bw.w.Flush()
+}
+
+// mappedFlattener converts the tree nodes into the flat arrays stored in the mapped index file.
+type mappedFlattener[T comparable, F Float] struct {
+	positions map[T]uint32
+	nodes     []mappedNode
+	normals   [][]F
+	leafItems []uint32
+}
+
+func (f *mappedFlattener[T, F]) flatten(node *treeNode[T, F]) uint32 {
+	position := uint32(len(f.nodes))
+	f.nodes = append(f.nodes, mappedNode{})
+
+	if node.isLeaf() {
+		start := uint32(len(f.leafItems))
+		for _, id := range node.items {
+			f.leafItems = append(f.leafItems, f.positions[id])
+		}
+
+		f.nodes[position] = mappedNode{kind: uint32(nodeKindLeaf), first: start, second: uint32(len(node.items))}
+
+		return position
+	}
+
+	normal := uint32(len(f.normals))
+	f.normals = append(f.normals, node.normalVec)
+
+	left := f.flatten(node.left)
+	right := f.flatten(node.right)
+	f.nodes[position] = mappedNode{kind: uint32(nodeKindInner), first: left, second: right, normal: normal, offset: float32(node.offset)}
+
+	return position
+}
+
+// OpenMappedIndex maps the file written by VectorIndex.SaveMapped into memory.
+// The file stays mapped until Close is called. On platforms without mmap support the file is read into memory instead.
+func OpenMappedIndex[T comparable, F Float](path string, codec IDCodec[T]) (*MappedIndex[T, F], error) {
+	if !isLittleEndian() {
+		return nil, errUnsupportedPlatform
+	}
+
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mi, err := newMappedIndex[T, F](data, codec)
+	if err != nil {
+		_ = unmapFile(data)
+
+		return nil, err
+	}
+
+	return mi, nil
+}
+
+// nolint: cyclop
+func newMappedIndex[T comparable, F Float](data []byte, codec IDCodec[T]) (*MappedIndex[T, F], error) {
+	var header mappedHeader
+
+	headerSize := uint64(binary.Size(header))
+	if uint64(len(data)) < headerSize {
+		return nil, errInvalidFormat
+	}
+
+	if err := binary.Read(bytes.NewReader(data[:headerSize]), binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if header.Magic != mappedFormatMagic {
+		return nil, errInvalidFormat
+	}
+
+	if header.Version != mappedFormatVersion {
+		return nil, fmt.Errorf("%w: %d", errUnsupportedVersion, header.Version)
+	}
+
+	distanceMeasure, err := distanceMeasureFromKind[F](uint8(header.DistanceMeasureKind), header.DistanceMeasureParameter)
+	if err != nil {
+		return nil, err
+	}
+
+	dims := uint64(header.NumberOfDimensions)
+	size := uint64(len(data))
+
+	if dims == 0 {
+		return nil, errInvalidFormat
+	}
+
+	// the counts are compared by dividing the available size, so corrupt counts can't overflow the section lengths
+	for _, section := range []struct{ offset, count, elementSize uint64 }{
+		{header.RootsOffset, uint64(header.NumberOfRoots), uint32Size},
+		{header.NodesOffset, header.NumberOfNodes, mappedNodeSize},
+		{header.EmbeddingsOffset, header.NumberOfDataPoints, dims * float32Size},
+		{header.NormalsOffset, header.NumberOfNormals, dims * float32Size},
+		{header.LeafItemsOffset, header.NumberOfLeafItems, uint32Size},
+		{header.IDsOffset, 0, 1},
+	} {
+		if section.offset%mappedSectionAlignment != 0 || section.offset > size || section.count > (size-section.offset)/section.elementSize {
+			return nil, errInvalidFormat
+		}
+	}
+
+	mi := &MappedIndex[T, F]{
+		NumberOfRoots:      int(header.NumberOfRoots),
+		NumberOfDimensions: int(header.NumberOfDimensions),
+		DistanceMeasure:    distanceMeasure,
+		roots:              mappedSlice[uint32](data, header.RootsOffset, uint64(header.NumberOfRoots)),
+		nodes:              mappedSlice[mappedNode](data, header.NodesOffset, header.NumberOfNodes),
+		embeddings:         mappedSlice[float32](data, header.EmbeddingsOffset, header.NumberOfDataPoints*dims),
+		normals:            mappedSlice[float32](data, header.NormalsOffset, header.NumberOfNormals*dims),
+		leafItems:          mappedSlice[uint32](data, header.LeafItemsOffset, header.NumberOfLeafItems),
+		data:               data,
+	}
+
+	if err := mi.validate(); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(bytes.NewReader(data[header.IDsOffset:]))
+
+	mi.ids = make([]T, header.NumberOfDataPoints)
+	for i := range mi.ids {
+		if mi.ids[i], err = codec.DecodeID(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return mi, nil
+}
+
+// validate checks the references between the sections, so a corrupt file is detected when it is opened instead of during the search.
+// The nodes are written in pre-order, so the children of an inner node must come after it, which rules out cycles.
+func (mi *MappedIndex[T, F]) validate() error {
+	numberOfNodes := uint64(len(mi.nodes))
+	numberOfNormals := uint64(len(mi.normals)) / uint64(mi.NumberOfDimensions)
+	numberOfLeafItems := uint64(len(mi.leafItems))
+
+	for _, r := range mi.roots {
+		if uint64(r) >= numberOfNodes {
+			return errInvalidFormat
+		}
+	}
+
+	for i, n := range mi.nodes {
+		switch uint8(n.kind) {
+		case nodeKindLeaf:
+			if uint64(n.first)+uint64(n.second) > numberOfLeafItems {
+				return errInvalidFormat
+			}
+		case nodeKindInner:
+			if uint64(n.first) >= numberOfNodes || uint64(n.second) >= numberOfNodes || uint64(n.normal) >= numberOfNormals {
+				return errInvalidFormat
+			}
+
+			if int(n.first) <= i || int(n.second) <= i {
+				return errInvalidFormat
+			}
+		default:
+			return errInvalidFormat
+		}
+	}
+
+	return nil
+}
+
+// Close unmaps the index file. The index must not be used afterwards.
+func (mi *MappedIndex[T, F]) Close() error {
+	if mi.data == nil {
+		return nil
+	}
+
+	data := mi.data
+	*mi = MappedIndex[T, F]{}
+
+	return unmapFile(data)
+}
+
+// Len returns the number of data points stored in the index.
+func (mi *MappedIndex[T, F]) Len() int {
+	return len(mi.ids)
+}
+
+// SearchByVector works like VectorIndex.SearchByVector but reads the trees and embeddings from the mapped file.
+// nolint: funlen, cyclop
+func (mi *MappedIndex[T, F]) SearchByVector(input []F, searchNum int, numberOfBuckets float64) (*[]SearchResult[T, F], error) {
+	if len(input) != mi.NumberOfDimensions {
+		return nil, errShapeMismatch
+	}
+
+	totalBucketSize := int(float64(searchNum) * numberOfBuckets)
+	annMap := make(map[uint32]struct{}, totalBucketSize)
+	pq := priorityQueue[uint32]{}
+
+	// insert root nodes into pq
+	for i, r := range mi.roots {
+		pq = append(pq, &queueItem[uint32]{r, i, math.Inf(-1)})
+	}
+
+	heap.Init(&pq)
+
+	// the normal vectors are stored as float32, a float32 copy of the query lets the traversal use the float32 kernels
+	query := make([]float32, len(input))
+	for d, v := range input {
+		query[d] = float32(v)
+	}
+
+	// search all trees until we found enough data points
+	for pq.Len() > 0 && len(annMap) < totalBucketSize {
+		q, _ := heap.Pop(&pq).(*queueItem[uint32])
+		n := mi.nodes[q.value]
+
+		if uint8(n.kind) == nodeKindLeaf {
+			for _, position := range mi.leafItems[n.first : n.first+n.second] {
+				if int(position) >= len(mi.ids) {
+					return nil, errInvalidIndex
+				}
+
+				annMap[position] = struct{}{}
+			}
+
+			continue
+		}
+
+		dp := imath.VectorDotProduct(mi.normal(n.normal), query) + float64(n.offset)
+		heap.Push(&pq, &queueItem[uint32]{
+			value:    n.first,
+			priority: imath.Max(q.priority, dp),
+		})
+		heap.Push(&pq, &queueItem[uint32]{
+			value:    n.second,
+			priority: imath.Max(q.priority, -dp),
+		})
+	}
+
+	// calculate actual distances
+	positionToDist := make(map[uint32]float64, len(annMap))
+	ann := make([]uint32, 0, len(annMap))
+	embedding := make([]F, mi.NumberOfDimensions)
+
+	for position := range annMap {
+		ann = append(ann, position)
+		positionToDist[position] = mi.DistanceMeasure.CalcDistance(mi.embedding(position, embedding), input)
+	}
+
+	// sort the found items by their actual distance
+	sort.Slice(ann, func(i, j int) bool {
+		return positionToDist[ann[i]] < positionToDist[ann[j]]
+	})
+
+	// return the top n items
+	if len(ann) > searchNum {
+		ann = ann[:searchNum]
+	}
+
+	searchResults := make([]SearchResult[T, F], len(ann))
+	for i, position := range ann {
+		searchResults[i] = newSearchResult(mi.DistanceMeasure, mi.ids[position], positionToDist[position], mi.embedding(position, make([]F, mi.NumberOfDimensions)))
+	}
+
+	return &searchResults, nil
+}
+
+// embedding converts the embedding of the data point at the given position into dst.
+func (mi *MappedIndex[T, F]) embedding(position uint32, dst []F) []F {
+	start := int(position) * mi.NumberOfDimensions
+	for d, v := range mi.embeddings[start : start+mi.NumberOfDimensions] {
+		dst[d] = F(v)
+	}
+
+	return dst
+}
+
+func (mi *MappedIndex[T, F]) normal(position uint32) []float32 {
+	start := int(position) * mi.NumberOfDimensions
+
+	return mi.normals[start : start+mi.NumberOfDimensions]
+}
+
+// mappedSlice reinterprets length elements starting at offset as a slice of E without copying.
+func mappedSlice[E any](data []byte, offset, length uint64) []E {
+	if length == 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*E)(unsafe.Pointer(&data[offset])), length)
+}
+
+func alignSection(offset uint64) uint64 {
+	return (offset + mappedSectionAlignment - 1) / mappedSectionAlignment * mappedSectionAlignment
+}
+
+func isLittleEndian() bool {
+	x := uint16(1)
+
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
@@ -0,0 +1,254 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// nolint: funlen, gocognit, cyclop
+func TestMappedIndex_SearchByVector(t *testing.T) {
+	for i, c := range []struct {
+		k, dim, num, nTree, searchNum int
+		threshold, bucketScale        float64
+		distanceMeasure               DistanceMeasure[float64]
+	}{
+		{
+			k:               5,
+			dim:             20,
+			num:             5000,
+			nTree:           20,
+			threshold:       0.85,
+			searchNum:       50,
+			bucketScale:     40,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+		},
+		{
+			k:               3,
+			dim:             7,
+			num:             500,
+			nTree:           5,
+			threshold:       0.80,
+			searchNum:       10,
+			bucketScale:     40,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+		},
+		{
+			k:               3,
+			dim:             7,
+			num:             500,
+			nTree:           5,
+			threshold:       0.80,
+			searchNum:       10,
+			bucketScale:     40,
+			distanceMeasure: NewInnerProductDistanceMeasure[float64](),
+		},
+		{
+			k:               3,
+			dim:             7,
+			num:             500,
+			nTree:           5,
+			threshold:       0.80,
+			searchNum:       10,
+			bucketScale:     40,
+			distanceMeasure: minkowski(3),
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint(i, randVec(c.dim))
+			}
+
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			path := filepath.Join(t.TempDir(), "index.vdbm")
+
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := idx.SaveMapped(f, NewIntCodec()); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			mi, err := OpenMappedIndex[int, float64](path, NewIntCodec())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mi.Close()
+
+			if mi.Len() != c.num {
+				t.Fatalf("expected %d data points, got %d", c.num, mi.Len())
+			}
+
+			query := randVec(c.dim)
+
+			// exact neighbors
+			aDist := map[int]float64{}
+			ids := make([]int, len(rawItems))
+			for i, v := range rawItems {
+				ids[i] = i
+				aDist[i] = idx.DistanceMeasure.CalcDistance(v.Embedding, query)
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				return aDist[ids[i]] < aDist[ids[j]]
+			})
+
+			expectedIDsMap := make(map[int]struct{}, c.searchNum)
+			for _, id := range ids[:c.searchNum] {
+				expectedIDsMap[id] = struct{}{}
+			}
+
+			ass, err := mi.SearchByVector(query, c.searchNum, c.bucketScale)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var count int
+			for _, res := range *ass {
+				if _, ok := expectedIDsMap[res.ID]; ok {
+					count++
+				}
+			}
+
+			if ratio := float64(count) / float64(c.searchNum); ratio < c.threshold {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, c.searchNum, ratio)
+			} else {
+				t.Logf("ratio of exact neighbors in approximated result: %d / %d = %f", count, c.searchNum, ratio)
+			}
+
+			// the stored float32 embeddings must be close to the original ones
+			for _, res := range *ass {
+				for d, v := range res.Vector {
+					if diff := v - rawItems[res.ID].Embedding[d]; diff > 1e-6 || diff < -1e-6 {
+						t.Fatalf("embedding of item %d differs in dimension %d: %f != %f", res.ID, d, v, rawItems[res.ID].Embedding[d])
+					}
+				}
+			}
+
+			if _, err := mi.SearchByVector(query[1:], c.searchNum, c.bucketScale); !errors.Is(err, errShapeMismatch) {
+				t.Fatalf("expected errShapeMismatch, got %v", err)
+			}
+
+			// the file stores float32, so opening it with float32 embeddings finds the same neighbours
+			mi32, err := OpenMappedIndex[int, float32](path, NewIntCodec())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mi32.Close()
+
+			query32 := make([]float32, len(query))
+			for d, v := range query {
+				query32[d] = float32(v)
+			}
+
+			ass32, err := mi32.SearchByVector(query32, c.searchNum, c.bucketScale)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*ass32) != len(*ass) {
+				t.Fatalf("expected %d results, got %d", len(*ass), len(*ass32))
+			}
+		})
+	}
+}
+
+func TestMappedIndex_OpenInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := OpenMappedIndex[int, float64](filepath.Join(dir, "missing"), NewIntCodec()); err == nil {
+		t.Fatalf("expected an error when opening a missing file")
+	}
+
+	invalid := filepath.Join(dir, "invalid")
+	if err := os.WriteFile(invalid, []byte("this is not an index file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenMappedIndex[int, float64](invalid, NewIntCodec()); !errors.Is(err, errInvalidFormat) {
+		t.Fatalf("expected errInvalidFormat, got %v", err)
+	}
+
+	rawItems := make([]*DataPoint[int, float64], 100)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(4))
+	}
+
+	idx, err := NewVectorIndex(2, 4, 2, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	f, err := os.Create(filepath.Join(dir, "truncated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.SaveMapped(f, NewIntCodec()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Truncate(info.Size() / 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenMappedIndex[int, float64](f.Name(), NewIntCodec()); !errors.Is(err, errInvalidFormat) {
+		t.Fatalf("expected errInvalidFormat, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := idx.SaveMapped(&buf, NewIntCodec()); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	nodesOffset := binary.LittleEndian.Uint64(data[72:])
+
+	for i, c := range []struct {
+		offset uint64
+		value  uint32
+	}{
+		{offset: 12, value: 0},              // number of dimensions
+		{offset: nodesOffset + 4, value: 0}, // the first root points back to itself
+	} {
+		corrupt := append([]byte{}, data...)
+		binary.LittleEndian.PutUint32(corrupt[c.offset:], c.value)
+
+		path := filepath.Join(dir, fmt.Sprintf("corrupt-%d", i))
+		if err := os.WriteFile(path, corrupt, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := OpenMappedIndex[int, float64](path, NewIntCodec()); !errors.Is(err, errInvalidFormat) {
+			t.Fatalf("%d-th corrupt file: expected errInvalidFormat, got %v", i, err)
+		}
+	}
+}
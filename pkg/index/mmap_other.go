@@ -0,0 +1,14 @@
+//go:build !unix
+
+package index
+
+import "os"
+
+// mapFile reads the whole file into memory on platforms without mmap support.
+func mapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func unmapFile(_ []byte) error {
+	return nil
+}
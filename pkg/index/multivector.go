@@ -0,0 +1,300 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+// MultiVectorDataPoint is a document represented by several embeddings, e.g. the token embeddings of a ColBERT model.
+type MultiVectorDataPoint[T comparable, F Float] struct {
+	ID         T
+	Embeddings [][]F
+	Attributes Attributes
+}
+
+func NewMultiVectorDataPoint[T comparable, F Float](id T, embeddings [][]F) *MultiVectorDataPoint[T, F] {
+	return &MultiVectorDataPoint[T, F]{ID: id, Embeddings: embeddings}
+}
+
+// NewMultiVectorDataPointWithAttributes creates a multi-vector data point carrying metadata that can be used to filter search results.
+func NewMultiVectorDataPointWithAttributes[T comparable, F Float](id T, embeddings [][]F, attributes Attributes) *MultiVectorDataPoint[T, F] {
+	return &MultiVectorDataPoint[T, F]{ID: id, Embeddings: embeddings, Attributes: attributes}
+}
+
+// multiVectorToken identifies a single embedding of a multi-vector data point in the underlying VectorIndex.
+type multiVectorToken[T comparable] struct {
+	ID       T
+	Position int
+}
+
+// MultiVectorIndex indexes documents consisting of several embeddings and ranks them by late interaction:
+// the score of a document is the sum of the best similarities of every query embedding with any of the document's embeddings (MaxSim).
+// All embeddings are stored in a single VectorIndex, whose trees provide the candidate documents for every query embedding.
+// Like VectorIndex, all methods are safe for concurrent use.
+type MultiVectorIndex[T comparable, F Float] struct {
+	// tokens holds the embeddings of all documents, its lock guards documents as well
+	tokens *VectorIndex[multiVectorToken[T], F]
+	// number of embeddings per document
+	documents map[T]int
+}
+
+func NewMultiVectorIndex[T comparable, F Float](numberOfRoots int, numberOfDimensions int, maxItemsPerLeafNode int, dataPoints []*MultiVectorDataPoint[T, F], distanceMeasure DistanceMeasure[F], opts ...IndexOption) (*MultiVectorIndex[T, F], error) {
+	documents := make(map[T]int, len(dataPoints))
+	tokens := make([]*DataPoint[multiVectorToken[T], F], 0, len(dataPoints))
+
+	for _, dp := range dataPoints {
+		if err := validateMultiVector(dp, numberOfDimensions); err != nil {
+			return nil, err
+		}
+
+		if _, ok := documents[dp.ID]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrDataPointExists, dp.ID)
+		}
+
+		documents[dp.ID] = len(dp.Embeddings)
+		tokens = append(tokens, multiVectorTokens(dp)...)
+	}
+
+	vi, err := NewVectorIndex(numberOfRoots, numberOfDimensions, maxItemsPerLeafNode, tokens, distanceMeasure, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultiVectorIndex[T, F]{tokens: vi, documents: documents}, nil
+}
+
+// validateMultiVector checks that the data point has at least one embedding and all of them have the given dimensionality.
+func validateMultiVector[T comparable, F Float](dataPoint *MultiVectorDataPoint[T, F], numberOfDimensions int) error {
+	if len(dataPoint.Embeddings) == 0 {
+		return fmt.Errorf("%w: data point %v has no embeddings", errInvalidParameter, dataPoint.ID)
+	}
+
+	for _, embedding := range dataPoint.Embeddings {
+		if len(embedding) != numberOfDimensions {
+			return errShapeMismatch
+		}
+	}
+
+	return nil
+}
+
+// multiVectorTokens splits the data point into one data point per embedding, all of them share the attributes of the document.
+func multiVectorTokens[T comparable, F Float](dataPoint *MultiVectorDataPoint[T, F]) []*DataPoint[multiVectorToken[T], F] {
+	tokens := make([]*DataPoint[multiVectorToken[T], F], len(dataPoint.Embeddings))
+	for i, embedding := range dataPoint.Embeddings {
+		tokens[i] = NewDataPointWithAttributes(multiVectorToken[T]{ID: dataPoint.ID, Position: i}, embedding, dataPoint.Attributes)
+	}
+
+	return tokens
+}
+
+// Build creates the trees over the embeddings of all documents.
+func (mi *MultiVectorIndex[T, F]) Build() {
+	mi.tokens.Build()
+}
+
+// Len returns the number of indexed documents.
+func (mi *MultiVectorIndex[T, F]) Len() int {
+	mi.tokens.lock.RLock()
+	defer mi.tokens.lock.RUnlock()
+
+	return len(mi.documents)
+}
+
+// AddDataPoint inserts all embeddings of a new document into the trees of the index.
+// Returns ErrDataPointExists if the ID is already indexed, use UpsertDataPoint to replace existing documents.
+func (mi *MultiVectorIndex[T, F]) AddDataPoint(dataPoint *MultiVectorDataPoint[T, F]) error {
+	mi.tokens.lock.Lock()
+	defer mi.tokens.lock.Unlock()
+
+	return mi.addDataPoint(dataPoint)
+}
+
+func (mi *MultiVectorIndex[T, F]) addDataPoint(dataPoint *MultiVectorDataPoint[T, F]) error {
+	if err := validateMultiVector(dataPoint, mi.tokens.NumberOfDimensions); err != nil {
+		return err
+	}
+
+	if !mi.tokens.built() {
+		return errIndexNotBuilt
+	}
+
+	if _, ok := mi.documents[dataPoint.ID]; ok {
+		return fmt.Errorf("%w: %v", ErrDataPointExists, dataPoint.ID)
+	}
+
+	for i, token := range multiVectorTokens(dataPoint) {
+		if err := mi.tokens.addDataPoint(token); err != nil {
+			// remove the embeddings added so far, a document is either indexed completely or not at all
+			for position := 0; position < i; position++ {
+				_ = mi.tokens.deleteDataPoint(multiVectorToken[T]{ID: dataPoint.ID, Position: position})
+			}
+
+			return err
+		}
+	}
+
+	mi.documents[dataPoint.ID] = len(dataPoint.Embeddings)
+
+	return nil
+}
+
+// UpsertDataPoint adds the document if its ID is not indexed yet, otherwise it replaces all embeddings of the existing document.
+func (mi *MultiVectorIndex[T, F]) UpsertDataPoint(dataPoint *MultiVectorDataPoint[T, F]) error {
+	mi.tokens.lock.Lock()
+	defer mi.tokens.lock.Unlock()
+
+	// validate the new document before the existing one is removed
+	if err := validateMultiVector(dataPoint, mi.tokens.NumberOfDimensions); err != nil {
+		return err
+	}
+
+	if !mi.tokens.built() {
+		return errIndexNotBuilt
+	}
+
+	if _, ok := mi.documents[dataPoint.ID]; ok {
+		if err := mi.deleteDataPoint(dataPoint.ID); err != nil {
+			return err
+		}
+	}
+
+	return mi.addDataPoint(dataPoint)
+}
+
+// DeleteDataPoint removes the document with the given ID and all of its embeddings from the index.
+func (mi *MultiVectorIndex[T, F]) DeleteDataPoint(id T) error {
+	mi.tokens.lock.Lock()
+	defer mi.tokens.lock.Unlock()
+
+	return mi.deleteDataPoint(id)
+}
+
+func (mi *MultiVectorIndex[T, F]) deleteDataPoint(id T) error {
+	n, ok := mi.documents[id]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := mi.tokens.deleteDataPoint(multiVectorToken[T]{ID: id, Position: i}); err != nil {
+			return err
+		}
+	}
+
+	delete(mi.documents, id)
+
+	return nil
+}
+
+// Search returns the searchNum documents with the largest summed MaxSim scores for the query embeddings.
+// The candidates are the documents owning one of the searchNum nearest embeddings of any query embedding,
+// numberOfBuckets and the search options are applied to each of these searches.
+// The candidates are scored exactly against all of their embeddings. The Score of the search results is the summed MaxSim,
+// which uses the similarities defined by ScoredDistanceMeasure.Similarity, the Distance is its negation and the Vector is nil.
+func (mi *MultiVectorIndex[T, F]) Search(query [][]F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	return mi.SearchContext(context.Background(), query, searchNum, numberOfBuckets, opts...)
+}
+
+// SearchContext works like Search but stops searching once the context is done.
+// It returns the context's error unless WithPartialResults is given, in which case the best results found so far are returned.
+// nolint: funlen
+func (mi *MultiVectorIndex[T, F]) SearchContext(ctx context.Context, query [][]F, searchNum int, numberOfBuckets float64, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	if len(query) == 0 {
+		return nil, fmt.Errorf("%w: the query has no embeddings", errInvalidParameter)
+	}
+
+	for _, q := range query {
+		if len(q) != mi.tokens.NumberOfDimensions {
+			return nil, errShapeMismatch
+		}
+	}
+
+	mi.tokens.lock.RLock()
+	defer mi.tokens.lock.RUnlock()
+
+	options := newSearchOptions(opts)
+	checker := newContextChecker(ctx)
+	scratch := newSearchScratch[multiVectorToken[T], F]()
+
+	// collect the candidate documents in the order they are found
+	candidates := make([]T, 0)
+	found := map[T]struct{}{}
+
+	for _, q := range query {
+		results, err := mi.tokens.search(ctx, scratch, q, searchNum, numberOfBuckets, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, res := range *results {
+			if _, ok := found[res.ID.ID]; !ok {
+				found[res.ID.ID] = struct{}{}
+				candidates = append(candidates, res.ID.ID)
+			}
+		}
+	}
+
+	if mi.tokens.normalized {
+		normalized := make([][]F, len(query))
+		for i, q := range query {
+			normalized[i] = make([]F, len(q))
+			normalizeInto(normalized[i], q)
+		}
+
+		query = normalized
+	}
+
+	scores := make(map[T]float64, len(candidates))
+	buf := make([]F, mi.tokens.NumberOfDimensions)
+
+	for _, id := range candidates {
+		if err := checker.err(); err != nil {
+			if options.partialResults {
+				candidates = candidates[:len(scores)]
+
+				break
+			}
+
+			return nil, err
+		}
+
+		scores[id] = mi.maxSim(id, query, buf)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i]] > scores[candidates[j]]
+	})
+
+	searchResults := make([]SearchResult[T, F], imath.Min(searchNum, len(candidates)))
+	for i := range searchResults {
+		id := candidates[i]
+		searchResults[i] = SearchResult[T, F]{ID: id, Distance: -scores[id], Score: scores[id]}
+	}
+
+	return &searchResults, nil
+}
+
+// maxSim sums the largest similarity of every query embedding with any embedding of the document.
+func (mi *MultiVectorIndex[T, F]) maxSim(id T, query [][]F, buf []F) float64 {
+	measure := mi.tokens.distanceMeasure()
+	sum := 0.0
+
+	for _, q := range query {
+		best := math.Inf(-1)
+
+		for i := 0; i < mi.documents[id]; i++ {
+			dp := mi.tokens.IDToDataPointMapping[multiVectorToken[T]{ID: id, Position: i}]
+			_, similarity := distanceAndScore(mi.tokens.DistanceMeasure, measure.CalcDistance(mi.tokens.embedding(dp, buf), q))
+			best = math.Max(best, similarity)
+		}
+
+		sum += best
+	}
+
+	return sum
+}
@@ -0,0 +1,318 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// randMultiVec returns n embeddings scattered around the center.
+func randMultiVec(center []float64, n int, noise float64) [][]float64 {
+	embeddings := make([][]float64, n)
+	for i := range embeddings {
+		embeddings[i] = make([]float64, len(center))
+		for d := range center {
+			embeddings[i][d] = center[d] + noise*(rand.Float64()-0.5)
+		}
+	}
+
+	return embeddings
+}
+
+func bruteForceMaxSim(distanceMeasure DistanceMeasure[float64], document, query [][]float64) float64 {
+	sum := 0.0
+
+	for _, q := range query {
+		best := math.Inf(-1)
+		for _, e := range document {
+			_, similarity := distanceAndScore(distanceMeasure, distanceMeasure.CalcDistance(e, q))
+			best = math.Max(best, similarity)
+		}
+
+		sum += best
+	}
+
+	return sum
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestMultiVectorIndex_Search(t *testing.T) {
+	for i, c := range []struct {
+		dim, num, searchNum int
+		distanceMeasure     DistanceMeasure[float64]
+		opts                []IndexOption
+	}{
+		{
+			dim:             16,
+			num:             300,
+			searchNum:       10,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+		},
+		{
+			dim:             16,
+			num:             300,
+			searchNum:       10,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+			opts:            []IndexOption{WithNormalization()},
+		},
+		{
+			dim:             8,
+			num:             200,
+			searchNum:       5,
+			distanceMeasure: NewInnerProductDistanceMeasure[float64](),
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			centers := make([][]float64, c.num)
+			rawItems := make([]*MultiVectorDataPoint[int, float64], c.num)
+
+			for i := range rawItems {
+				centers[i] = randVec(c.dim)
+				rawItems[i] = NewMultiVectorDataPoint(i, randMultiVec(centers[i], 3+rand.Intn(6), 0.1))
+			}
+
+			idx, err := NewMultiVectorIndex(5, c.dim, 10, rawItems, c.distanceMeasure, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			if idx.Len() != c.num {
+				t.Fatalf("expected %d documents, got %d", c.num, idx.Len())
+			}
+
+			found := 0
+
+			for q := 0; q < 20; q++ {
+				target := rand.Intn(c.num)
+				query := randMultiVec(centers[target], 4, 0.1)
+
+				results, err := idx.Search(query, c.searchNum, DefaultBuckets)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(*results) == 0 || len(*results) > c.searchNum {
+					t.Fatalf("expected up to %d results, got %d", c.searchNum, len(*results))
+				}
+
+				if (*results)[0].ID == target {
+					found++
+				}
+
+				seen := map[int]struct{}{}
+				for j, res := range *results {
+					if _, ok := seen[res.ID]; ok {
+						t.Fatalf("document %d is returned more than once", res.ID)
+					}
+					seen[res.ID] = struct{}{}
+
+					if exp := bruteForceMaxSim(c.distanceMeasure, rawItems[res.ID].Embeddings, query); math.Abs(res.Score-exp) > 1e-9 {
+						t.Fatalf("expected the MaxSim score %f of document %d, got %f", exp, res.ID, res.Score)
+					}
+
+					if res.Distance != -res.Score {
+						t.Fatalf("expected the distance to be the negative score, got %v", res)
+					}
+
+					if j > 0 && res.Score > (*results)[j-1].Score {
+						t.Fatalf("results are not ordered by decreasing score at position %d", j)
+					}
+				}
+			}
+
+			if found < 18 {
+				t.Fatalf("the document the query was sampled from ranked first in only %d of 20 searches", found)
+			}
+		})
+	}
+}
+
+func TestMultiVectorIndex_AddUpsertDelete(t *testing.T) {
+	const dim = 4
+
+	rawItems := make([]*MultiVectorDataPoint[string, float64], 50)
+	for i := range rawItems {
+		rawItems[i] = NewMultiVectorDataPointWithAttributes(fmt.Sprint(i), randMultiVec(randVec(dim), 3, 0.1), Attributes{"even": i%2 == 0})
+	}
+
+	idx, err := NewMultiVectorIndex(3, dim, 5, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	target := randVec(dim)
+
+	if err := idx.AddDataPoint(NewMultiVectorDataPoint("0", randMultiVec(target, 2, 0))); !errors.Is(err, ErrDataPointExists) {
+		t.Fatalf("expected ErrDataPointExists, got %v", err)
+	}
+
+	if err := idx.AddDataPoint(NewMultiVectorDataPoint("new", [][]float64{randVec(dim), randVec(dim - 1)})); !errors.Is(err, errShapeMismatch) {
+		t.Fatalf("expected errShapeMismatch, got %v", err)
+	}
+
+	if err := idx.AddDataPoint(NewMultiVectorDataPoint[string, float64]("new", nil)); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	// an invalid upsert must keep the existing document
+	if err := idx.UpsertDataPoint(NewMultiVectorDataPoint("2", [][]float64{randVec(dim), randVec(dim - 1)})); !errors.Is(err, errShapeMismatch) {
+		t.Fatalf("expected errShapeMismatch, got %v", err)
+	}
+
+	if idx.documents["2"] != 3 || idx.tokens.IDToDataPointMapping[multiVectorToken[string]{ID: "2", Position: 2}] == nil {
+		t.Fatalf("expected document 2 to keep its 3 embeddings")
+	}
+
+	// the second embedding fails to be added, the first one must be removed again
+	conflict := NewDataPoint(multiVectorToken[string]{ID: "new", Position: 1}, randVec(dim))
+	if err := idx.tokens.AddDataPoint(conflict); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddDataPoint(NewMultiVectorDataPoint("new", randMultiVec(target, 3, 0.1))); !errors.Is(err, ErrDataPointExists) {
+		t.Fatalf("expected ErrDataPointExists, got %v", err)
+	}
+
+	if _, ok := idx.tokens.IDToDataPointMapping[multiVectorToken[string]{ID: "new", Position: 0}]; ok {
+		t.Fatalf("the embeddings of a failed insert must not be indexed")
+	}
+
+	if _, ok := idx.documents["new"]; ok {
+		t.Fatalf("a failed insert must not be counted as document")
+	}
+
+	if err := idx.tokens.DeleteDataPoint(conflict.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the upserted document contains the query embeddings, so it must be the best match
+	if err := idx.UpsertDataPoint(NewMultiVectorDataPointWithAttributes("1", randMultiVec(target, 2, 0), Attributes{"even": false})); err != nil {
+		t.Fatal(err)
+	}
+
+	query := randMultiVec(target, 2, 0)
+
+	results, err := idx.Search(query, 5, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*results)[0].ID != "1" || math.Abs((*results)[0].Score-2) > 1e-9 {
+		t.Fatalf("expected document 1 with a score of 2, got %v", (*results)[0])
+	}
+
+	results, err = idx.Search(query, 5, DefaultBuckets, WithFilter(Eq("even", true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, res := range *results {
+		if res.ID == "1" {
+			t.Fatalf("document 1 doesn't match the filter")
+		}
+	}
+
+	if err := idx.DeleteDataPoint("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.DeleteDataPoint("1"); !errors.Is(err, ErrDataPointNotFound) {
+		t.Fatalf("expected ErrDataPointNotFound, got %v", err)
+	}
+
+	if idx.Len() != 49 || len(idx.tokens.DataPoints) != 49*3 {
+		t.Fatalf("expected 49 documents with %d embeddings, got %d with %d", 49*3, idx.Len(), len(idx.tokens.DataPoints))
+	}
+
+	results, err = idx.Search(query, 5, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*results)[0].ID == "1" {
+		t.Fatalf("deleted document 1 is still returned")
+	}
+
+	if _, err := idx.Search(nil, 5, DefaultBuckets); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	if _, err := idx.Search([][]float64{randVec(dim - 1)}, 5, DefaultBuckets); !errors.Is(err, errShapeMismatch) {
+		t.Fatalf("expected errShapeMismatch, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := idx.SearchContext(ctx, query, 5, DefaultBuckets); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMultiVectorIndex_ConcurrentReadsAndWrites(t *testing.T) {
+	const dim = 4
+
+	rawItems := make([]*MultiVectorDataPoint[int, float64], 100)
+	for i := range rawItems {
+		rawItems[i] = NewMultiVectorDataPoint(i, randMultiVec(randVec(dim), 3, 0.1))
+	}
+
+	idx, err := NewMultiVectorIndex(3, dim, 5, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	var wg sync.WaitGroup
+
+	wg.Add(4)
+
+	// the writer replaces and deletes documents while the readers search
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 100; i++ {
+			if err := idx.UpsertDataPoint(NewMultiVectorDataPoint(i, randMultiVec(randVec(dim), 1+i%4, 0.1))); err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if i%2 == 0 {
+				if err := idx.DeleteDataPoint(i); err != nil {
+					t.Error(err)
+
+					return
+				}
+			}
+		}
+	}()
+
+	for r := 0; r < 3; r++ {
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				if _, err := idx.Search(randMultiVec(randVec(dim), 2, 0.1), 5, DefaultBuckets); err != nil {
+					t.Error(err)
+
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if idx.Len() != 50 {
+		t.Fatalf("expected 50 documents, got %d", idx.Len())
+	}
+}
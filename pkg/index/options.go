@@ -0,0 +1,79 @@
+package index
+
+// IndexOption configures a VectorIndex when it is created.
+type IndexOption func(*indexOptions)
+
+type indexOptions struct {
+	normalize bool
+}
+
+func newIndexOptions(opts []IndexOption) *indexOptions {
+	o := &indexOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithNormalization makes the index L2 normalize the embeddings of its data points when they are added
+// and the queries once per search. The cosine distance then reduces to the dot product, which saves calculating
+// the magnitudes of both vectors for every distance, including the ones needed to build the trees.
+// The search results contain the normalized embeddings, the magnitudes of the original ones are available through VectorIndex.Magnitude.
+// Only distance measures that don't depend on the magnitude of the vectors can be used, see ScoredDistanceMeasure.PreNormalize.
+func WithNormalization() IndexOption {
+	return func(o *indexOptions) {
+		o.normalize = true
+	}
+}
+
+// SearchOption configures a single search.
+type SearchOption func(*searchOptions)
+
+type searchOptions struct {
+	filter         Filter
+	partialResults bool
+	concurrency    int
+	reRank         int
+}
+
+func newSearchOptions(opts []SearchOption) *searchOptions {
+	o := &searchOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithFilter restricts the search results to data points whose attributes match the filter.
+// The filter is applied while collecting candidates, so the search keeps expanding until enough matching data points are found.
+func WithFilter(filter Filter) SearchOption {
+	return func(o *searchOptions) {
+		o.filter = filter
+	}
+}
+
+// WithPartialResults makes context-aware searches return the best results found so far instead of the context's error
+// when the context is done before the search finished.
+func WithPartialResults() SearchOption {
+	return func(o *searchOptions) {
+		o.partialResults = true
+	}
+}
+
+// WithConcurrency limits the number of queries SearchBatch answers in parallel.
+// Defaults to GOMAXPROCS.
+func WithConcurrency(n int) SearchOption {
+	return func(o *searchOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithReRank makes searches on a quantized index recalculate the exact distances of the best n candidates
+// using the stored embeddings before the results are returned. n is raised to the number of requested results.
+func WithReRank(n int) SearchOption {
+	return func(o *searchOptions) {
+		o.reRank = n
+	}
+}
@@ -0,0 +1,605 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+// the persisted index has the following layout, all numbers are encoded in little endian:
+//
+//	magic, format version
+//	number of roots, number of dimensions, max items per leaf node, distance measure kind (the kind of the minkowski
+//	distance measure is followed by its parameter p), max norm of the data points, whether the embeddings are normalized,
+//	number of bytes per element of the embeddings and normal vectors (4 for float32, 8 for float64)
+//	number of data points, followed by the id (encoded with the IDCodec), the embedding, the magnitude of the original
+//	embedding if the embeddings are normalized and the attributes of each data point
+//	the nodes of each tree in pre-order, each node starts with the normal vector and the offset of its hyperplane,
+//	leaf nodes reference their items by the position in the data point list
+const formatVersion uint32 = 1
+
+var formatMagic = [4]byte{'V', 'D', 'B', 'I'}
+
+// maxPreallocation bounds the number of elements allocated ahead of reading them. Larger collections grow while they are read,
+// so corrupt lengths fail once the input ends instead of allocating huge amounts of memory.
+const maxPreallocation = 1 << 16
+
+const (
+	nodeKindLeaf uint8 = iota
+	nodeKindInner
+)
+
+const (
+	distanceMeasureKindCosine uint8 = iota + 1
+	distanceMeasureKindEuclidean
+	distanceMeasureKindInnerProduct
+	distanceMeasureKindManhattan
+	distanceMeasureKindChebyshev
+	distanceMeasureKindJaccard
+	distanceMeasureKindMinkowski
+)
+
+// distanceMeasureKind returns the kind of the distance measure and its parameter, which is only used by minkowski.
+// nolint: cyclop
+func distanceMeasureKind[F Float](distanceMeasure DistanceMeasure[F]) (uint8, float64, error) {
+	switch dm := distanceMeasure.(type) {
+	case *cosineDistanceMeasure[F]:
+		return distanceMeasureKindCosine, 0, nil
+	case *euclideanDistanceMeasure[F]:
+		return distanceMeasureKindEuclidean, 0, nil
+	case *innerProductDistanceMeasure[F]:
+		return distanceMeasureKindInnerProduct, 0, nil
+	case *manhattanDistanceMeasure[F]:
+		return distanceMeasureKindManhattan, 0, nil
+	case *chebyshevDistanceMeasure[F]:
+		return distanceMeasureKindChebyshev, 0, nil
+	case *jaccardDistanceMeasure[F]:
+		return distanceMeasureKindJaccard, 0, nil
+	case *minkowskiDistanceMeasure[F]:
+		return distanceMeasureKindMinkowski, dm.p, nil
+	default:
+		return 0, 0, errUnsupportedDistanceMeasure
+	}
+}
+
+// nolint: cyclop
+func distanceMeasureFromKind[F Float](kind uint8, parameter float64) (DistanceMeasure[F], error) {
+	switch kind {
+	case distanceMeasureKindCosine:
+		return NewCosineDistanceMeasure[F](), nil
+	case distanceMeasureKindEuclidean:
+		return NewEuclideanDistanceMeasure[F](), nil
+	case distanceMeasureKindInnerProduct:
+		return NewInnerProductDistanceMeasure[F](), nil
+	case distanceMeasureKindManhattan:
+		return NewManhattanDistanceMeasure[F](), nil
+	case distanceMeasureKindChebyshev:
+		return NewChebyshevDistanceMeasure[F](), nil
+	case distanceMeasureKindJaccard:
+		return NewJaccardDistanceMeasure[F](), nil
+	case distanceMeasureKindMinkowski:
+		dm, err := NewMinkowskiDistanceMeasure[F](parameter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidFormat, err.Error())
+		}
+
+		return dm, nil
+	default:
+		return nil, errUnsupportedDistanceMeasure
+	}
+}
+
+// Save writes the index including all trees and data points to w.
+// The identifiers of the data points are encoded using the given codec.
+func (vi *VectorIndex[T, F]) Save(w io.Writer, codec IDCodec[T]) error {
+	vi.lock.RLock()
+	defer vi.lock.RUnlock()
+
+	kind, parameter, err := distanceMeasureKind(vi.DistanceMeasure)
+	if err != nil {
+		return err
+	}
+
+	bw := &binaryWriter{w: bufio.NewWriter(w)}
+	bw.write(formatMagic)
+	bw.write(formatVersion)
+	bw.write(uint32(vi.NumberOfRoots))
+	bw.write(uint32(vi.NumberOfDimensions))
+	bw.write(uint32(vi.MaxItemsPerLeafNode))
+	bw.write(kind)
+
+	if kind == distanceMeasureKindMinkowski {
+		bw.write(parameter)
+	}
+
+	bw.write(vi.maxNorm)
+	bw.write(vi.normalized)
+	bw.write(uint8(bytesPerElement[F]()))
+	bw.write(uint64(len(vi.DataPoints)))
+
+	positions := make(map[T]uint32, len(vi.DataPoints))
+	buf := make([]F, vi.NumberOfDimensions)
+
+	for i, dp := range vi.DataPoints {
+		positions[dp.ID] = uint32(i)
+
+		binaryWriteID(bw, codec, dp.ID)
+		bw.write(vi.embedding(dp, buf))
+
+		if vi.normalized {
+			bw.write(vi.norms[dp.ID])
+		}
+
+		writeAttributes(bw, dp.Attributes)
+	}
+
+	for _, root := range vi.Roots {
+		if root == nil {
+			return errIndexNotBuilt
+		}
+
+		writeNode(bw, root, positions)
+	}
+
+	if bw.err != nil {
+		return bw.err
+	}
+
+	return bw.w.Flush()
+}
+
+func writeNode[T comparable, F Float](bw *binaryWriter, node *treeNode[T, F], positions map[T]uint32) {
+	bw.write(uint32(len(node.normalVec)))
+	bw.write(node.normalVec)
+	bw.write(node.offset)
+
+	if node.isLeaf() {
+		bw.write(nodeKindLeaf)
+		bw.write(uint32(len(node.items)))
+
+		for _, id := range node.items {
+			bw.write(positions[id])
+		}
+
+		return
+	}
+
+	bw.write(nodeKindInner)
+	writeNode(bw, node.left, positions)
+	writeNode(bw, node.right, positions)
+}
+
+// LoadVectorIndex reads an index that was written by VectorIndex.Save.
+// The codec has to match the one used when saving the index. The element type F doesn't have to match,
+// the embeddings of an index saved with float64 can be loaded as float32 and vice versa.
+func LoadVectorIndex[T comparable, F Float](r io.Reader, codec IDCodec[T]) (*VectorIndex[T, F], error) {
+	br := &binaryReader{r: bufio.NewReader(r)}
+
+	var magic [4]byte
+
+	br.read(&magic)
+
+	if br.err != nil || magic != formatMagic {
+		return nil, errInvalidFormat
+	}
+
+	var version uint32
+
+	br.read(&version)
+
+	if br.err != nil {
+		return nil, br.err
+	}
+
+	if version != formatVersion {
+		return nil, fmt.Errorf("%w: %d", errUnsupportedVersion, version)
+	}
+
+	var numberOfRoots, numberOfDimensions, maxItemsPerLeafNode uint32
+
+	var kind uint8
+
+	var parameter, maxNorm float64
+
+	var normalized bool
+
+	var elementSize uint8
+
+	var numberOfDataPoints uint64
+
+	br.read(&numberOfRoots)
+	br.read(&numberOfDimensions)
+	br.read(&maxItemsPerLeafNode)
+	br.read(&kind)
+
+	if kind == distanceMeasureKindMinkowski {
+		br.read(&parameter)
+	}
+
+	br.read(&maxNorm)
+	br.read(&normalized)
+	br.read(&elementSize)
+
+	br.read(&numberOfDataPoints)
+
+	if br.err != nil {
+		return nil, br.err
+	}
+
+	distanceMeasure, err := distanceMeasureFromKind[F](kind, parameter)
+	if err != nil {
+		return nil, err
+	}
+
+	var norms map[T]float64
+	if normalized {
+		norms = make(map[T]float64, imath.Min(numberOfDataPoints, maxPreallocation))
+	}
+
+	dataPoints := make([]*DataPoint[T, F], 0, imath.Min(numberOfDataPoints, maxPreallocation))
+	for i := uint64(0); i < numberOfDataPoints; i++ {
+		id := binaryReadID(br, codec)
+		embedding := readVector[F](br, numberOfDimensions, elementSize)
+
+		if normalized {
+			var norm float64
+			br.read(&norm)
+			norms[id] = norm
+		}
+
+		attributes := readAttributes(br)
+
+		if br.err != nil {
+			return nil, br.err
+		}
+
+		dataPoints = append(dataPoints, NewDataPointWithAttributes(id, embedding, attributes))
+	}
+
+	// the roots are appended while they are read, see maxPreallocation
+	vi, err := NewVectorIndex(0, int(numberOfDimensions), int(maxItemsPerLeafNode), dataPoints, distanceMeasure)
+	if err != nil {
+		return nil, err
+	}
+
+	// the embeddings are normalized already, so the index is created without WithNormalization
+	vi.maxNorm = maxNorm
+	vi.normalized = normalized
+	vi.norms = norms
+
+	for i := uint32(0); i < numberOfRoots; i++ {
+		// every inner node splits off at least one data point, which bounds the number of nodes of a tree
+		budget := 2*len(vi.DataPoints) + 1
+		root := readNode(br, vi, make(map[T]*treeNode[T, F], len(vi.DataPoints)), elementSize, &budget)
+
+		if br.err != nil {
+			return nil, br.err
+		}
+
+		vi.Roots = append(vi.Roots, root)
+	}
+
+	vi.NumberOfRoots = int(numberOfRoots)
+
+	return vi, nil
+}
+
+// readNode reads the node and its subtree and records the leaf of every item in leaves, failing if the tree contains more than budget nodes.
+func readNode[T comparable, F Float](br *binaryReader, vi *VectorIndex[T, F], leaves map[T]*treeNode[T, F], elementSize uint8, budget *int) *treeNode[T, F] {
+	var normalVecLen uint32
+
+	br.read(&normalVecLen)
+
+	*budget--
+
+	if br.err != nil || *budget < 0 || normalVecLen > uint32(vi.treeDimensions()) {
+		br.fail(errInvalidFormat)
+
+		return nil
+	}
+
+	normalVec := readVector[F](br, normalVecLen, elementSize)
+
+	var offset float64
+
+	br.read(&offset)
+
+	var kind uint8
+
+	br.read(&kind)
+
+	// inner nodes need a complete hyperplane, leaves keep the hyperplane for their next split unless none could be computed
+	if br.err == nil && int(normalVecLen) != vi.treeDimensions() && (kind != nodeKindLeaf || normalVecLen != 0) {
+		br.fail(errInvalidFormat)
+
+		return nil
+	}
+
+	node := newTreeNode(vi, leaves, normalVec, offset)
+	vi.IDToTreeNodeMapping[node.nodeID] = node
+
+	switch kind {
+	case nodeKindLeaf:
+		var numberOfItems uint32
+
+		br.read(&numberOfItems)
+
+		// a leaf can't contain more items than there are data points
+		if br.err != nil || int(numberOfItems) > len(vi.DataPoints) {
+			br.fail(errInvalidFormat)
+
+			return nil
+		}
+
+		node.items = make([]T, numberOfItems)
+		for i := range node.items {
+			var position uint32
+
+			br.read(&position)
+
+			if br.err != nil || int(position) >= len(vi.DataPoints) {
+				br.fail(errInvalidFormat)
+
+				return nil
+			}
+
+			node.items[i] = vi.DataPoints[position].ID
+			leaves[node.items[i]] = node
+		}
+	case nodeKindInner:
+		node.items = make([]T, 0)
+		node.left = readNode(br, vi, leaves, elementSize, budget)
+		node.right = readNode(br, vi, leaves, elementSize, budget)
+	default:
+		br.fail(errInvalidFormat)
+	}
+
+	return node
+}
+
+// readVector reads a vector of n elements with the given size in bytes and converts it to the element type F.
+// The vector is read in chunks of at most maxPreallocation elements, see maxPreallocation.
+func readVector[F Float](br *binaryReader, n uint32, elementSize uint8) []F {
+	v := make([]F, 0, imath.Min(n, maxPreallocation))
+
+	for br.err == nil && uint32(len(v)) < n {
+		chunk := imath.Min(n-uint32(len(v)), maxPreallocation)
+
+		switch elementSize {
+		case float32Size:
+			v = readChunk[float32](br, v, chunk)
+		case float64Size:
+			v = readChunk[float64](br, v, chunk)
+		default:
+			br.fail(errInvalidFormat)
+		}
+	}
+
+	return v
+}
+
+// readChunk reads n elements stored as S and appends them to v.
+func readChunk[S, F Float](br *binaryReader, v []F, n uint32) []F {
+	stored := make([]S, n)
+	br.read(stored)
+
+	for _, x := range stored {
+		v = append(v, F(x))
+	}
+
+	return v
+}
+
+const (
+	attributeKindString uint8 = iota + 1
+	attributeKindBool
+	attributeKindInt
+	attributeKindUint
+	attributeKindFloat
+	attributeKindTime
+)
+
+// nolint: cyclop
+func writeAttributes(bw *binaryWriter, attributes Attributes) {
+	bw.write(uint32(len(attributes)))
+
+	// write the keys in a deterministic order
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		bw.writeString(key)
+
+		switch v := attributes[key].(type) {
+		case string:
+			bw.write(attributeKindString)
+			bw.writeString(v)
+		case bool:
+			bw.write(attributeKindBool)
+			bw.write(v)
+		case int, int8, int16, int32, int64:
+			bw.write(attributeKindInt)
+			bw.write(reflect.ValueOf(v).Int())
+		case uint, uint8, uint16, uint32, uint64:
+			bw.write(attributeKindUint)
+			bw.write(reflect.ValueOf(v).Uint())
+		case float32, float64:
+			bw.write(attributeKindFloat)
+			bw.write(reflect.ValueOf(v).Float())
+		case time.Time:
+			bw.write(attributeKindTime)
+			bw.write(v.UnixNano())
+		default:
+			if bw.err == nil {
+				bw.err = fmt.Errorf("%w: %s has type %T", errUnsupportedAttribute, key, v)
+			}
+		}
+	}
+}
+
+// readAttributes reads the attributes written by writeAttributes.
+// Integers are restored as int64, unsigned integers as uint64, floats as float64 and timestamps in UTC.
+// nolint: cyclop
+func readAttributes(br *binaryReader) Attributes {
+	var numberOfAttributes uint32
+
+	br.read(&numberOfAttributes)
+
+	if br.err != nil || numberOfAttributes == 0 {
+		return nil
+	}
+
+	attributes := make(Attributes, imath.Min(numberOfAttributes, maxPreallocation))
+
+	for i := uint32(0); i < numberOfAttributes && br.err == nil; i++ {
+		key := br.readString()
+
+		var kind uint8
+
+		br.read(&kind)
+
+		switch kind {
+		case attributeKindString:
+			attributes[key] = br.readString()
+		case attributeKindBool:
+			var v bool
+			br.read(&v)
+			attributes[key] = v
+		case attributeKindInt:
+			var v int64
+			br.read(&v)
+			attributes[key] = v
+		case attributeKindUint:
+			var v uint64
+			br.read(&v)
+			attributes[key] = v
+		case attributeKindFloat:
+			var v float64
+			br.read(&v)
+			attributes[key] = v
+		case attributeKindTime:
+			var v int64
+			br.read(&v)
+			attributes[key] = time.Unix(0, v).UTC()
+		default:
+			br.fail(errInvalidFormat)
+		}
+	}
+
+	return attributes
+}
+
+// binaryWriter remembers the first error, so consecutive writes don't need to be checked individually.
+type binaryWriter struct {
+	w       *bufio.Writer
+	err     error
+	written uint64
+}
+
+func (bw *binaryWriter) write(v interface{}) {
+	if bw.err != nil {
+		return
+	}
+
+	bw.err = binary.Write(bw.w, binary.LittleEndian, v)
+	bw.written += uint64(binary.Size(v))
+}
+
+func (bw *binaryWriter) writeString(v string) {
+	bw.write(uint32(len(v)))
+
+	if bw.err != nil {
+		return
+	}
+
+	_, bw.err = bw.w.WriteString(v)
+	bw.written += uint64(len(v))
+}
+
+// pad writes zero bytes until offset bytes have been written in total.
+func (bw *binaryWriter) pad(offset uint64) {
+	if bw.err == nil && bw.written > offset {
+		bw.err = errInvalidFormat
+	}
+
+	for bw.err == nil && bw.written < offset {
+		bw.err = bw.w.WriteByte(0)
+		bw.written++
+	}
+}
+
+func binaryWriteID[T comparable](bw *binaryWriter, codec IDCodec[T], id T) {
+	if bw.err != nil {
+		return
+	}
+
+	bw.err = codec.EncodeID(bw.w, id)
+}
+
+// binaryReader remembers the first error, so consecutive reads don't need to be checked individually.
+type binaryReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (br *binaryReader) read(v interface{}) {
+	if br.err != nil {
+		return
+	}
+
+	br.setErr(binary.Read(br.r, binary.LittleEndian, v))
+}
+
+func (br *binaryReader) readString() string {
+	var n uint32
+
+	br.read(&n)
+
+	if br.err != nil {
+		return ""
+	}
+
+	buf, err := readBytes(br.r, n)
+	br.setErr(err)
+
+	return string(buf)
+}
+
+func (br *binaryReader) fail(err error) {
+	if br.err == nil {
+		br.err = err
+	}
+}
+
+// setErr stores the error of the last read, input ending before the index is complete is reported as errInvalidFormat.
+func (br *binaryReader) setErr(err error) {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: unexpected end of input", errInvalidFormat)
+	}
+
+	br.err = err
+}
+
+func binaryReadID[T comparable](br *binaryReader, codec IDCodec[T]) T {
+	var id T
+
+	if br.err != nil {
+		return id
+	}
+
+	id, err := codec.DecodeID(br.r)
+	br.setErr(err)
+
+	return id
+}
@@ -0,0 +1,386 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+// nolint: funlen, gocognit, cyclop
+func TestIndex_SaveAndLoad(t *testing.T) {
+	for i, c := range []struct {
+		k, dim, num, nTree, searchNum int
+		bucketScale                   float64
+		distanceMeasure               DistanceMeasure[float64]
+	}{
+		{
+			k:               5,
+			dim:             20,
+			num:             2000,
+			nTree:           10,
+			searchNum:       20,
+			bucketScale:     20,
+			distanceMeasure: NewCosineDistanceMeasure[float64](),
+		},
+		{
+			k:               2,
+			dim:             8,
+			num:             500,
+			nTree:           3,
+			searchNum:       10,
+			bucketScale:     10,
+			distanceMeasure: NewEuclideanDistanceMeasure[float64](),
+		},
+		{
+			k:               2,
+			dim:             8,
+			num:             500,
+			nTree:           3,
+			searchNum:       10,
+			bucketScale:     10,
+			distanceMeasure: NewInnerProductDistanceMeasure[float64](),
+		},
+		{
+			k:               2,
+			dim:             8,
+			num:             500,
+			nTree:           3,
+			searchNum:       10,
+			bucketScale:     10,
+			distanceMeasure: minkowski(3),
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[string, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint("item-"+strconv.Itoa(i), randVec(c.dim))
+			}
+
+			idx, err := NewVectorIndex(c.nTree, c.dim, c.k, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			var buf bytes.Buffer
+			if err := idx.Save(&buf, NewStringCodec()); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := LoadVectorIndex[string, float64](&buf, NewStringCodec())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if loaded.NumberOfRoots != idx.NumberOfRoots || loaded.NumberOfDimensions != idx.NumberOfDimensions || loaded.MaxItemsPerLeafNode != idx.MaxItemsPerLeafNode {
+				t.Fatalf("index parameters differ after loading")
+			}
+
+			if !reflect.DeepEqual(loaded.DistanceMeasure, idx.DistanceMeasure) {
+				t.Fatalf("expected distance measure %#v, got %#v", idx.DistanceMeasure, loaded.DistanceMeasure)
+			}
+
+			if len(loaded.DataPoints) != len(idx.DataPoints) || len(loaded.IDToTreeNodeMapping) != len(idx.IDToTreeNodeMapping) {
+				t.Fatalf("index contents differ after loading")
+			}
+
+			for i, dp := range idx.DataPoints {
+				if loaded.DataPoints[i].ID != dp.ID || fmt.Sprint(loaded.DataPoints[i].Embedding) != fmt.Sprint(dp.Embedding) {
+					t.Fatalf("data point %d differs after loading", i)
+				}
+			}
+
+			for i, root := range idx.Roots {
+				if loaded.Roots[i].offset != root.offset {
+					t.Fatalf("expected the offset %f of the %d-th root, got %f", root.offset, i, loaded.Roots[i].offset)
+				}
+
+				checkLeaves(t, loaded.Roots[i])
+			}
+
+			for q := 0; q < 10; q++ {
+				query := randVec(c.dim)
+
+				expected, err := idx.SearchByVector(query, c.searchNum, c.bucketScale)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				actual, err := loaded.SearchByVector(query, c.searchNum, c.bucketScale)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(*expected) != len(*actual) {
+					t.Fatalf("expected %d results, got %d", len(*expected), len(*actual))
+				}
+
+				for i := range *expected {
+					if (*expected)[i].ID != (*actual)[i].ID {
+						t.Fatalf("search results differ at position %d: %v != %v", i, (*expected)[i].ID, (*actual)[i].ID)
+					}
+				}
+			}
+
+			// the loaded index must still accept new data points
+			if err := loaded.AddDataPoint(NewDataPoint("new", randVec(c.dim))); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestIndex_SaveAndLoadAttributes(t *testing.T) {
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	rawItems := []*DataPoint[int, float64]{
+		NewDataPointWithAttributes(0, randVec(4), Attributes{"tenant": "acme", "version": 3, "score": 0.5, "active": true, "created": created}),
+		NewDataPointWithAttributes(1, randVec(4), Attributes{"size": uint16(7)}),
+		NewDataPoint(2, randVec(4)),
+	}
+
+	idx, err := NewVectorIndex(2, 4, 2, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf, NewIntCodec()); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadVectorIndex[int, float64](&buf, NewIntCodec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, Attributes{"tenant": "acme", "version": int64(3), "score": 0.5, "active": true, "created": created}, loaded.IDToDataPointMapping[0].Attributes)
+	assert.Equal(t, Attributes{"size": uint64(7)}, loaded.IDToDataPointMapping[1].Attributes)
+	assert.Equal(t, Attributes(nil), loaded.IDToDataPointMapping[2].Attributes)
+
+	invalid, err := NewVectorIndex(2, 4, 2, []*DataPoint[int, float64]{
+		NewDataPointWithAttributes(0, randVec(4), Attributes{"tags": []string{"a"}}),
+		NewDataPoint(1, randVec(4)),
+	}, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid.Build()
+
+	if err := invalid.Save(&buf, NewIntCodec()); !errors.Is(err, errUnsupportedAttribute) {
+		t.Fatalf("expected errUnsupportedAttribute, got %v", err)
+	}
+}
+
+func TestIndex_LoadInvalidData(t *testing.T) {
+	rawItems := make([]*DataPoint[int, float64], 100)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(4))
+	}
+
+	idx, err := NewVectorIndex(2, 4, 2, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf, NewIntCodec()); !errors.Is(err, errIndexNotBuilt) {
+		t.Fatalf("expected errIndexNotBuilt, got %v", err)
+	}
+
+	idx.Build()
+
+	buf.Reset()
+
+	if err := idx.Save(&buf, NewIntCodec()); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	if _, err := LoadVectorIndex[int, float64](bytes.NewReader([]byte("XXXX")), NewIntCodec()); !errors.Is(err, errInvalidFormat) {
+		t.Fatalf("expected errInvalidFormat, got %v", err)
+	}
+
+	wrongVersion := append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(wrongVersion[4:], formatVersion+1)
+
+	if _, err := LoadVectorIndex[int, float64](bytes.NewReader(wrongVersion), NewIntCodec()); !errors.Is(err, errUnsupportedVersion) {
+		t.Fatalf("expected errUnsupportedVersion, got %v", err)
+	}
+
+	if _, err := LoadVectorIndex[int, float64](bytes.NewReader(data[:len(data)/2]), NewIntCodec()); err == nil {
+		t.Fatalf("expected an error when loading truncated data")
+	}
+
+	// corrupt counts must not be allocated ahead of reading the data
+	for i, c := range []struct {
+		offset int
+		value  uint64
+		size   int
+	}{
+		{offset: 8, value: 1 << 31, size: 4},  // number of roots
+		{offset: 12, value: 1 << 31, size: 4}, // number of dimensions
+		{offset: 31, value: 1 << 62, size: 8}, // number of data points
+	} {
+		corrupt := append([]byte{}, data...)
+		if c.size == 4 {
+			binary.LittleEndian.PutUint32(corrupt[c.offset:], uint32(c.value))
+		} else {
+			binary.LittleEndian.PutUint64(corrupt[c.offset:], c.value)
+		}
+
+		if _, err := LoadVectorIndex[int, float64](bytes.NewReader(corrupt), NewIntCodec()); !errors.Is(err, errInvalidFormat) {
+			t.Fatalf("%d-th corrupt count: expected errInvalidFormat, got %v", i, err)
+		}
+	}
+
+	hugeString := binary.LittleEndian.AppendUint32(nil, 1<<31)
+	if _, err := NewStringCodec().DecodeID(bytes.NewReader(hugeString)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	// an index without roots provides the header and the data points for crafted trees
+	noRoots, err := NewVectorIndex(0, 4, 2, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	noRoots.Build()
+
+	var prefix bytes.Buffer
+	if err := noRoots.Save(&prefix, NewIntCodec()); err != nil {
+		t.Fatal(err)
+	}
+
+	node := func(w *bytes.Buffer, normalVec []float64, kind uint8) {
+		_ = binary.Write(w, binary.LittleEndian, uint32(len(normalVec)))
+		_ = binary.Write(w, binary.LittleEndian, normalVec)
+		_ = binary.Write(w, binary.LittleEndian, 0.0)
+		_ = binary.Write(w, binary.LittleEndian, kind)
+
+		if kind == nodeKindLeaf {
+			_ = binary.Write(w, binary.LittleEndian, uint32(0))
+		}
+	}
+
+	for i, tree := range []func(w *bytes.Buffer){
+		// an inner node without a normal vector
+		func(w *bytes.Buffer) {
+			node(w, nil, nodeKindInner)
+			node(w, nil, nodeKindLeaf)
+			node(w, nil, nodeKindLeaf)
+		},
+		// a well-formed chain of inner nodes with more nodes than the data points allow
+		func(w *bytes.Buffer) {
+			for d := 0; d < 300; d++ {
+				node(w, randVec(4), nodeKindInner)
+			}
+
+			for d := 0; d <= 300; d++ {
+				node(w, nil, nodeKindLeaf)
+			}
+		},
+	} {
+		crafted := bytes.NewBuffer(append([]byte{}, prefix.Bytes()...))
+		binary.LittleEndian.PutUint32(crafted.Bytes()[8:], 1)
+		tree(crafted)
+
+		if _, err := LoadVectorIndex[int, float64](crafted, NewIntCodec()); !errors.Is(err, errInvalidFormat) {
+			t.Fatalf("%d-th crafted tree: expected errInvalidFormat, got %v", i, err)
+		}
+	}
+
+	if _, err := LoadVectorIndex[int64, float64](bytes.NewReader(data), NewFixedSizeCodec[int64]()); err != nil {
+		t.Fatalf("int ids are stored as int64 and must be readable with a fixed-size codec: %v", err)
+	}
+
+	custom, err := NewVectorIndex[int, float64](2, 4, 2, rawItems, &customDistanceMeasure{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom.Build()
+
+	if err := custom.Save(&buf, NewIntCodec()); !errors.Is(err, errUnsupportedDistanceMeasure) {
+		t.Fatalf("expected errUnsupportedDistanceMeasure, got %v", err)
+	}
+}
+
+type customDistanceMeasure struct {
+	euclideanDistanceMeasure[float64]
+}
+
+// nolint: funlen
+func TestIndex_SaveAndLoadFloat32(t *testing.T) {
+	const dim = 8
+
+	rawItems := make([]*DataPoint[int, float32], 200)
+	for i := range rawItems {
+		v := make([]float32, dim)
+		for d, x := range randVec(dim) {
+			v[d] = float32(x)
+		}
+
+		rawItems[i] = NewDataPoint(i, v)
+	}
+
+	idx, err := NewVectorIndex(3, dim, 10, rawItems, NewEuclideanDistanceMeasure[float32]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf, NewIntCodec()); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	loaded, err := LoadVectorIndex[int, float32](bytes.NewReader(data), NewIntCodec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded.DataPoints, idx.DataPoints) {
+		t.Fatalf("data points differ after loading")
+	}
+
+	if !reflect.DeepEqual(loaded.Roots[0].normalVec, idx.Roots[0].normalVec) {
+		t.Fatalf("normal vectors differ after loading")
+	}
+
+	// the element type is converted when the index is loaded with a different one
+	converted, err := LoadVectorIndex[int, float64](bytes.NewReader(data), NewIntCodec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, dp := range idx.DataPoints {
+		for d, v := range dp.Embedding {
+			if converted.DataPoints[i].Embedding[d] != float64(v) {
+				t.Fatalf("data point %d differs after loading as float64", i)
+			}
+		}
+	}
+
+	query := rawItems[0].Embedding
+
+	results, err := loaded.SearchByVector(query, 5, DefaultBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*results)[0].ID != 0 || (*results)[0].Distance != 0 {
+		t.Fatalf("expected the queried item as first result, got %v", (*results)[0])
+	}
+}
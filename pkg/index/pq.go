@@ -0,0 +1,204 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+// MaxProductQuantizationCentroids is the maximum number of centroids per sub-space, so a code fits into a single byte.
+const MaxProductQuantizationCentroids = 256
+
+// ProductQuantizer compresses vectors by splitting them into NumberOfSubspaces sub-vectors
+// and replacing every sub-vector by the position of its nearest centroid in the codebook of that sub-space.
+// A vector is thereby encoded into NumberOfSubspaces bytes instead of 4 or 8 bytes per dimension, F is the element type of the vectors.
+type ProductQuantizer[F Float] struct {
+	NumberOfDimensions int
+	NumberOfSubspaces  int
+	NumberOfCentroids  int
+	// Codebooks[s][c] is the c-th centroid of the s-th sub-space
+	Codebooks [][][]F
+
+	rng *rand.Rand
+}
+
+// NewProductQuantizer creates an untrained quantizer.
+// numberOfDimensions has to be divisible by numberOfSubspaces and numberOfCentroids must not exceed MaxProductQuantizationCentroids.
+func NewProductQuantizer[F Float](numberOfDimensions int, numberOfSubspaces int, numberOfCentroids int) (*ProductQuantizer[F], error) {
+	if numberOfSubspaces < 1 || numberOfDimensions%numberOfSubspaces != 0 {
+		return nil, fmt.Errorf("%w: the number of dimensions must be divisible by the number of sub-spaces", errInvalidParameter)
+	}
+
+	if numberOfCentroids < 1 || numberOfCentroids > MaxProductQuantizationCentroids {
+		return nil, fmt.Errorf("%w: the number of centroids must be between 1 and %d", errInvalidParameter, MaxProductQuantizationCentroids)
+	}
+
+	return &ProductQuantizer[F]{
+		NumberOfDimensions: numberOfDimensions,
+		NumberOfSubspaces:  numberOfSubspaces,
+		NumberOfCentroids:  numberOfCentroids,
+		rng:                rand.New(rand.NewSource(time.Now().UnixNano())), // nolint: gosec
+	}, nil
+}
+
+// Train learns the codebooks by running k-means on the sub-vectors of the sample, which needs to contain at least NumberOfCentroids vectors.
+func (pq *ProductQuantizer[F]) Train(sample [][]F) error {
+	if len(sample) < pq.NumberOfCentroids {
+		return fmt.Errorf("%w: at least %d vectors are required for training", errInvalidParameter, pq.NumberOfCentroids)
+	}
+
+	for _, v := range sample {
+		if len(v) != pq.NumberOfDimensions {
+			return errShapeMismatch
+		}
+	}
+
+	// sub-vectors are clustered by their euclidean distance, independent of the distance measure of the index
+	euclidean := NewEuclideanDistanceMeasure[F]()
+	codebooks := make([][][]F, pq.NumberOfSubspaces)
+
+	for s := range codebooks {
+		subVectors := make([][]F, len(sample))
+		for i, v := range sample {
+			subVectors[i] = pq.subVector(v, s)
+		}
+
+		codebooks[s] = kMeans(subVectors, pq.NumberOfCentroids, euclidean, kMeansMaxIterations, pq.rng)
+	}
+
+	pq.Codebooks = codebooks
+
+	return nil
+}
+
+// Encode returns the code of the vector, one byte per sub-space.
+func (pq *ProductQuantizer[F]) Encode(v []F) ([]byte, error) {
+	if pq.Codebooks == nil {
+		return nil, errQuantizerNotTrained
+	}
+
+	if len(v) != pq.NumberOfDimensions {
+		return nil, errShapeMismatch
+	}
+
+	euclidean := NewEuclideanDistanceMeasure[F]()
+	code := make([]byte, pq.NumberOfSubspaces)
+
+	for s, codebook := range pq.Codebooks {
+		c, _ := nearestCentroid(codebook, pq.subVector(v, s), euclidean)
+		code[s] = byte(c)
+	}
+
+	return code, nil
+}
+
+// Decode reconstructs an approximation of the encoded vector.
+func (pq *ProductQuantizer[F]) Decode(code []byte) ([]F, error) {
+	if pq.Codebooks == nil {
+		return nil, errQuantizerNotTrained
+	}
+
+	if len(code) != pq.NumberOfSubspaces {
+		return nil, errShapeMismatch
+	}
+
+	v := make([]F, 0, pq.NumberOfDimensions)
+	for s, c := range code {
+		v = append(v, pq.Codebooks[s][c]...)
+	}
+
+	return v, nil
+}
+
+func (pq *ProductQuantizer[F]) subVector(v []F, s int) []F {
+	subDims := pq.NumberOfDimensions / pq.NumberOfSubspaces
+
+	return v[s*subDims : (s+1)*subDims]
+}
+
+// distanceTable holds the partial results between a query and all centroids,
+// so the distance between the query and an encoded vector is computed with one table lookup per sub-space.
+// The query itself is not quantized, which makes the distances asymmetric.
+type distanceTable[F Float] struct {
+	pq              *ProductQuantizer[F]
+	distanceMeasure DistanceMeasure[F]
+	query           []F
+	// euclidean: squared distances of the sub-vectors, cosine: dot products of the sub-vectors
+	partials [][]float64
+	// cosine: squared norms of the centroids, they are derived from the codebooks with the table,
+	// so quantizers whose codebooks were set from outside work as well
+	norms     [][]float64
+	queryNorm float64
+	euclidean bool
+}
+
+func (pq *ProductQuantizer[F]) distanceTable(query []F, distanceMeasure DistanceMeasure[F]) *distanceTable[F] {
+	table := &distanceTable[F]{pq: pq, distanceMeasure: distanceMeasure, query: query}
+
+	switch distanceMeasure.(type) {
+	case *euclideanDistanceMeasure[F], *cosineDistanceMeasure[F]:
+	default:
+		// other distance measures are calculated on the decoded vectors
+		return table
+	}
+
+	_, table.euclidean = distanceMeasure.(*euclideanDistanceMeasure[F])
+	table.partials = make([][]float64, pq.NumberOfSubspaces)
+	table.queryNorm = math.Sqrt(imath.VectorDotProduct(query, query))
+
+	if !table.euclidean {
+		table.norms = make([][]float64, pq.NumberOfSubspaces)
+	}
+
+	for s, codebook := range pq.Codebooks {
+		q := pq.subVector(query, s)
+		table.partials[s] = make([]float64, len(codebook))
+
+		if !table.euclidean {
+			table.norms[s] = make([]float64, len(codebook))
+		}
+
+		for c, centroid := range codebook {
+			if table.euclidean {
+				table.partials[s][c] = imath.SquaredEuclideanDistance(q, centroid)
+			} else {
+				table.partials[s][c] = imath.VectorDotProduct(q, centroid)
+				table.norms[s][c] = imath.VectorDotProduct(centroid, centroid)
+			}
+		}
+	}
+
+	return table
+}
+
+// distance approximates the distance between the query and the vector behind the code.
+func (t *distanceTable[F]) distance(code []byte) float64 {
+	if t.partials == nil {
+		v, _ := t.pq.Decode(code)
+
+		return t.distanceMeasure.CalcDistance(v, t.query)
+	}
+
+	var sum float64
+	for s, c := range code {
+		sum += t.partials[s][c]
+	}
+
+	if t.euclidean {
+		return math.Sqrt(sum)
+	}
+
+	var norm float64
+	for s, c := range code {
+		norm += t.norms[s][c]
+	}
+
+	if t.queryNorm == 0 || norm == 0 {
+		return 0.0
+	}
+
+	return -sum / (t.queryNorm * math.Sqrt(norm))
+}
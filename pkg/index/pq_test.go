@@ -0,0 +1,201 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	itesting "github.com/tobias-mayer/vector-db/internal/testing"
+)
+
+func TestNewProductQuantizer(t *testing.T) {
+	for i, c := range []struct {
+		dim, subspaces, centroids int
+	}{
+		{dim: 10, subspaces: 3, centroids: 16},
+		{dim: 10, subspaces: 0, centroids: 16},
+		{dim: 10, subspaces: 5, centroids: 0},
+		{dim: 10, subspaces: 5, centroids: MaxProductQuantizationCentroids + 1},
+	} {
+		if _, err := NewProductQuantizer[float64](c.dim, c.subspaces, c.centroids); !errors.Is(err, errInvalidParameter) {
+			t.Fatalf("%d-th case: expected errInvalidParameter, got %v", i, err)
+		}
+	}
+}
+
+// nolint: funlen
+func TestProductQuantizer_EncodeDecode(t *testing.T) {
+	pq, err := NewProductQuantizer[float64](8, 4, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pq.Encode(randVec(8)); !errors.Is(err, errQuantizerNotTrained) {
+		t.Fatalf("expected errQuantizerNotTrained, got %v", err)
+	}
+
+	if err := pq.Train([][]float64{randVec(8)}); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	sample := make([][]float64, 1000)
+	for i := range sample {
+		sample[i] = randVec(8)
+	}
+
+	if err := pq.Train(sample); err != nil {
+		t.Fatal(err)
+	}
+
+	euclidean := NewEuclideanDistanceMeasure[float64]()
+
+	var errSum float64
+
+	for _, v := range sample {
+		code, err := pq.Encode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(code) != 4 {
+			t.Fatalf("expected a code of 4 bytes, got %d", len(code))
+		}
+
+		decoded, err := pq.Decode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errSum += euclidean.CalcDistance(v, decoded)
+
+		// the distance tables have to agree with the distances to the decoded vectors
+		for _, dm := range []DistanceMeasure[float64]{NewCosineDistanceMeasure[float64](), euclidean} {
+			query := randVec(8)
+			itesting.AlmostEqual(t, dm.CalcDistance(decoded, query), pq.distanceTable(query, dm).distance(code), 1e-9)
+		}
+	}
+
+	// the vectors are normalized, so random reconstructions would be off by more than 1 on average
+	if avg := errSum / float64(len(sample)); avg > 0.5 {
+		t.Fatalf("reconstruction error too large: %f", avg)
+	}
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestVectorIndex_Quantize(t *testing.T) {
+	for i, c := range []struct {
+		distanceMeasure DistanceMeasure[float64]
+		reRank          int
+		minRatio        float64
+		storage         StorageType
+		// the codebooks are copied into a quantizer that was never trained
+		external bool
+	}{
+		{distanceMeasure: NewCosineDistanceMeasure[float64](), minRatio: 0.4, storage: StorageFloat16},
+		{distanceMeasure: NewCosineDistanceMeasure[float64](), reRank: 100, minRatio: 0.8, storage: StorageFloat16},
+		{distanceMeasure: NewEuclideanDistanceMeasure[float64](), reRank: 100, minRatio: 0.8, storage: StorageFloat16},
+		{distanceMeasure: NewCosineDistanceMeasure[float64](), reRank: 100, minRatio: 0.7, storage: StorageInt8},
+		{distanceMeasure: NewCosineDistanceMeasure[float64](), minRatio: 0.4, storage: StorageInt8, external: true},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], 3000)
+			sample := make([][]float64, len(rawItems))
+
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint(i, randVec(16))
+				sample[i] = rawItems[i].Embedding
+			}
+
+			pq, err := NewProductQuantizer[float64](16, 8, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := pq.Train(sample); err != nil {
+				t.Fatal(err)
+			}
+
+			if c.external {
+				pq = &ProductQuantizer[float64]{NumberOfDimensions: 16, NumberOfSubspaces: 8, NumberOfCentroids: 32, Codebooks: pq.Codebooks}
+			}
+
+			flat, err := NewFlatIndex(16, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			idx, err := NewVectorIndex(10, 16, 10, rawItems[:2500], c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			if err := idx.Quantize(pq); !errors.Is(err, errInvalidParameter) {
+				t.Fatalf("expected errInvalidParameter for quantizing float64 embeddings, got %v", err)
+			}
+
+			if err := idx.SetStorage(c.storage); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := idx.Quantize(pq); err != nil {
+				t.Fatal(err)
+			}
+
+			if idx.Quantizer() != pq {
+				t.Fatalf("expected the quantizer to be set")
+			}
+
+			if err := idx.SetStorage(StorageFloat64); !errors.Is(err, errInvalidParameter) {
+				t.Fatalf("expected errInvalidParameter for restoring float64 embeddings, got %v", err)
+			}
+
+			// data points added after quantizing are encoded on insertion
+			for _, dp := range rawItems[2500:] {
+				if err := idx.AddDataPoint(dp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the codes and the compact embeddings take less memory than the original float64 embeddings
+			size := idx.embeddingsSize()
+			for _, code := range idx.codes {
+				size += len(code)
+			}
+
+			if original := len(rawItems) * 16 * 8; size*2 > original {
+				t.Fatalf("expected less than half of the %d bytes of the original embeddings, got %d", original, size)
+			}
+
+			query := randVec(16)
+
+			expected, err := flat.SearchByVector(query, 10, DefaultBuckets)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ass, err := idx.SearchByVector(query, 10, 100, WithReRank(c.reRank))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedIDsMap := map[int]struct{}{}
+			for _, res := range *expected {
+				expectedIDsMap[res.ID] = struct{}{}
+			}
+
+			var count int
+			for _, res := range *ass {
+				if _, ok := expectedIDsMap[res.ID]; ok {
+					count++
+				}
+			}
+
+			if ratio := float64(count) / 10; ratio < c.minRatio {
+				t.Fatalf("Too few exact neighbors found in quantized result: %d / %d = %f", count, 10, ratio)
+			}
+		})
+	}
+}
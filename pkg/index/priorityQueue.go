@@ -1,31 +1,31 @@
 package index
 
-type queueItem struct {
-	value    string
+type queueItem[V any] struct {
+	value    V
 	index    int
 	priority float64
 }
 
-type priorityQueue []*queueItem
+type priorityQueue[V any] []*queueItem[V]
 
-func (pq priorityQueue) Len() int { return len(pq) }
+func (pq priorityQueue[V]) Len() int { return len(pq) }
 
-func (pq priorityQueue) Less(i, j int) bool { return pq[i].priority < pq[j].priority }
+func (pq priorityQueue[V]) Less(i, j int) bool { return pq[i].priority < pq[j].priority }
 
-func (pq priorityQueue) Swap(i, j int) {
+func (pq priorityQueue[V]) Swap(i, j int) {
 	pq[i], pq[j] = pq[j], pq[i]
 	pq[i].index = i
 	pq[j].index = j
 }
 
-func (pq *priorityQueue) Push(x interface{}) {
+func (pq *priorityQueue[V]) Push(x interface{}) {
 	n := len(*pq)
-	item, _ := x.(*queueItem)
+	item, _ := x.(*queueItem[V])
 	item.index = n
 	*pq = append(*pq, item)
 }
 
-func (pq *priorityQueue) Pop() interface{} {
+func (pq *priorityQueue[V]) Pop() interface{} {
 	old := *pq
 	n := len(old)
 	item := old[n-1]
@@ -0,0 +1,57 @@
+package index
+
+// searchScratch holds the buffers needed during a search, so they can be reused by consecutive searches.
+type searchScratch[T comparable, F Float] struct {
+	pq       priorityQueue[string]
+	idToDist map[T]float64
+	rejected map[T]struct{}
+	ann      []T
+	// decoded embeddings of indexes with a compact storage
+	vec []F
+	// normalized query of indexes that normalize their embeddings
+	query []F
+}
+
+func newSearchScratch[T comparable, F Float]() *searchScratch[T, F] {
+	return &searchScratch[T, F]{
+		idToDist: map[T]float64{},
+		rejected: map[T]struct{}{},
+	}
+}
+
+func (s *searchScratch[T, F]) reset() {
+	for i := range s.pq {
+		s.pq[i] = nil
+	}
+
+	s.pq = s.pq[:0]
+	s.ann = s.ann[:0]
+
+	for id := range s.idToDist {
+		delete(s.idToDist, id)
+	}
+
+	for id := range s.rejected {
+		delete(s.rejected, id)
+	}
+}
+
+// normalizedQuery returns a reusable copy of the query scaled to unit length.
+func (s *searchScratch[T, F]) normalizedQuery(query []F) []F {
+	if len(s.query) != len(query) {
+		s.query = make([]F, len(query))
+	}
+
+	normalizeInto(s.query, query)
+
+	return s.query
+}
+
+// buffer returns a reusable vector with the given number of dimensions.
+func (s *searchScratch[T, F]) buffer(dims int) []F {
+	if len(s.vec) != dims {
+		s.vec = make([]F, dims)
+	}
+
+	return s.vec
+}
@@ -0,0 +1,398 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+// SparseVector is a vector that stores only its non-zero values, e.g. the term weights of SPLADE or BM25.
+// Indices are sorted in increasing order and unique, Values[i] is the value of the dimension Indices[i].
+type SparseVector[F Float] struct {
+	Indices []uint32
+	Values  []F
+}
+
+// NewSparseVector creates a sparse vector from index/value pairs in any order, zero values are dropped.
+// Returns an error if the lengths of indices and values differ or an index occurs more than once.
+func NewSparseVector[F Float](indices []uint32, values []F) (SparseVector[F], error) {
+	if len(indices) != len(values) {
+		return SparseVector[F]{}, fmt.Errorf("%w: %d indices but %d values", errInvalidParameter, len(indices), len(values))
+	}
+
+	order := make([]int, 0, len(indices))
+	for i := range indices {
+		if values[i] != 0 {
+			order = append(order, i)
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return indices[order[i]] < indices[order[j]]
+	})
+
+	sv := SparseVector[F]{Indices: make([]uint32, len(order)), Values: make([]F, len(order))}
+
+	for i, o := range order {
+		if i > 0 && indices[o] == sv.Indices[i-1] {
+			return SparseVector[F]{}, fmt.Errorf("%w: duplicate index %d", errInvalidParameter, indices[o])
+		}
+
+		sv.Indices[i] = indices[o]
+		sv.Values[i] = values[o]
+	}
+
+	return sv, nil
+}
+
+// NewSparseVectorFromMap creates a sparse vector from a map of dimensions to values, zero values are dropped.
+func NewSparseVectorFromMap[F Float](values map[uint32]F) SparseVector[F] {
+	sv := SparseVector[F]{Indices: make([]uint32, 0, len(values)), Values: make([]F, 0, len(values))}
+
+	for index, value := range values {
+		if value != 0 {
+			sv.Indices = append(sv.Indices, index)
+		}
+	}
+
+	sort.Slice(sv.Indices, func(i, j int) bool {
+		return sv.Indices[i] < sv.Indices[j]
+	})
+
+	for _, index := range sv.Indices {
+		sv.Values = append(sv.Values, values[index])
+	}
+
+	return sv
+}
+
+// Len returns the number of non-zero values.
+func (sv SparseVector[F]) Len() int {
+	return len(sv.Indices)
+}
+
+// Dot returns the dot product of two sparse vectors.
+func (sv SparseVector[F]) Dot(other SparseVector[F]) float64 {
+	sum := 0.0
+
+	// both index lists are sorted, so the common dimensions are found by merging them
+	for i, j := 0, 0; i < len(sv.Indices) && j < len(other.Indices); {
+		switch {
+		case sv.Indices[i] < other.Indices[j]:
+			i++
+		case sv.Indices[i] > other.Indices[j]:
+			j++
+		default:
+			sum += float64(sv.Values[i]) * float64(other.Values[j])
+			i++
+			j++
+		}
+	}
+
+	return sum
+}
+
+// Norm returns the euclidean length of the vector.
+func (sv SparseVector[F]) Norm() float64 {
+	return math.Sqrt(imath.VectorDotProduct(sv.Values, sv.Values))
+}
+
+// validate checks that the indices are sorted and unique, which all operations on sparse vectors rely on.
+func (sv SparseVector[F]) validate() error {
+	if len(sv.Indices) != len(sv.Values) {
+		return fmt.Errorf("%w: %d indices but %d values", errInvalidParameter, len(sv.Indices), len(sv.Values))
+	}
+
+	for i := 1; i < len(sv.Indices); i++ {
+		if sv.Indices[i] <= sv.Indices[i-1] {
+			return fmt.Errorf("%w: sparse vector indices must be sorted and unique", errInvalidParameter)
+		}
+	}
+
+	return nil
+}
+
+// SparseDistanceMeasure calculates the distance between two sparse vectors.
+// Like ScoredDistanceMeasure it defines how the calculated values relate to the Distance and the Score of search results.
+type SparseDistanceMeasure[F Float] interface {
+	CalcDistance(v1, v2 SparseVector[F]) float64
+	Distance(value float64) float64
+	Similarity(value float64) float64
+}
+
+type sparseDotProductDistanceMeasure[F Float] struct{}
+
+// NewSparseDotProductDistanceMeasure returns a measure whose distance is the negative dot product of two sparse vectors.
+// It is the usual choice for learned sparse embeddings like SPLADE and for BM25 weights.
+func NewSparseDotProductDistanceMeasure[F Float]() SparseDistanceMeasure[F] {
+	return &sparseDotProductDistanceMeasure[F]{}
+}
+
+func (sdm *sparseDotProductDistanceMeasure[F]) CalcDistance(v1, v2 SparseVector[F]) float64 {
+	// calculates the negative dot product of two sparse vectors
+	return -v1.Dot(v2)
+}
+
+// Distance returns the negative dot product.
+func (sdm *sparseDotProductDistanceMeasure[F]) Distance(value float64) float64 {
+	return value
+}
+
+// Similarity returns the dot product.
+func (sdm *sparseDotProductDistanceMeasure[F]) Similarity(value float64) float64 {
+	return -value
+}
+
+type sparseCosineDistanceMeasure[F Float] struct{}
+
+// NewSparseCosineDistanceMeasure returns the cosine distance of two sparse vectors.
+func NewSparseCosineDistanceMeasure[F Float]() SparseDistanceMeasure[F] {
+	return &sparseCosineDistanceMeasure[F]{}
+}
+
+func (scdm *sparseCosineDistanceMeasure[F]) CalcDistance(v1, v2 SparseVector[F]) float64 {
+	// calculates the negative cosine similarity of two sparse vectors
+	magA := v1.Norm()
+	magB := v2.Norm()
+
+	if magA == 0 || magB == 0 {
+		return 0.0
+	}
+
+	return -v1.Dot(v2) / (magA * magB)
+}
+
+// Distance returns the cosine distance 1 - cos, which lies in [0, 2].
+func (scdm *sparseCosineDistanceMeasure[F]) Distance(value float64) float64 {
+	return 1 + value
+}
+
+// Similarity returns the cosine similarity.
+func (scdm *sparseCosineDistanceMeasure[F]) Similarity(value float64) float64 {
+	return -value
+}
+
+// SparseDataPoint is a sparse vector identified by an ID of type T.
+type SparseDataPoint[T comparable, F Float] struct {
+	ID         T
+	Vector     SparseVector[F]
+	Attributes Attributes
+}
+
+func NewSparseDataPoint[T comparable, F Float](id T, vector SparseVector[F]) *SparseDataPoint[T, F] {
+	return &SparseDataPoint[T, F]{ID: id, Vector: vector}
+}
+
+// NewSparseDataPointWithAttributes creates a sparse data point carrying metadata that can be used to filter search results.
+func NewSparseDataPointWithAttributes[T comparable, F Float](id T, vector SparseVector[F], attributes Attributes) *SparseDataPoint[T, F] {
+	return &SparseDataPoint[T, F]{ID: id, Vector: vector, Attributes: attributes}
+}
+
+// SparseIndex is an inverted index over sparse vectors. It keeps a posting list of the data points per dimension,
+// so a search only looks at the data points sharing at least one non-zero dimension with the query.
+// The distances of those candidates are calculated exactly, data points without a common dimension are never returned.
+// Unlike VectorIndex it must not be modified while it is searched.
+type SparseIndex[T comparable, F Float] struct {
+	DistanceMeasure SparseDistanceMeasure[F]
+
+	// slots holds the indexed data points, deleted ones leave a nil slot that is reused by the next insert
+	slots     []*SparseDataPoint[T, F]
+	freeSlots []int
+	idToSlot  map[T]int
+	// postings holds the slots of the data points with a non-zero value per dimension
+	postings map[uint32][]int
+}
+
+func NewSparseIndex[T comparable, F Float](dataPoints []*SparseDataPoint[T, F], distanceMeasure SparseDistanceMeasure[F]) (*SparseIndex[T, F], error) {
+	si := &SparseIndex[T, F]{
+		DistanceMeasure: distanceMeasure,
+		slots:           make([]*SparseDataPoint[T, F], 0, len(dataPoints)),
+		idToSlot:        make(map[T]int, len(dataPoints)),
+		postings:        map[uint32][]int{},
+	}
+
+	for _, dp := range dataPoints {
+		if err := si.AddDataPoint(dp); err != nil {
+			return nil, err
+		}
+	}
+
+	return si, nil
+}
+
+// Len returns the number of indexed data points.
+func (si *SparseIndex[T, F]) Len() int {
+	return len(si.idToSlot)
+}
+
+// AddDataPoint adds a new data point to the index.
+// Returns ErrDataPointExists if the ID is already indexed, use UpsertDataPoint to replace existing data points.
+func (si *SparseIndex[T, F]) AddDataPoint(dataPoint *SparseDataPoint[T, F]) error {
+	if err := dataPoint.Vector.validate(); err != nil {
+		return err
+	}
+
+	if _, ok := si.idToSlot[dataPoint.ID]; ok {
+		return fmt.Errorf("%w: %v", ErrDataPointExists, dataPoint.ID)
+	}
+
+	si.insert(dataPoint)
+
+	return nil
+}
+
+// UpsertDataPoint adds the data point if its ID is not indexed yet, otherwise it replaces the existing data point.
+func (si *SparseIndex[T, F]) UpsertDataPoint(dataPoint *SparseDataPoint[T, F]) error {
+	if err := dataPoint.Vector.validate(); err != nil {
+		return err
+	}
+
+	if slot, ok := si.idToSlot[dataPoint.ID]; ok {
+		si.remove(slot)
+	}
+
+	si.insert(dataPoint)
+
+	return nil
+}
+
+// DeleteDataPoint removes the data point with the given ID from the index.
+func (si *SparseIndex[T, F]) DeleteDataPoint(id T) error {
+	slot, ok := si.idToSlot[id]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	si.remove(slot)
+
+	return nil
+}
+
+func (si *SparseIndex[T, F]) insert(dataPoint *SparseDataPoint[T, F]) {
+	slot := len(si.slots)
+	if n := len(si.freeSlots); n > 0 {
+		slot = si.freeSlots[n-1]
+		si.freeSlots = si.freeSlots[:n-1]
+		si.slots[slot] = dataPoint
+	} else {
+		si.slots = append(si.slots, dataPoint)
+	}
+
+	si.idToSlot[dataPoint.ID] = slot
+
+	for _, index := range dataPoint.Vector.Indices {
+		si.postings[index] = append(si.postings[index], slot)
+	}
+}
+
+func (si *SparseIndex[T, F]) remove(slot int) {
+	dataPoint := si.slots[slot]
+
+	for _, index := range dataPoint.Vector.Indices {
+		postings := si.postings[index]
+
+		for i := range postings {
+			if postings[i] != slot {
+				continue
+			}
+
+			// the order of a posting list doesn't matter, so the last posting takes the place of the removed one
+			postings[i] = postings[len(postings)-1]
+			postings = postings[:len(postings)-1]
+
+			break
+		}
+
+		if len(postings) == 0 {
+			delete(si.postings, index)
+		} else {
+			si.postings[index] = postings
+		}
+	}
+
+	delete(si.idToSlot, dataPoint.ID)
+	si.slots[slot] = nil
+	si.freeSlots = append(si.freeSlots, slot)
+}
+
+// Search returns the searchNum data points closest to the query.
+// The Vector of the search results is always nil, use SparseIndex.Get to look up the sparse vectors.
+func (si *SparseIndex[T, F]) Search(query SparseVector[F], searchNum int, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	return si.SearchContext(context.Background(), query, searchNum, opts...)
+}
+
+// SearchContext works like Search but stops searching once the context is done.
+// It returns the context's error unless WithPartialResults is given, in which case the best results found so far are returned.
+func (si *SparseIndex[T, F]) SearchContext(ctx context.Context, query SparseVector[F], searchNum int, opts ...SearchOption) (*[]SearchResult[T, F], error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	options := newSearchOptions(opts)
+	checker := newContextChecker(ctx)
+
+	type candidate struct {
+		dp   *SparseDataPoint[T, F]
+		dist float64
+	}
+
+	// only the slots reached through the posting lists of the query are tracked, so the cost doesn't grow with the index
+	visited := map[int]struct{}{}
+	candidates := make([]candidate, 0)
+
+search:
+	for _, index := range query.Indices {
+		for _, slot := range si.postings[index] {
+			if _, ok := visited[slot]; ok {
+				continue
+			}
+
+			visited[slot] = struct{}{}
+
+			if err := checker.err(); err != nil {
+				if options.partialResults {
+					break search
+				}
+
+				return nil, err
+			}
+
+			dp := si.slots[slot]
+			if options.filter != nil && !options.filter.Match(dp.Attributes) {
+				continue
+			}
+
+			candidates = append(candidates, candidate{dp, si.DistanceMeasure.CalcDistance(dp.Vector, query)})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].dist < candidates[j].dist
+	})
+
+	candidates = candidates[:imath.Min(searchNum, len(candidates))]
+
+	searchResults := make([]SearchResult[T, F], len(candidates))
+	for i, c := range candidates {
+		searchResults[i] = SearchResult[T, F]{
+			ID:       c.dp.ID,
+			Distance: si.DistanceMeasure.Distance(c.dist),
+			Score:    si.DistanceMeasure.Similarity(c.dist),
+		}
+	}
+
+	return &searchResults, nil
+}
+
+// Get returns the data point with the given ID.
+func (si *SparseIndex[T, F]) Get(id T) (*SparseDataPoint[T, F], error) {
+	slot, ok := si.idToSlot[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrDataPointNotFound, id)
+	}
+
+	return si.slots[slot], nil
+}
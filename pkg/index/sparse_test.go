@@ -0,0 +1,254 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// randSparseVec returns a sparse vector with up to nnz positive values within the first dim dimensions.
+func randSparseVec(dim, nnz int) SparseVector[float64] {
+	values := make(map[uint32]float64, nnz)
+	for i := 0; i < nnz; i++ {
+		values[uint32(rand.Intn(dim))] = rand.Float64()
+	}
+
+	return NewSparseVectorFromMap(values)
+}
+
+func toDense(sv SparseVector[float64], dim int) []float64 {
+	v := make([]float64, dim)
+	for i, index := range sv.Indices {
+		v[index] = sv.Values[i]
+	}
+
+	return v
+}
+
+func TestNewSparseVector(t *testing.T) {
+	sv, err := NewSparseVector([]uint32{7, 2, 5, 9}, []float64{0.7, 0.2, 0, 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(sv.Indices) != "[2 7 9]" || fmt.Sprint(sv.Values) != "[0.2 0.7 0.9]" {
+		t.Fatalf("expected sorted pairs without zero values, got %v %v", sv.Indices, sv.Values)
+	}
+
+	if _, err := NewSparseVector([]uint32{1, 2}, []float64{1}); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	if _, err := NewSparseVector([]uint32{1, 2, 1}, []float64{1, 2, 3}); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	fromMap := NewSparseVectorFromMap(map[uint32]float64{9: 0.9, 2: 0.2, 7: 0.7, 3: 0})
+	if fmt.Sprint(fromMap) != fmt.Sprint(sv) {
+		t.Fatalf("expected %v, got %v", sv, fromMap)
+	}
+}
+
+func TestSparseDistanceMeasures(t *testing.T) {
+	const dim = 50
+
+	dot := NewSparseDotProductDistanceMeasure[float64]()
+	cosine := NewSparseCosineDistanceMeasure[float64]()
+
+	for i := 0; i < 100; i++ {
+		a, b := randSparseVec(dim, 10), randSparseVec(dim, 10)
+		da, db := toDense(a, dim), toDense(b, dim)
+
+		if got, exp := dot.CalcDistance(a, b), NewInnerProductDistanceMeasure[float64]().CalcDistance(da, db); math.Abs(got-exp) > 1e-12 {
+			t.Fatalf("sparse dot product: got %v, expected %v", got, exp)
+		}
+
+		if got, exp := cosine.CalcDistance(a, b), NewCosineDistanceMeasure[float64]().CalcDistance(da, db); math.Abs(got-exp) > 1e-12 {
+			t.Fatalf("sparse cosine: got %v, expected %v", got, exp)
+		}
+	}
+
+	if got := cosine.CalcDistance(SparseVector[float64]{}, randSparseVec(dim, 10)); got != 0 {
+		t.Fatalf("expected 0 for an empty vector, got %v", got)
+	}
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestSparseIndex_Search(t *testing.T) {
+	for i, c := range []struct {
+		dim, nnz, num, searchNum int
+		distanceMeasure          SparseDistanceMeasure[float64]
+		opts                     []SearchOption
+		matches                  func(id int) bool
+	}{
+		{
+			dim:             1000,
+			nnz:             20,
+			num:             2000,
+			searchNum:       20,
+			distanceMeasure: NewSparseDotProductDistanceMeasure[float64](),
+			matches:         func(id int) bool { return true },
+		},
+		{
+			dim:             200,
+			nnz:             5,
+			num:             1000,
+			searchNum:       10,
+			distanceMeasure: NewSparseCosineDistanceMeasure[float64](),
+			opts:            []SearchOption{WithFilter(Eq("even", true))},
+			matches:         func(id int) bool { return id%2 == 0 },
+		},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*SparseDataPoint[int, float64], c.num)
+			for i := range rawItems {
+				rawItems[i] = NewSparseDataPointWithAttributes(i, randSparseVec(c.dim, c.nnz), Attributes{"even": i%2 == 0})
+			}
+
+			idx, err := NewSparseIndex(rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := randSparseVec(c.dim, c.nnz)
+
+			// exact neighbors among the data points sharing a dimension with the query
+			aDist := map[int]float64{}
+			ids := []int{}
+			for i, v := range rawItems {
+				if !c.matches(i) || v.Vector.Dot(query) == 0 {
+					continue
+				}
+				ids = append(ids, i)
+				aDist[i] = c.distanceMeasure.CalcDistance(v.Vector, query)
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				return aDist[ids[i]] < aDist[ids[j]]
+			})
+
+			results, err := idx.Search(query, c.searchNum, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*results) != c.searchNum {
+				t.Fatalf("expected %d results, got %d", c.searchNum, len(*results))
+			}
+
+			for i, res := range *results {
+				if exp := aDist[ids[i]]; c.distanceMeasure.Distance(exp) != res.Distance {
+					t.Fatalf("expected the distance %f at position %d, got %f", c.distanceMeasure.Distance(exp), i, res.Distance)
+				}
+
+				if res.Score != c.distanceMeasure.Similarity(aDist[res.ID]) {
+					t.Fatalf("expected the score %f of item %d, got %f", c.distanceMeasure.Similarity(aDist[res.ID]), res.ID, res.Score)
+				}
+
+				if !c.matches(res.ID) {
+					t.Fatalf("item %d doesn't match the filter", res.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestSparseIndex_AddUpsertDelete(t *testing.T) {
+	a, _ := NewSparseVector([]uint32{1, 2}, []float64{1, 1})
+	b, _ := NewSparseVector([]uint32{2, 3}, []float64{1, 1})
+	c, _ := NewSparseVector([]uint32{3, 4}, []float64{1, 1})
+
+	idx, err := NewSparseIndex([]*SparseDataPoint[string, float64]{
+		NewSparseDataPoint("a", a),
+		NewSparseDataPoint("b", b),
+	}, NewSparseDotProductDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddDataPoint(NewSparseDataPoint("a", c)); !errors.Is(err, ErrDataPointExists) {
+		t.Fatalf("expected ErrDataPointExists, got %v", err)
+	}
+
+	unsorted := SparseVector[float64]{Indices: []uint32{4, 3}, Values: []float64{1, 1}}
+	if err := idx.AddDataPoint(NewSparseDataPoint("c", unsorted)); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	if err := idx.DeleteDataPoint("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.DeleteDataPoint("a"); !errors.Is(err, ErrDataPointNotFound) {
+		t.Fatalf("expected ErrDataPointNotFound, got %v", err)
+	}
+
+	// the new data point reuses the slot of the deleted one
+	if err := idx.AddDataPoint(NewSparseDataPoint("c", c)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.UpsertDataPoint(NewSparseDataPoint("b", c)); err != nil {
+		t.Fatal(err)
+	}
+
+	if idx.Len() != 2 || len(idx.slots) != 2 {
+		t.Fatalf("expected 2 data points in 2 slots, got %d in %d", idx.Len(), len(idx.slots))
+	}
+
+	query, _ := NewSparseVector([]uint32{1, 2, 4}, []float64{1, 1, 1})
+
+	results, err := idx.Search(query, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a is deleted and b no longer contains the dimension 2, so only the dimension 4 matches
+	if len(*results) != 2 || (*results)[0].Score != 1 || (*results)[1].Score != 1 {
+		t.Fatalf("expected b and c with a score of 1, got %v", *results)
+	}
+
+	if _, ok := idx.postings[1]; ok {
+		t.Fatalf("expected the posting list of the dimension 1 to be removed")
+	}
+
+	dp, err := idx.Get("b")
+	if err != nil || fmt.Sprint(dp.Vector) != fmt.Sprint(c) {
+		t.Fatalf("expected the upserted vector of b, got %v, %v", dp, err)
+	}
+}
+
+func TestSparseIndex_SearchContext(t *testing.T) {
+	rawItems := make([]*SparseDataPoint[int, float64], 1000)
+	for i := range rawItems {
+		rawItems[i] = NewSparseDataPoint(i, randSparseVec(10, 5))
+	}
+
+	idx, err := NewSparseIndex(rawItems, NewSparseDotProductDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	query := randSparseVec(10, 5)
+
+	if _, err := idx.SearchContext(ctx, query, 10); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	results, err := idx.SearchContext(ctx, query, 10, WithPartialResults())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*results) != 0 {
+		t.Fatalf("expected no results for a canceled context, got %d", len(*results))
+	}
+}
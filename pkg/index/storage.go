@@ -0,0 +1,395 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"unsafe"
+
+	imath "github.com/tobias-mayer/vector-db/internal/math"
+)
+
+// StorageType defines how a VectorIndex stores the embeddings of its data points.
+type StorageType int
+
+const (
+	// StorageFloat64 keeps the embeddings of the data points as they are, using 8 bytes per dimension for float64
+	// and 4 bytes per dimension for float32 embeddings.
+	StorageFloat64 StorageType = iota
+	// StorageFloat16 stores the embeddings as half precision floats, using 2 bytes per dimension.
+	StorageFloat16
+	// StorageInt8 scales every dimension to the range of values seen when the storage was set, using 1 byte per dimension.
+	// Values of data points added later on are clamped to that range.
+	StorageInt8
+)
+
+// embeddingStorage holds the embeddings of the data points in a compact representation.
+type embeddingStorage[T comparable, F Float] interface {
+	put(id T, embedding []F)
+	delete(id T)
+	// get decodes the embedding of the data point into buf, buf is allocated if it is nil
+	get(id T, buf []F) []F
+	// equal reports whether the embedding encodes to the stored embedding of the data point
+	equal(id T, embedding []F) bool
+	// size returns the number of bytes used for the embeddings
+	size() int
+}
+
+// scalarCodec encodes the values of an embedding one dimension at a time.
+type scalarCodec[F Float] interface {
+	bytesPerDimension() int
+	encode(dst []byte, embedding []F)
+	decode(dst []F, src []byte)
+}
+
+// compactStorage stores the encoded embeddings in one contiguous block of memory.
+type compactStorage[T comparable, F Float] struct {
+	codec     scalarCodec[F]
+	dims      int
+	data      []byte
+	positions map[T]int
+	// positions of deleted embeddings that can be reused
+	free []int
+	// holds the encoded embedding compared by equal
+	scratch []byte
+}
+
+func newCompactStorage[T comparable, F Float](codec scalarCodec[F], dims int) *compactStorage[T, F] {
+	return &compactStorage[T, F]{codec: codec, dims: dims, positions: map[T]int{}}
+}
+
+func (s *compactStorage[T, F]) put(id T, embedding []F) {
+	pos, ok := s.positions[id]
+
+	switch {
+	case ok:
+	case len(s.free) > 0:
+		pos = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+	default:
+		pos = len(s.data) / s.stride()
+		s.data = append(s.data, make([]byte, s.stride())...)
+	}
+
+	s.positions[id] = pos
+	s.codec.encode(s.data[pos*s.stride():(pos+1)*s.stride()], embedding)
+}
+
+func (s *compactStorage[T, F]) delete(id T) {
+	pos, ok := s.positions[id]
+	if !ok {
+		return
+	}
+
+	delete(s.positions, id)
+	s.free = append(s.free, pos)
+}
+
+func (s *compactStorage[T, F]) get(id T, buf []F) []F {
+	if buf == nil {
+		buf = make([]F, s.dims)
+	}
+
+	pos := s.positions[id]
+	s.codec.decode(buf, s.data[pos*s.stride():(pos+1)*s.stride()])
+
+	return buf
+}
+
+func (s *compactStorage[T, F]) equal(id T, embedding []F) bool {
+	pos, ok := s.positions[id]
+	if !ok {
+		return false
+	}
+
+	if s.scratch == nil {
+		s.scratch = make([]byte, s.stride())
+	}
+
+	s.codec.encode(s.scratch, embedding)
+
+	return bytes.Equal(s.scratch, s.data[pos*s.stride():(pos+1)*s.stride()])
+}
+
+func (s *compactStorage[T, F]) size() int {
+	return len(s.data)
+}
+
+func (s *compactStorage[T, F]) stride() int {
+	return s.dims * s.codec.bytesPerDimension()
+}
+
+type float16Codec[F Float] struct{}
+
+func (float16Codec[F]) bytesPerDimension() int {
+	return 2
+}
+
+func (float16Codec[F]) encode(dst []byte, embedding []F) {
+	for d, v := range embedding {
+		h := float32ToFloat16(float32(v))
+		dst[2*d] = byte(h)
+		dst[2*d+1] = byte(h >> 8)
+	}
+}
+
+func (float16Codec[F]) decode(dst []F, src []byte) {
+	for d := range dst {
+		dst[d] = F(float16ToFloat32(uint16(src[2*d]) | uint16(src[2*d+1])<<8))
+	}
+}
+
+// int8Codec maps the range [min, min + 255 * scale] of every dimension to the values of a byte.
+type int8Codec[F Float] struct {
+	min   []float64
+	scale []float64
+}
+
+func newInt8Codec[F Float](dims int, embeddings [][]F) *int8Codec[F] {
+	c := &int8Codec[F]{min: make([]float64, dims), scale: make([]float64, dims)}
+
+	for d := 0; d < dims; d++ {
+		lower, upper := math.Inf(1), math.Inf(-1)
+
+		for _, embedding := range embeddings {
+			lower = math.Min(lower, float64(embedding[d]))
+			upper = math.Max(upper, float64(embedding[d]))
+		}
+
+		c.min[d] = lower
+		c.scale[d] = (upper - lower) / math.MaxUint8
+	}
+
+	return c
+}
+
+func (*int8Codec[F]) bytesPerDimension() int {
+	return 1
+}
+
+func (c *int8Codec[F]) encode(dst []byte, embedding []F) {
+	for d, v := range embedding {
+		if c.scale[d] == 0 {
+			dst[d] = 0
+
+			continue
+		}
+
+		dst[d] = byte(math.Max(0, math.Min(math.MaxUint8, math.Round((float64(v)-c.min[d])/c.scale[d]))))
+	}
+}
+
+func (c *int8Codec[F]) decode(dst []F, src []byte) {
+	for d := range dst {
+		dst[d] = F(c.min[d] + float64(src[d])*c.scale[d])
+	}
+}
+
+// SetStorage changes how the embeddings of the data points are stored.
+// With StorageFloat16 and StorageInt8 the index keeps copies of the data points without their embeddings
+// and distances are calculated on the decoded embeddings, which only approximate the original ones.
+// StorageInt8 derives the value range of every dimension from the data points currently in the index, so it needs at least one data point.
+// Items whose decoded embeddings fall on the other side of a hyperplane are moved to the matching leaves of the trees.
+// Quantized indexes have to keep a compact storage, see Quantize.
+// Save and SaveMapped write the decoded embeddings, loaded indexes use StorageFloat64.
+func (vi *VectorIndex[T, F]) SetStorage(storageType StorageType) error {
+	vi.lock.Lock()
+	defer vi.lock.Unlock()
+
+	if storageType == StorageFloat64 && vi.quantizer != nil {
+		return fmt.Errorf("%w: a quantized index requires StorageFloat16 or StorageInt8", errInvalidParameter)
+	}
+
+	// the tree vectors start with the embedding, inner product indexes append the augmented dimension
+	previous := make([][]F, len(vi.DataPoints))
+	embeddings := make([][]F, len(vi.DataPoints))
+
+	for i, dp := range vi.DataPoints {
+		previous[i] = vi.treeVector(dp, nil)
+		embeddings[i] = previous[i][:vi.NumberOfDimensions]
+	}
+
+	var storage embeddingStorage[T, F]
+
+	switch storageType {
+	case StorageFloat64:
+	case StorageFloat16:
+		storage = newCompactStorage[T, F](float16Codec[F]{}, vi.NumberOfDimensions)
+	case StorageInt8:
+		if len(embeddings) == 0 {
+			return fmt.Errorf("%w: int8 storage requires data points to derive the value ranges from", errInvalidParameter)
+		}
+
+		storage = newCompactStorage[T, F](newInt8Codec(vi.NumberOfDimensions, embeddings), vi.NumberOfDimensions)
+	default:
+		return fmt.Errorf("%w: unknown storage type %d", errInvalidParameter, storageType)
+	}
+
+	vi.storage = storage
+
+	// the data points are replaced in a new slice, the current one may be shared with the caller of NewVectorIndex
+	dataPoints := make([]*DataPoint[T, F], len(vi.DataPoints))
+	for i, dp := range vi.DataPoints {
+		dataPoints[i] = vi.store(&DataPoint[T, F]{ID: dp.ID, Embedding: embeddings[i], Attributes: dp.Attributes})
+		vi.IDToDataPointMapping[dp.ID] = dataPoints[i]
+	}
+
+	vi.DataPoints = dataPoints
+	vi.relocate(previous)
+
+	return nil
+}
+
+// relocate moves every item whose tree vector changed to the leaf of its current tree vector in all trees.
+// previous holds the tree vectors the items were placed with, in the order of the data points.
+func (vi *VectorIndex[T, F]) relocate(previous [][]F) {
+	if !vi.built() {
+		return
+	}
+
+	buf := make([]F, vi.treeDimensions())
+
+	for i, dp := range vi.DataPoints {
+		current := vi.treeVector(dp, buf)
+
+		for _, root := range vi.Roots {
+			if leafContains(root.findLeaf(current), dp.ID) {
+				continue
+			}
+
+			root.remove(dp.ID, previous[i])
+			root.insert(dp.ID, current)
+		}
+	}
+}
+
+func leafContains[T comparable, F Float](leaf *treeNode[T, F], id T) bool {
+	for _, item := range leaf.items {
+		if item == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// store puts the embedding into the storage of the index and returns the data point to keep in the index.
+func (vi *VectorIndex[T, F]) store(dataPoint *DataPoint[T, F]) *DataPoint[T, F] {
+	if vi.storage == nil {
+		return dataPoint
+	}
+
+	vi.storage.put(dataPoint.ID, dataPoint.Embedding)
+
+	return &DataPoint[T, F]{ID: dataPoint.ID, Attributes: dataPoint.Attributes}
+}
+
+// embedding returns the embedding of the data point, decoding it into buf if the index uses a compact storage.
+func (vi *VectorIndex[T, F]) embedding(dataPoint *DataPoint[T, F], buf []F) []F {
+	if vi.storage == nil || dataPoint.Embedding != nil {
+		return dataPoint.Embedding
+	}
+
+	return vi.storage.get(dataPoint.ID, buf)
+}
+
+// unchanged reports whether the data point is stored with the given embedding.
+// Compact storages compare the encoded embeddings, since the decoded ones only approximate the embeddings they were stored with.
+func (vi *VectorIndex[T, F]) unchanged(dataPoint *DataPoint[T, F], embedding []F) bool {
+	if vi.storage == nil || dataPoint.Embedding != nil {
+		return imath.VectorsEqual(dataPoint.Embedding, embedding)
+	}
+
+	return vi.storage.equal(dataPoint.ID, embedding)
+}
+
+// embeddingsSize returns the number of bytes used for the embeddings of the data points.
+func (vi *VectorIndex[T, F]) embeddingsSize() int {
+	if vi.storage != nil {
+		return vi.storage.size()
+	}
+
+	size := 0
+	for _, dp := range vi.DataPoints {
+		size += len(dp.Embedding) * bytesPerElement[F]()
+	}
+
+	return size
+}
+
+// bytesPerElement returns the size of the element type F, 4 for float32 and 8 for float64.
+func bytesPerElement[F Float]() int {
+	var f F
+
+	return int(unsafe.Sizeof(f))
+}
+
+// float32ToFloat16 converts f to the bits of the nearest IEEE 754 half precision float, rounding ties to even.
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int((bits>>23)&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+
+	switch {
+	case (bits>>23)&0xff == 0xff:
+		// infinity and NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+
+		return sign | 0x7c00
+	case exp >= 0x1f:
+		// too large, round to infinity
+		return sign | 0x7c00
+	case exp <= 0:
+		// subnormal half precision float
+		if exp < -10 {
+			return sign
+		}
+
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		half := uint16(mant >> shift)
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+
+		if rem > halfway || (rem == halfway && half&1 == 1) {
+			half++
+		}
+
+		return sign | half
+	}
+
+	half := sign | uint16(exp<<10) | uint16(mant>>13)
+	rem := mant & 0x1fff
+
+	// a carry into the exponent is intended, it rounds up to the next power of two or to infinity
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++
+	}
+
+	return half
+}
+
+// float16ToFloat32 converts the bits of an IEEE 754 half precision float to a float32.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		// zero and subnormal numbers, mant * 2^-24
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			return -f
+		}
+
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
@@ -0,0 +1,405 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/bmizerany/assert"
+	itesting "github.com/tobias-mayer/vector-db/internal/testing"
+)
+
+func TestFloat16Conversion(t *testing.T) {
+	for i, c := range []struct {
+		f   float32
+		exp uint16
+	}{
+		{f: 0, exp: 0x0000},
+		{f: 1, exp: 0x3c00},
+		{f: -2, exp: 0xc000},
+		{f: 0.5, exp: 0x3800},
+		{f: 65504, exp: 0x7bff},
+		{f: 1e6, exp: 0x7c00},
+		{f: float32(math.Inf(-1)), exp: 0xfc00},
+		// smallest subnormal number
+		{f: 1.0 / (1 << 24), exp: 0x0001},
+		// 1 + 2^-11 lies exactly between 1 and the next half precision float, rounds to even
+		{f: 1 + 1.0/(1<<11), exp: 0x3c00},
+		{f: 1 + 3.0/(1<<11), exp: 0x3c02},
+	} {
+		h := float32ToFloat16(c.f)
+		assert.Equal(t, c.exp, h, fmt.Sprintf("%d-th case", i))
+
+		if c.f <= 65504 && c.f >= -65504 && c.f == float32(int(c.f)) {
+			assert.Equal(t, c.f, float16ToFloat32(h), fmt.Sprintf("%d-th case", i))
+		}
+	}
+
+	if f := float16ToFloat32(float32ToFloat16(float32(math.NaN()))); !math.IsNaN(float64(f)) {
+		t.Fatalf("expected NaN, got %f", f)
+	}
+
+	for _, f := range []float32{0.1, -0.3333, 123.456, 1e-3} {
+		itesting.AlmostEqual(t, float64(f), float64(float16ToFloat32(float32ToFloat16(f))), math.Abs(float64(f))*1e-3)
+	}
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestVectorIndex_SetStorage(t *testing.T) {
+	for i, c := range []struct {
+		storageType StorageType
+		maxSize     int
+		minRatio    float64
+	}{
+		{storageType: StorageFloat64, maxSize: 2000 * 16 * 8, minRatio: 0.7},
+		{storageType: StorageFloat16, maxSize: 2000 * 16 * 2, minRatio: 0.7},
+		{storageType: StorageInt8, maxSize: 2000 * 16, minRatio: 0.7},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], 2000)
+			for i := range rawItems {
+				rawItems[i] = NewDataPointWithAttributes(i, randVec(16), Attributes{"even": i%2 == 0})
+			}
+
+			flat, err := NewFlatIndex(16, rawItems, NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			idx, err := NewVectorIndex(10, 16, 10, append([]*DataPoint[int, float64]{}, rawItems[:1900]...), NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := idx.SetStorage(c.storageType); err != nil {
+				t.Fatal(err)
+			}
+
+			idx.Build()
+
+			for _, dp := range rawItems[1900:] {
+				if err := idx.AddDataPoint(dp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if size := idx.embeddingsSize(); size > c.maxSize {
+				t.Fatalf("expected the embeddings to use at most %d bytes, got %d", c.maxSize, size)
+			}
+
+			query := randVec(16)
+
+			expected, err := flat.SearchByVector(query, 10, DefaultBuckets, WithFilter(Eq("even", true)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ass, err := idx.SearchByVector(query, 10, 40, WithFilter(Eq("even", true)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedIDsMap := map[int]struct{}{}
+			for _, res := range *expected {
+				expectedIDsMap[res.ID] = struct{}{}
+			}
+
+			var count int
+			for _, res := range *ass {
+				if _, ok := expectedIDsMap[res.ID]; ok {
+					count++
+				}
+
+				// the returned vectors are the decoded embeddings
+				itesting.AlmostEqual(t, 1, NewCosineDistanceMeasure[float64]().CalcDistance(res.Vector, rawItems[res.ID].Embedding)*-1, 1e-2)
+			}
+
+			if ratio := float64(count) / 10; ratio < c.minRatio {
+				t.Fatalf("Too few exact neighbors found in approximated result: %d / %d = %f", count, 10, ratio)
+			}
+
+			// modifications relocate the decoded embeddings in the trees
+			if err := idx.UpsertDataPoint(NewDataPoint(0, rawItems[1].Embedding)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := idx.DeleteDataPoint(1); err != nil {
+				t.Fatal(err)
+			}
+
+			ass, err = idx.SearchByItem(0, 1, 40, WithFilter(Eq("even", false)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*ass) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(*ass))
+			}
+
+			// the decoded embeddings are persisted
+			var buf bytes.Buffer
+			if err := idx.Save(&buf, NewIntCodec()); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := LoadVectorIndex[int, float64](&buf, NewIntCodec())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, dp := range loaded.DataPoints {
+				if !vectorsAlmostEqual(dp.Embedding, idx.embedding(idx.IDToDataPointMapping[dp.ID], nil)) {
+					t.Fatalf("expected the embedding of %d to be persisted", dp.ID)
+				}
+			}
+		})
+	}
+}
+
+// nolint: funlen, gocognit, cyclop
+func TestVectorIndex_SetStorageAfterBuild(t *testing.T) {
+	for i, c := range []struct {
+		storageType     StorageType
+		distanceMeasure DistanceMeasure[float64]
+	}{
+		{storageType: StorageFloat16, distanceMeasure: NewCosineDistanceMeasure[float64]()},
+		{storageType: StorageInt8, distanceMeasure: NewCosineDistanceMeasure[float64]()},
+		{storageType: StorageInt8, distanceMeasure: NewInnerProductDistanceMeasure[float64]()},
+	} {
+		c := c
+
+		t.Run(fmt.Sprintf("%d-th case", i), func(t *testing.T) {
+			rawItems := make([]*DataPoint[int, float64], 3000)
+			for i := range rawItems {
+				rawItems[i] = NewDataPoint(i, randVec(16))
+			}
+
+			idx, err := NewVectorIndex(5, 16, 10, rawItems, c.distanceMeasure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Build()
+
+			if err := idx.SetStorage(c.storageType); err != nil {
+				t.Fatal(err)
+			}
+
+			if rawItems[0].Embedding == nil {
+				t.Fatalf("the data points passed to NewVectorIndex must not be replaced")
+			}
+
+			// every item is placed by its decoded embedding
+			for _, dp := range idx.DataPoints {
+				for _, root := range idx.Roots {
+					if !leafContains(root.findLeaf(idx.treeVector(dp, nil)), dp.ID) {
+						t.Fatalf("item %d is not part of the leaf of its decoded embedding", dp.ID)
+					}
+				}
+			}
+
+			for id := 0; id < 1500; id++ {
+				if err := idx.DeleteDataPoint(id); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for id := 1500; id < 1600; id++ {
+				if err := idx.UpsertDataPoint(NewDataPoint(id, randVec(16))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, root := range idx.Roots {
+				items := map[int]int{}
+				collectTree(root, items, map[string]struct{}{})
+				checkLeaves(t, root)
+
+				if len(items) != 1500 {
+					t.Fatalf("expected 1500 items in the tree, got %d", len(items))
+				}
+
+				for id := range items {
+					if _, ok := idx.IDToDataPointMapping[id]; !ok {
+						t.Fatalf("deleted item %d is still part of the tree", id)
+					}
+				}
+			}
+
+			if _, err := idx.SearchByVector(randVec(16), 10, DefaultBuckets); err != nil {
+				t.Fatal(err)
+			}
+
+			for id := 0; id < 100; id++ {
+				if err := idx.AddDataPoint(NewDataPoint(id, randVec(16))); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestVectorIndex_UpsertUnchangedCompact(t *testing.T) {
+	for _, storageType := range []StorageType{StorageFloat16, StorageInt8} {
+		rawItems := make([]*DataPoint[int, float64], 500)
+		for i := range rawItems {
+			rawItems[i] = NewDataPoint(i, randVec(8))
+		}
+
+		idx, err := NewVectorIndex(3, 8, 10, append([]*DataPoint[int, float64]{}, rawItems...), NewCosineDistanceMeasure[float64]())
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Build()
+
+		if err := idx.SetStorage(storageType); err != nil {
+			t.Fatal(err)
+		}
+
+		// the first item of a leaf would move to its end if it was removed and inserted again
+		leaf := idx.Roots[0].findLeaf(idx.treeVector(idx.DataPoints[0], nil))
+		id := leaf.items[0]
+
+		if len(leaf.items) < 2 {
+			t.Fatalf("expected a leaf with several items, got %v", leaf.items)
+		}
+
+		if err := idx.UpsertDataPoint(NewDataPointWithAttributes(id, rawItems[id].Embedding, Attributes{"lang": "de"})); err != nil {
+			t.Fatal(err)
+		}
+
+		if leaf.items[0] != id {
+			t.Fatalf("expected the unchanged item %d to stay in place, got %v", id, leaf.items)
+		}
+
+		assert.Equal(t, Attributes{"lang": "de"}, idx.IDToDataPointMapping[id].Attributes)
+
+		changed := append([]float64{}, rawItems[id].Embedding...)
+		changed[0] += 0.5
+
+		if idx.unchanged(idx.IDToDataPointMapping[id], changed) {
+			t.Fatalf("expected a changed embedding to be detected")
+		}
+	}
+}
+
+func TestVectorIndex_SetStorageInvalid(t *testing.T) {
+	idx, err := NewVectorIndex[int](1, 4, 10, nil, NewEuclideanDistanceMeasure[float64]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.SetStorage(StorageInt8); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+
+	if err := idx.SetStorage(StorageType(42)); !errors.Is(err, errInvalidParameter) {
+		t.Fatalf("expected errInvalidParameter, got %v", err)
+	}
+}
+
+func vectorsAlmostEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// BenchmarkVectorIndex_Storage compares the recall and the memory used for the embeddings of the storage types.
+func BenchmarkVectorIndex_Storage(b *testing.B) {
+	const (
+		dim       = 64
+		num       = 10000
+		searchNum = 10
+		queries   = 20
+		// enough candidates for a meaningful recall in 64 dimensions
+		benchmarkBuckets = 200
+	)
+
+	rawItems := make([]*DataPoint[int, float64], num)
+	for i := range rawItems {
+		rawItems[i] = NewDataPoint(i, randVec(dim))
+	}
+
+	flat, err := NewFlatIndex(dim, rawItems, NewCosineDistanceMeasure[float64]())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name        string
+		storageType StorageType
+	}{
+		{name: "float64", storageType: StorageFloat64},
+		{name: "float16", storageType: StorageFloat16},
+		{name: "int8", storageType: StorageInt8},
+	} {
+		c := c
+
+		b.Run(c.name, func(b *testing.B) {
+			idx, err := NewVectorIndex(10, dim, 20, append([]*DataPoint[int, float64]{}, rawItems...), NewCosineDistanceMeasure[float64]())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if err := idx.SetStorage(c.storageType); err != nil {
+				b.Fatal(err)
+			}
+
+			idx.Build()
+
+			var found, total int
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				query := randVec(dim)
+
+				ass, err := idx.SearchByVector(query, searchNum, benchmarkBuckets)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if i >= queries {
+					continue
+				}
+
+				// measure the recall of the first queries only, the exact search would dominate the benchmark otherwise
+				b.StopTimer()
+
+				expected, err := flat.SearchByVector(query, searchNum, DefaultBuckets)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				expectedIDsMap := map[int]struct{}{}
+				for _, res := range *expected {
+					expectedIDsMap[res.ID] = struct{}{}
+				}
+
+				for _, res := range *ass {
+					if _, ok := expectedIDsMap[res.ID]; ok {
+						found++
+					}
+				}
+
+				total += searchNum
+
+				b.StartTimer()
+			}
+
+			b.ReportMetric(float64(found)/float64(total), "recall")
+			b.ReportMetric(float64(idx.embeddingsSize())/num, "bytes/vector")
+		})
+	}
+}
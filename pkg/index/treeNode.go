@@ -5,32 +5,39 @@ import (
 	imath "github.com/tobias-mayer/vector-db/internal/math"
 )
 
-type treeNode[T comparable] struct {
+type treeNode[T comparable, F Float] struct {
 	nodeID string
-	index  *VectorIndex[T]
+	index  *VectorIndex[T, F]
 	// normal vector defining the hyper plane represented by the node
 	// splits the search space into two halves represented by the left and right child in the tree
-	normalVec []float64
+	normalVec []F
+	// offset of the hyper plane from the origin, see VectorIndex.splitHyperplane
+	offset float64
 
 	// if both, left and right are nil, the node represents a leaf node
-	left  *treeNode[T]
-	right *treeNode[T]
+	left  *treeNode[T, F]
+	right *treeNode[T, F]
 
 	// if the node is a leaf node, items contains the identifiers of our data points
 	items []T
+	// leaves maps the identifiers of all data points in the tree to the leaf node containing them,
+	// the map is shared by all nodes of the tree
+	leaves map[T]*treeNode[T, F]
 }
 
-func newTreeNode[T comparable](index *VectorIndex[T], normalVec []float64) *treeNode[T] {
-	return &treeNode[T]{
+func newTreeNode[T comparable, F Float](index *VectorIndex[T, F], leaves map[T]*treeNode[T, F], normalVec []F, offset float64) *treeNode[T, F] {
+	return &treeNode[T, F]{
 		nodeID:    uuid.New().String(),
 		index:     index,
 		normalVec: normalVec,
+		offset:    offset,
 		left:      nil,
 		right:     nil,
+		leaves:    leaves,
 	}
 }
 
-func (treeNode *treeNode[T]) build(dataPoints []*DataPoint[T]) {
+func (treeNode *treeNode[T, F]) build(dataPoints []*DataPoint[T, F]) {
 	if len(dataPoints) > treeNode.index.MaxItemsPerLeafNode {
 		// if the current subspace contains more datapoints than MaxItemsPerLeafNode,
 		// we need to split it into two new subspaces
@@ -43,16 +50,18 @@ func (treeNode *treeNode[T]) build(dataPoints []*DataPoint[T]) {
 	treeNode.items = make([]T, len(dataPoints))
 	for i, dp := range dataPoints {
 		treeNode.items[i] = dp.ID
+		treeNode.leaves[dp.ID] = treeNode
 	}
 }
 
-func (treeNode *treeNode[T]) buildSubtree(dataPoints []*DataPoint[T]) {
-	leftDataPoints := []*DataPoint[T]{}
-	rightDataPoints := []*DataPoint[T]{}
+func (treeNode *treeNode[T, F]) buildSubtree(dataPoints []*DataPoint[T, F]) {
+	leftDataPoints := []*DataPoint[T, F]{}
+	rightDataPoints := []*DataPoint[T, F]{}
+	buf := make([]F, treeNode.index.treeDimensions())
 
 	for _, dp := range dataPoints {
 		// split datapoints into left and right halves based on the metric
-		if imath.VectorDotProduct(treeNode.normalVec, dp.Embedding) < 0 {
+		if treeNode.margin(treeNode.index.treeVector(dp, buf)) < 0 {
 			leftDataPoints = append(leftDataPoints, dp)
 		} else {
 			rightDataPoints = append(rightDataPoints, dp)
@@ -63,17 +72,20 @@ func (treeNode *treeNode[T]) buildSubtree(dataPoints []*DataPoint[T]) {
 		treeNode.items = make([]T, len(dataPoints))
 		for i, dp := range dataPoints {
 			treeNode.items[i] = dp.ID
+			treeNode.leaves[dp.ID] = treeNode
 		}
 
 		return
 	}
 
 	// recursively build the left and right subtree
-	leftChild := newTreeNode(treeNode.index, treeNode.index.GetNormalVector(leftDataPoints))
+	leftNormalVec, leftOffset := treeNode.index.splitHyperplane(leftDataPoints)
+	leftChild := newTreeNode(treeNode.index, treeNode.leaves, leftNormalVec, leftOffset)
 	leftChild.build(leftDataPoints)
 	treeNode.left = leftChild
 
-	rightChild := newTreeNode(treeNode.index, treeNode.index.GetNormalVector(rightDataPoints))
+	rightNormalVec, rightOffset := treeNode.index.splitHyperplane(rightDataPoints)
+	rightChild := newTreeNode(treeNode.index, treeNode.leaves, rightNormalVec, rightOffset)
 	rightChild.build(rightDataPoints)
 	treeNode.right = rightChild
 
@@ -85,9 +97,10 @@ func (treeNode *treeNode[T]) buildSubtree(dataPoints []*DataPoint[T]) {
 	treeNode.index.Mutex.Unlock()
 }
 
-func (treeNode *treeNode[T]) insert(dataPoint *DataPoint[T]) {
-	leaf := treeNode.findLeaf(dataPoint)
-	leaf.items = append(leaf.items, dataPoint.ID)
+func (treeNode *treeNode[T, F]) insert(id T, embedding []F) {
+	leaf := treeNode.findLeaf(embedding)
+	leaf.items = append(leaf.items, id)
+	leaf.leaves[id] = leaf
 
 	if len(leaf.items) <= leaf.index.MaxItemsPerLeafNode {
 		// the datapoint still fits into the leaf node -> we don't need to do anything
@@ -95,7 +108,7 @@ func (treeNode *treeNode[T]) insert(dataPoint *DataPoint[T]) {
 	}
 
 	// if the datapoint did not fit into the leaf, we have to split the leaf into two new nodes
-	items := make([]*DataPoint[T], len(leaf.items))
+	items := make([]*DataPoint[T, F], len(leaf.items))
 	for i := range items {
 		items[i] = treeNode.index.IDToDataPointMapping[leaf.items[i]]
 	}
@@ -104,15 +117,119 @@ func (treeNode *treeNode[T]) insert(dataPoint *DataPoint[T]) {
 	leaf.build(items)
 }
 
-func (treeNode *treeNode[T]) findLeaf(dataPoint *DataPoint[T]) *treeNode[T] {
-	// recursively finds the leaf node to which the given datapoint belongs
-	if len(treeNode.items) > 0 {
+func (treeNode *treeNode[T, F]) findLeaf(embedding []F) *treeNode[T, F] {
+	// recursively finds the leaf node to which the given embedding belongs
+	if treeNode.isLeaf() {
 		return treeNode
 	}
 
-	if imath.VectorDotProduct(treeNode.normalVec, dataPoint.Embedding) < 0 {
-		return treeNode.left.findLeaf(dataPoint)
+	if treeNode.margin(embedding) < 0 {
+		return treeNode.left.findLeaf(embedding)
 	}
 
-	return treeNode.right.findLeaf(dataPoint)
+	return treeNode.right.findLeaf(embedding)
+}
+
+// remove deletes the datapoint with the given id and embedding from the tree and collapses nodes whose children became too small.
+// The datapoint is looked up in the subspace of the embedding. If it was placed using a slightly different vector,
+// e.g. before the embeddings were stored in a compact format, it is removed from the leaf recorded in leaves instead
+// and the nodes above that leaf are collapsed by later removals. Returns false if the datapoint is not part of the tree.
+func (treeNode *treeNode[T, F]) remove(id T, embedding []F) bool {
+	if treeNode.removeGuided(id, embedding) {
+		return true
+	}
+
+	leaf, ok := treeNode.leaves[id]
+
+	return ok && leaf.removeItem(id)
+}
+
+// removeGuided deletes the datapoint from the leaf of its embedding and collapses the nodes on the path to that leaf.
+func (treeNode *treeNode[T, F]) removeGuided(id T, embedding []F) bool {
+	if treeNode.isLeaf() {
+		return treeNode.removeItem(id)
+	}
+
+	child := treeNode.right
+	if treeNode.margin(embedding) < 0 {
+		child = treeNode.left
+	}
+
+	if !child.removeGuided(id, embedding) {
+		return false
+	}
+
+	treeNode.collapse()
+
+	return true
+}
+
+func (treeNode *treeNode[T, F]) removeItem(id T) bool {
+	for i, item := range treeNode.items {
+		if item == id {
+			treeNode.items = append(treeNode.items[:i], treeNode.items[i+1:]...)
+			delete(treeNode.leaves, id)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (treeNode *treeNode[T, F]) collapse() {
+	left, right := treeNode.left, treeNode.right
+
+	switch {
+	case left.isLeaf() && right.isLeaf() && len(left.items)+len(right.items) <= treeNode.index.MaxItemsPerLeafNode:
+		// both children fit into a single leaf -> merge them into the current node
+		items := make([]T, 0, len(left.items)+len(right.items))
+		items = append(items, left.items...)
+		items = append(items, right.items...)
+
+		treeNode.left = nil
+		treeNode.right = nil
+		treeNode.setItems(items)
+	case left.isLeaf() && len(left.items) == 0:
+		// the left subspace is empty -> the right child takes the place of the current node
+		treeNode.replaceWith(right)
+	case right.isLeaf() && len(right.items) == 0:
+		treeNode.replaceWith(left)
+	default:
+		return
+	}
+
+	treeNode.index.Mutex.Lock()
+	delete(treeNode.index.IDToTreeNodeMapping, left.nodeID)
+	delete(treeNode.index.IDToTreeNodeMapping, right.nodeID)
+	treeNode.index.Mutex.Unlock()
+}
+
+// replaceWith copies the hyper plane, children and items of the given node into the current node.
+// The current node keeps its identifier, so references from the parent stay valid.
+func (treeNode *treeNode[T, F]) replaceWith(other *treeNode[T, F]) {
+	treeNode.normalVec = other.normalVec
+	treeNode.offset = other.offset
+	treeNode.left = other.left
+	treeNode.right = other.right
+	treeNode.setItems(other.items)
+}
+
+// setItems moves the items into the current node.
+func (treeNode *treeNode[T, F]) setItems(items []T) {
+	treeNode.items = items
+	for _, id := range items {
+		treeNode.leaves[id] = treeNode
+	}
+}
+
+// margin returns the signed distance of the embedding to the hyper plane, scaled by the length of the normal vector.
+// Embeddings with a negative margin belong to the left subspace.
+// The embedding may be shorter than the normal vector, missing dimensions count as 0.
+func (treeNode *treeNode[T, F]) margin(embedding []F) float64 {
+	return imath.VectorDotProduct(embedding, treeNode.normalVec) + treeNode.offset
+}
+
+func (treeNode *treeNode[T, F]) isLeaf() bool {
+	return treeNode.left == nil && treeNode.right == nil
 }